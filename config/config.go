@@ -19,6 +19,7 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/coreos/coreos-cloudinit/Godeps/_workspace/src/github.com/coreos/yaml"
 )
@@ -27,12 +28,13 @@ import (
 // directly to YAML. Fields that cannot be set in the cloud-config (fields
 // used for internal use) have the YAML tag '-' so that they aren't marshalled.
 type CloudConfig struct {
-	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys"`
-	CoreOS            CoreOS   `yaml:"coreos"`
-	WriteFiles        []File   `yaml:"write_files"`
-	Hostname          string   `yaml:"hostname"`
-	Users             []User   `yaml:"users"`
-	ManageEtcHosts    EtcHosts `yaml:"manage_etc_hosts"`
+	SSHAuthorizedKeys []string  `yaml:"ssh_authorized_keys"`
+	CoreOS            CoreOS    `yaml:"coreos"`
+	WriteFiles        []File    `yaml:"write_files"`
+	Hostname          string    `yaml:"hostname"`
+	Users             []User    `yaml:"users"`
+	ManageEtcHosts    EtcHosts  `yaml:"manage_etc_hosts"`
+	Frequency         Frequency `yaml:"frequency"`
 }
 
 type CoreOS struct {
@@ -60,14 +62,30 @@ func IsCloudConfig(userdata string) bool {
 // string of YAML), returning any error encountered. It will ignore unknown
 // fields but log encountering them.
 func NewCloudConfig(contents string) (*CloudConfig, error) {
-	yaml.UnmarshalMappingKeyTransform = func(nameIn string) (nameOut string) {
-		return strings.Replace(nameIn, "-", "_", -1)
-	}
 	var cfg CloudConfig
-	err := yaml.Unmarshal([]byte(contents), &cfg)
+	err := UnmarshalYAML([]byte(contents), &cfg, func(nameIn string) (nameOut string) {
+		return strings.Replace(nameIn, "-", "_", -1)
+	})
 	return &cfg, err
 }
 
+// yamlMutex is held while the yaml package is used, since the key transform
+// it applies is set through a global variable.
+var yamlMutex sync.Mutex
+
+// UnmarshalYAML decodes the given YAML document into v, applying transform to
+// each mapping key. The previous transform is restored afterwards, so that
+// documents can be decoded concurrently with different transforms.
+func UnmarshalYAML(data []byte, v interface{}, transform func(nameIn string) (nameOut string)) error {
+	yamlMutex.Lock()
+	defer yamlMutex.Unlock()
+
+	previous := yaml.UnmarshalMappingKeyTransform
+	yaml.UnmarshalMappingKeyTransform = transform
+	defer func() { yaml.UnmarshalMappingKeyTransform = previous }()
+	return yaml.Unmarshal(data, v)
+}
+
 func (cc CloudConfig) String() string {
 	bytes, err := yaml.Marshal(cc)
 	if err != nil {
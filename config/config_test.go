@@ -18,7 +18,10 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
+
+	"github.com/coreos/coreos-cloudinit/Godeps/_workspace/src/github.com/coreos/yaml"
 )
 
 func TestNewCloudConfig(t *testing.T) {
@@ -73,6 +76,47 @@ func TestNewCloudConfig(t *testing.T) {
 	}
 }
 
+func TestUnmarshalYAMLConcurrent(t *testing.T) {
+	identity := func(nameIn string) (nameOut string) {
+		return nameIn
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cfg, err := NewCloudConfig("hostname: foo\nssh-authorized-keys: [key]")
+			if err != nil {
+				t.Errorf("bad error: want %v, got %v", nil, err)
+			} else if !reflect.DeepEqual(cfg.SSHAuthorizedKeys, []string{"key"}) {
+				t.Errorf("bad ssh_authorized_keys: want %q, got %q", []string{"key"}, cfg.SSHAuthorizedKeys)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			var m struct {
+				InstanceID string `yaml:"instance-id"`
+			}
+			if err := UnmarshalYAML([]byte("instance-id: i-1234"), &m, identity); err != nil {
+				t.Errorf("bad error: want %v, got %v", nil, err)
+			} else if m.InstanceID != "i-1234" {
+				t.Errorf("bad instance-id: want %q, got %q", "i-1234", m.InstanceID)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The default transform leaves the keys alone.
+	var m map[string]string
+	if err := yaml.Unmarshal([]byte("instance-id: i-1234"), &m); err != nil {
+		t.Fatalf("bad error: want %v, got %v", nil, err)
+	}
+	if _, ok := m["instance-id"]; !ok {
+		t.Errorf("transform not restored: got %v", m)
+	}
+}
+
 func TestIsZero(t *testing.T) {
 	tests := []struct {
 		c interface{}
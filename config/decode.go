@@ -5,8 +5,12 @@ import (
 	"compress/gzip"
 	"encoding/base64"
 	"fmt"
+	"strings"
 )
 
+// base64GzipPrefix is the start of any base64-encoded gzip stream.
+const base64GzipPrefix = "H4sI"
+
 func DecodeBase64Content(content string) ([]byte, error) {
 	output, err := base64.StdEncoding.DecodeString(content)
 
@@ -54,3 +58,24 @@ func DecodeContent(content string, encoding string) ([]byte, error) {
 
 	return nil, fmt.Errorf("Unsupported encoding %q", encoding)
 }
+
+// DecodeUserData returns the given user-data, decompressed if it is gzipped
+// or base64-encoded gzip. Any other user-data is returned unchanged.
+func DecodeUserData(userdata string) (string, error) {
+	var encoding string
+	switch {
+	case isGzip([]byte(userdata)):
+		encoding = "gzip"
+	case strings.HasPrefix(strings.TrimSpace(userdata), base64GzipPrefix):
+		encoding = "gzip+base64"
+		userdata = strings.TrimSpace(userdata)
+	default:
+		return userdata, nil
+	}
+
+	decoded, err := DecodeContent(userdata, encoding)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
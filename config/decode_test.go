@@ -0,0 +1,46 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestDecodeUserData(t *testing.T) {
+	config := "#cloud-config\nhostname: foo"
+	for _, tt := range []struct {
+		userdata string
+
+		decoded string
+		err     bool
+	}{
+		{"", "", false},
+		{config, config, false},
+		{"#!/bin/bash\necho foo", "#!/bin/bash\necho foo", false},
+		{gzipped(t, config), config, false},
+		{base64.StdEncoding.EncodeToString([]byte(gzipped(t, config))) + "\n", config, false},
+		{"\x1f\x8bnot gzip", "", true},
+		{"H4sInot base64", "", true},
+	} {
+		decoded, err := DecodeUserData(tt.userdata)
+		if (err != nil) != tt.err {
+			t.Errorf("bad error (%q): want %t, got %v", tt.userdata, tt.err, err)
+		}
+		if decoded != tt.decoded {
+			t.Errorf("bad decoded user-data (%q): want %q, got %q", tt.userdata, tt.decoded, decoded)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+const (
+	FrequencyAlways      = "always"
+	FrequencyPerInstance = "per-instance"
+	FrequencyOnce        = "once"
+)
+
+// Frequency controls how often each section of the cloud-config is applied:
+// on every boot ("always", the default), on the first boot of each instance
+// ("per-instance") or only on the very first boot ("once").
+type Frequency struct {
+	Hostname          string `yaml:"hostname"            valid:"^(always|per-instance|once)$"`
+	Users             string `yaml:"users"               valid:"^(always|per-instance|once)$"`
+	SSHAuthorizedKeys string `yaml:"ssh_authorized_keys" valid:"^(always|per-instance|once)$"`
+	WriteFiles        string `yaml:"write_files"         valid:"^(always|per-instance|once)$"`
+	Units             string `yaml:"units"               valid:"^(always|per-instance|once)$"`
+	Scripts           string `yaml:"scripts"             valid:"^(always|per-instance|once)$"`
+}
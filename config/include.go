@@ -0,0 +1,36 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"strings"
+)
+
+// IsInclude returns whether or not the user-data is a list of URLs to include
+// (i.e. begins with "#include").
+func IsInclude(userdata string) bool {
+	return includeHeader(userdata) == "#include"
+}
+
+// IsIncludeOnce returns whether or not the user-data is a list of URLs to
+// include only once (i.e. begins with "#include-once").
+func IsIncludeOnce(userdata string) bool {
+	return includeHeader(userdata) == "#include-once"
+}
+
+func includeHeader(userdata string) string {
+	header := strings.SplitN(userdata, "\n", 2)[0]
+	return strings.TrimSpace(header)
+}
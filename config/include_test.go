@@ -0,0 +1,41 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+)
+
+func TestIsInclude(t *testing.T) {
+	for _, tt := range []struct {
+		userdata string
+		include  bool
+		once     bool
+	}{
+		{"", false, false},
+		{"#cloud-config\nhostname: foo", false, false},
+		{"#included\nhttp://example.com", false, false},
+		{"#include\nhttp://example.com", true, false},
+		{"#include\r\nhttp://example.com", true, false},
+		{"#include-once\nhttp://example.com", false, true},
+	} {
+		if include := IsInclude(tt.userdata); include != tt.include {
+			t.Errorf("bad include detection (%q): want %t, got %t", tt.userdata, tt.include, include)
+		}
+		if once := IsIncludeOnce(tt.userdata); once != tt.once {
+			t.Errorf("bad include-once detection (%q): want %t, got %t", tt.userdata, tt.once, once)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+)
+
+// mergeKeys maps the types of list entries which are identified by one of
+// their fields to the name of that field.
+var mergeKeys = map[reflect.Type]string{
+	reflect.TypeOf(File{}): "Path",
+	reflect.TypeOf(Unit{}): "Name",
+	reflect.TypeOf(User{}): "Name",
+}
+
+// Merge combines the given cloud-configs, which are ordered from lowest to
+// highest precedence. Options which take a single value are taken from the
+// last config which sets them. Lists are concatenated in order, dropping
+// duplicate entries. Files, units and users replace the earlier ones with the
+// same path or name, keeping their position.
+func Merge(configs ...CloudConfig) CloudConfig {
+	var out CloudConfig
+	for _, cfg := range configs {
+		merge(reflect.ValueOf(&out).Elem(), reflect.ValueOf(cfg))
+	}
+	return out
+}
+
+// merge merges src into dst, where src holds the values with the higher
+// precedence.
+func merge(dst, src reflect.Value) {
+	switch dst.Kind() {
+	case reflect.Struct:
+		dt := dst.Type()
+		for i := 0; i < dst.NumField(); i++ {
+			if isFieldExported(dt.Field(i)) {
+				merge(dst.Field(i), src.Field(i))
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < src.Len(); i++ {
+			if j := indexOfEntry(dst, src.Index(i)); j >= 0 {
+				dst.Index(j).Set(src.Index(i))
+			} else {
+				dst.Set(reflect.Append(dst, src.Index(i)))
+			}
+		}
+	default:
+		if !isZero(src) {
+			dst.Set(src)
+		}
+	}
+}
+
+// indexOfEntry returns the index of the entry of list which is the same as
+// entry, or has the same key, or -1 if there is none.
+func indexOfEntry(list, entry reflect.Value) int {
+	key, keyed := mergeKeys[entry.Type()]
+	for i := 0; i < list.Len(); i++ {
+		if keyed && list.Index(i).FieldByName(key).Interface() == entry.FieldByName(key).Interface() {
+			return i
+		}
+		if !keyed && reflect.DeepEqual(list.Index(i).Interface(), entry.Interface()) {
+			return i
+		}
+	}
+	return -1
+}
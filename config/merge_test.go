@@ -0,0 +1,88 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	for _, tt := range []struct {
+		configs []CloudConfig
+		merged  CloudConfig
+	}{
+		{},
+		{
+			configs: []CloudConfig{{Hostname: "first"}},
+			merged:  CloudConfig{Hostname: "first"},
+		},
+		{
+			configs: []CloudConfig{
+				{Hostname: "first"},
+				{Hostname: "second", ManageEtcHosts: "localhost"},
+			},
+			merged: CloudConfig{Hostname: "second", ManageEtcHosts: "localhost"},
+		},
+		{
+			configs: []CloudConfig{
+				{CoreOS: CoreOS{Etcd: Etcd{Name: "node1"}}},
+				{CoreOS: CoreOS{Etcd: Etcd{Name: "node2", Discovery: "https://discovery.etcd.io/abc"}}},
+			},
+			merged: CloudConfig{CoreOS: CoreOS{Etcd: Etcd{Name: "node2", Discovery: "https://discovery.etcd.io/abc"}}},
+		},
+		{
+			configs: []CloudConfig{
+				{SSHAuthorizedKeys: []string{"key1", "key2"}},
+				{SSHAuthorizedKeys: []string{"key2", "key3"}},
+			},
+			merged: CloudConfig{SSHAuthorizedKeys: []string{"key1", "key2", "key3"}},
+		},
+		{
+			configs: []CloudConfig{
+				{
+					WriteFiles: []File{{Path: "/etc/a", Content: "first"}},
+					CoreOS:     CoreOS{Units: []Unit{{Name: "a.service", Command: "start"}}},
+					Users:      []User{{Name: "core", Groups: []string{"docker"}}},
+				},
+				{
+					WriteFiles: []File{{Path: "/etc/a", Content: "second"}, {Path: "/etc/b"}},
+					CoreOS:     CoreOS{Units: []Unit{{Name: "a.service", Command: "stop"}, {Name: "b.service"}}},
+					Users:      []User{{Name: "core"}, {Name: "admin"}},
+				},
+			},
+			merged: CloudConfig{
+				WriteFiles: []File{{Path: "/etc/a", Content: "second"}, {Path: "/etc/b"}},
+				CoreOS:     CoreOS{Units: []Unit{{Name: "a.service", Command: "stop"}, {Name: "b.service"}}},
+				Users:      []User{{Name: "core"}, {Name: "admin"}},
+			},
+		},
+		{
+			configs: []CloudConfig{
+				{Hostname: "first"},
+				{WriteFiles: []File{{Path: "/etc/a", Content: "first"}, {Path: "/etc/b"}, {Path: "/etc/a", Content: "second"}}},
+			},
+			merged: CloudConfig{
+				Hostname:   "first",
+				WriteFiles: []File{{Path: "/etc/a", Content: "second"}, {Path: "/etc/b"}},
+			},
+		},
+	} {
+		merged := Merge(tt.configs...)
+		if !reflect.DeepEqual(tt.merged, merged) {
+			t.Errorf("bad merge (%+v): want %+v, got %+v", tt.configs, tt.merged, merged)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+)
+
+const (
+	ContentTypeCloudConfig    = "text/cloud-config"
+	ContentTypeScript         = "text/x-shellscript"
+	ContentTypeIncludeURL     = "text/x-include-url"
+	ContentTypeIncludeOnceURL = "text/x-include-once-url"
+)
+
+// Part is a single part of multipart user-data. Its content has already been
+// decoded and decompressed.
+type Part struct {
+	ContentType string
+	Content     []byte
+}
+
+// IsMultipart returns whether or not the user-data is a MIME multipart
+// message.
+func IsMultipart(userdata string) bool {
+	msg, err := mail.ReadMessage(strings.NewReader(userdata))
+	if err != nil {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	return err == nil && strings.HasPrefix(mediaType, "multipart/")
+}
+
+// NewMultipart splits the MIME multipart user-data into its parts, flattening
+// any nested multipart messages. Parts whose type can only be determined from
+// their content (e.g. text/plain or gzip-compressed parts) are given the type
+// matching their content, if any.
+func NewMultipart(userdata string) ([]Part, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(userdata))
+	if err != nil {
+		return nil, err
+	}
+	return readParts(msg.Header.Get("Content-Type"), msg.Body)
+}
+
+func readParts(contentType string, body io.Reader) ([]Part, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	if params["boundary"] == "" {
+		return nil, fmt.Errorf("multipart user-data is missing a boundary")
+	}
+
+	var parts []Part
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			return parts, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		partType := p.Header.Get("Content-Type")
+		mediaType, _, err := mime.ParseMediaType(partType)
+		if err != nil {
+			mediaType = "text/plain"
+		}
+
+		if strings.HasPrefix(mediaType, "multipart/") {
+			nested, err := readParts(partType, p)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, nested...)
+			continue
+		}
+
+		content, err := readPartContent(p)
+		if err != nil {
+			return nil, err
+		}
+		if isGzip(content) {
+			if content, err = DecodeGzipContent(string(content)); err != nil {
+				return nil, err
+			}
+			mediaType = ""
+		}
+		switch mediaType {
+		case ContentTypeCloudConfig, ContentTypeScript, ContentTypeIncludeURL, ContentTypeIncludeOnceURL:
+		default:
+			if t := contentTypeOf(string(content)); t != "" {
+				mediaType = t
+			}
+		}
+		parts = append(parts, Part{ContentType: mediaType, Content: content})
+	}
+}
+
+// readPartContent reads the content of the part, undoing any base64 transfer
+// encoding. Quoted-printable parts are already decoded by multipart.Reader.
+func readPartContent(p *multipart.Part) ([]byte, error) {
+	content, err := ioutil.ReadAll(p)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(p.Header.Get("Content-Transfer-Encoding"), "base64") {
+		return DecodeBase64Content(string(content))
+	}
+	return content, nil
+}
+
+func isGzip(content []byte) bool {
+	return len(content) > 2 && content[0] == 0x1f && content[1] == 0x8b
+}
+
+// contentTypeOf returns the content type matching the header of the
+// user-data, or an empty string if it isn't recognized.
+func contentTypeOf(userdata string) string {
+	switch {
+	case IsCloudConfig(userdata):
+		return ContentTypeCloudConfig
+	case IsScript(userdata):
+		return ContentTypeScript
+	case IsIncludeOnce(userdata):
+		return ContentTypeIncludeOnceURL
+	case IsInclude(userdata):
+		return ContentTypeIncludeURL
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func gzipped(t *testing.T, content string) string {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(content)); err != nil {
+		t.Fatalf("Unable to gzip content: %v", err)
+	}
+	w.Close()
+	return buf.String()
+}
+
+func TestIsMultipart(t *testing.T) {
+	for _, tt := range []struct {
+		userdata  string
+		multipart bool
+	}{
+		{"", false},
+		{"#cloud-config\nhostname: foo", false},
+		{"#!/bin/bash\necho foo", false},
+		{"hostname: foo\n\n", false},
+		{"Content-Type: text/plain\n\nfoo", false},
+		{"Content-Type: multipart/mixed; boundary=\"abc\"\nMIME-Version: 1.0\n\n--abc--\n", true},
+		{"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=abc\r\n\r\n--abc--\r\n", true},
+	} {
+		if multipart := IsMultipart(tt.userdata); multipart != tt.multipart {
+			t.Errorf("bad multipart detection (%q): want %t, got %t", tt.userdata, tt.multipart, multipart)
+		}
+	}
+}
+
+func TestNewMultipart(t *testing.T) {
+	for _, tt := range []struct {
+		userdata string
+
+		parts []Part
+		err   bool
+	}{
+		{
+			userdata: "Content-Type: multipart/mixed\n\n",
+			err:      true,
+		},
+		{
+			userdata: `Content-Type: multipart/mixed; boundary="abc"
+MIME-Version: 1.0
+
+--abc
+Content-Type: text/cloud-config
+
+hostname: foo
+--abc
+Content-Type: text/x-shellscript
+
+#!/bin/bash
+echo foo
+--abc
+Content-Type: text/plain
+
+#cloud-config
+hostname: bar
+--abc
+Content-Type: text/x-include-url
+
+http://example.com/user-data
+--abc
+Content-Type: text/x-unknown
+
+foo
+--abc--
+`,
+			parts: []Part{
+				{ContentType: ContentTypeCloudConfig, Content: []byte("hostname: foo")},
+				{ContentType: ContentTypeScript, Content: []byte("#!/bin/bash\necho foo")},
+				{ContentType: ContentTypeCloudConfig, Content: []byte("#cloud-config\nhostname: bar")},
+				{ContentType: ContentTypeIncludeURL, Content: []byte("http://example.com/user-data")},
+				{ContentType: "text/x-unknown", Content: []byte("foo")},
+			},
+		},
+		{
+			userdata: `Content-Type: multipart/mixed; boundary="abc"
+
+--abc
+Content-Type: text/cloud-config
+Content-Transfer-Encoding: base64
+
+` + base64.StdEncoding.EncodeToString([]byte("hostname: foo")) + `
+--abc
+Content-Type: application/x-gzip
+Content-Transfer-Encoding: base64
+
+` + base64.StdEncoding.EncodeToString([]byte(gzipped(t, "#!/bin/bash\necho foo"))) + `
+--abc
+Content-Type: multipart/alternative; boundary="def"
+
+--def
+Content-Type: text/cloud-config
+
+hostname: bar
+--def--
+--abc--
+`,
+			parts: []Part{
+				{ContentType: ContentTypeCloudConfig, Content: []byte("hostname: foo")},
+				{ContentType: ContentTypeScript, Content: []byte("#!/bin/bash\necho foo")},
+				{ContentType: ContentTypeCloudConfig, Content: []byte("hostname: bar")},
+			},
+		},
+	} {
+		parts, err := NewMultipart(tt.userdata)
+		if (err != nil) != tt.err {
+			t.Errorf("bad error (%q): want %t, got %v", tt.userdata, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.parts, parts) {
+			t.Errorf("bad parts (%q): want %q, got %q", tt.userdata, tt.parts, parts)
+		}
+	}
+}
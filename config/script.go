@@ -29,3 +29,33 @@ func NewScript(userdata string) (*Script, error) {
 	s := Script(userdata)
 	return &s, nil
 }
+
+// scriptFrequencyPrefix starts the comment which sets the frequency of a
+// script, e.g. "# coreos-cloudinit frequency: per-instance".
+const scriptFrequencyPrefix = "coreos-cloudinit frequency:"
+
+// Frequency returns the frequency set by a comment in the header of the
+// script (the comments following the shebang), or an empty string if there is
+// none or it isn't valid.
+func (s Script) Frequency() string {
+	lines := strings.Split(string(s), "\n")
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		comment := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		if !strings.HasPrefix(comment, scriptFrequencyPrefix) {
+			continue
+		}
+		switch frequency := strings.TrimSpace(strings.TrimPrefix(comment, scriptFrequencyPrefix)); frequency {
+		case FrequencyAlways, FrequencyPerInstance, FrequencyOnce:
+			return frequency
+		}
+		return ""
+	}
+	return ""
+}
@@ -21,9 +21,16 @@ type Unit struct {
 	Runtime bool         `yaml:"runtime"`
 	Content string       `yaml:"content"`
 	Command string       `yaml:"command" valid:"^(start|stop|restart|reload|try-restart|reload-or-restart|reload-or-try-restart)$"`
+	Wait    *bool        `yaml:"wait"`
 	DropIns []UnitDropIn `yaml:"drop_ins"`
 }
 
+// Blocking returns whether the job of the unit's command is waited for,
+// which it is unless wait is set to false.
+func (u Unit) Blocking() bool {
+	return u.Wait == nil || *u.Wait
+}
+
 type UnitDropIn struct {
 	Name    string `yaml:"name"`
 	Content string `yaml:"content"`
@@ -44,3 +44,25 @@ func TestCommandValid(t *testing.T) {
 		}
 	}
 }
+
+func TestUnitBlocking(t *testing.T) {
+	tests := []struct {
+		config string
+
+		blocking bool
+	}{
+		{config: "coreos:\n  units:\n    - name: foo.service", blocking: true},
+		{config: "coreos:\n  units:\n    - name: foo.service\n      wait: true", blocking: true},
+		{config: "coreos:\n  units:\n    - name: foo.service\n      wait: false", blocking: false},
+	}
+
+	for _, tt := range tests {
+		cfg, err := NewCloudConfig(tt.config)
+		if err != nil {
+			t.Fatalf("bad error (%q): want %v, got %v", tt.config, nil, err)
+		}
+		if blocking := cfg.CoreOS.Units[0].Blocking(); tt.blocking != blocking {
+			t.Errorf("bad blocking (%q): want %t, got %t", tt.config, tt.blocking, blocking)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// Fix returns the given cloud-config with the problems which can be fixed
+// automatically corrected: keys using '-' instead of '_' and unrecognized
+// keys which are close to a known key are renamed, and write_files is moved
+// out from under coreos. The rest of the document, including comments and
+// formatting, is left as it is. Only cloud-configs which can be parsed can be
+// fixed.
+func Fix(cfg []byte) ([]byte, error) {
+	if !config.IsCloudConfig(string(cfg)) {
+		return nil, errors.New(`only "#cloud-config" user-data can be fixed`)
+	}
+
+	var weak map[interface{}]interface{}
+	if err := config.UnmarshalYAML(cfg, &weak, func(nameIn string) (nameOut string) {
+		return nameIn
+	}); err != nil {
+		return nil, err
+	}
+	n := NewNode(weak, NewContext(cfg))
+	g := NewNode(config.CloudConfig{}, NewContext([]byte{}))
+
+	lines := strings.Split(string(cfg), "\n")
+	fixKeys(n, g, g, lines)
+	lines = moveWriteFiles(n, lines)
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// fixKeys renames the keys of n, which has the structure g, in the given
+// lines of the document, descending into each value which has a known
+// structure. The write_files under coreos have the structure of those in
+// root.
+func fixKeys(n, g, root node, lines []string) {
+	switch g.Kind() {
+	case reflect.Struct:
+		for _, cn := range n.children {
+			name := strings.Replace(cn.name, "-", "_", -1)
+			cg := g.Child(name)
+			if g.Type() == reflect.TypeOf(config.CoreOS{}) && name == "write_files" {
+				cg = root.Child(name)
+			} else if !cg.IsValid() {
+				if s := suggestKey(name, g); s != "" && !n.Child(s).IsValid() {
+					name, cg = s, g.Child(s)
+				}
+			}
+			if name != cn.name {
+				renameKey(lines, cn.line, cn.name, name)
+			}
+			if cg.IsValid() && isCompatible(cn.Kind(), cg.Kind()) {
+				fixKeys(cn, cg, root, lines)
+			}
+		}
+	case reflect.Slice:
+		for _, cn := range n.children {
+			var cg node
+			toNode(reflect.New(g.Type().Elem()).Elem().Interface(), context{}, &cg)
+			fixKeys(cn, cg, root, lines)
+		}
+	}
+}
+
+// renameKey renames the key from on the given line to to.
+func renameKey(lines []string, line int, from, to string) {
+	if line < 1 || line > len(lines) {
+		return
+	}
+	exp := regexp.MustCompile(`^( *(?:- +)?)` + regexp.QuoteMeta(from) + `( *:)`)
+	lines[line-1] = exp.ReplaceAllString(lines[line-1], "${1}"+to+"${2}")
+}
+
+// moveWriteFiles moves the write_files under coreos in n, if any, to the top
+// level of the document. If there already are write_files at the top level,
+// the files under coreos are appended to them, unless either is written
+// inline.
+func moveWriteFiles(n node, lines []string) []string {
+	var moved, existing node
+	for _, c := range n.Child("coreos").children {
+		if strings.Replace(c.name, "-", "_", -1) == "write_files" {
+			moved = c
+		}
+	}
+	for _, c := range n.children {
+		if strings.Replace(c.name, "-", "_", -1) == "write_files" {
+			existing = c
+		}
+	}
+	if moved.line < 1 || moved.line > len(lines) || existing.line > len(lines) {
+		return lines
+	}
+
+	start, end := blockLines(lines, moved.line-1)
+	var insert []string
+	var at int
+	if existing.line < 1 {
+		shift := -indentation(lines[start])
+		for _, l := range lines[start:end] {
+			insert = append(insert, shiftLine(l, shift))
+		}
+		at = len(lines)
+		for at > 0 && strings.TrimSpace(lines[at-1]) == "" {
+			at--
+		}
+	} else {
+		if hasInlineValue(lines[start]) || hasInlineValue(lines[existing.line-1]) {
+			return lines
+		}
+		eStart, eEnd := blockLines(lines, existing.line-1)
+		shift := itemIndentation(lines[eStart+1:eEnd], indentation(lines[eStart])+2) - itemIndentation(lines[start+1:end], 0)
+		for _, l := range lines[start+1 : end] {
+			insert = append(insert, shiftLine(l, shift))
+		}
+		at = eEnd
+	}
+
+	var fixed []string
+	for i := 0; i <= len(lines); i++ {
+		if i == at {
+			fixed = append(fixed, insert...)
+		}
+		if i < len(lines) && (i < start || i >= end) {
+			fixed = append(fixed, lines[i])
+		}
+	}
+	return fixed
+}
+
+// blockLines returns the range of the lines of the key on the given line and
+// of its value: the following lines which are indented further, or as far
+// for the items of a sequence, up to the last one which isn't blank or a
+// comment.
+func blockLines(lines []string, line int) (int, int) {
+	indent := indentation(lines[line])
+	end := line + 1
+	for i := line + 1; i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		if in := indentation(lines[i]); in < indent || (in == indent && !strings.HasPrefix(t, "-")) {
+			break
+		}
+		end = i + 1
+	}
+	return line, end
+}
+
+// itemIndentation returns the indentation of the first line which isn't
+// blank or a comment, or def if there is none.
+func itemIndentation(lines []string, def int) int {
+	for _, l := range lines {
+		if t := strings.TrimSpace(l); t != "" && !strings.HasPrefix(t, "#") {
+			return indentation(l)
+		}
+	}
+	return def
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// shiftLine indents the line by the given number of spaces, or removes up to
+// that many spaces if it is negative. Blank lines are left as they are.
+func shiftLine(line string, shift int) string {
+	if strings.TrimSpace(line) == "" {
+		return line
+	}
+	if shift >= 0 {
+		return strings.Repeat(" ", shift) + line
+	}
+	if in := indentation(line); in < -shift {
+		shift = -in
+	}
+	return line[-shift:]
+}
+
+// hasInlineValue returns whether the value of the key on the line follows it
+// on the same line.
+func hasInlineValue(line string) bool {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return false
+	}
+	v := strings.TrimSpace(line[i+1:])
+	return v != "" && !strings.HasPrefix(v, "#")
+}
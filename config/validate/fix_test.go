@@ -0,0 +1,75 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"testing"
+)
+
+func TestFix(t *testing.T) {
+	tests := []struct {
+		config string
+
+		fixed string
+		err   bool
+	}{
+		{
+			config: "#cloud-config\nhostname: foo\n",
+			fixed:  "#cloud-config\nhostname: foo\n",
+		},
+		{
+			config: "#cloud-config\n# keep me\ncoreos:\n  update:\n    reboot-strategy: off # and me\nssh-authorized-keys:\n  - foo\nusers:\n  - name: core\n    no-create-home: true\n",
+			fixed:  "#cloud-config\n# keep me\ncoreos:\n  update:\n    reboot_strategy: off # and me\nssh_authorized_keys:\n  - foo\nusers:\n  - name: core\n    no_create_home: true\n",
+		},
+		{
+			config: "#cloud-config\nhostnme: foo\nssh_authorised_keys:\n  - foo\ncoreos:\n  units:\n    - nam: foo.service\n      comand: start\n      content: |\n        comand: start\nunknown: true\n",
+			fixed:  "#cloud-config\nhostname: foo\nssh_authorized_keys:\n  - foo\ncoreos:\n  units:\n    - name: foo.service\n      command: start\n      content: |\n        comand: start\nunknown: true\n",
+		},
+		{
+			config: "#cloud-config\nhostname: foo\nhostnme: bar\n",
+			fixed:  "#cloud-config\nhostname: foo\nhostnme: bar\n",
+		},
+		{
+			config: "#cloud-config\ncoreos:\n  write_files:\n    - path: /foo\n      content: |\n        bar\n\n  units:\n    - name: foo.service\nhostname: foo\n",
+			fixed:  "#cloud-config\ncoreos:\n\n  units:\n    - name: foo.service\nhostname: foo\nwrite_files:\n  - path: /foo\n    content: |\n      bar\n",
+		},
+		{
+			config: "#cloud-config\nwrite_files:\n- path: /a\ncoreos:\n  write-files:\n    - path: /b\n      permisions: 0644\n",
+			fixed:  "#cloud-config\nwrite_files:\n- path: /a\n- path: /b\n  permissions: 0644\ncoreos:\n",
+		},
+		{
+			config: "#cloud-config\nwrite_files: []\ncoreos:\n  write_files:\n    - path: /b\n",
+			fixed:  "#cloud-config\nwrite_files: []\ncoreos:\n  write_files:\n    - path: /b\n",
+		},
+		{
+			config: "#!/bin/bash\necho hi\n",
+			err:    true,
+		},
+		{
+			config: "#cloud-config\nhostname: [foo\n",
+			err:    true,
+		},
+	}
+
+	for i, tt := range tests {
+		fixed, err := Fix([]byte(tt.config))
+		if (err != nil) != tt.err {
+			t.Errorf("bad error (%d, %q): want error %t, got %v", i, tt.config, tt.err, err)
+		}
+		if string(fixed) != tt.fixed {
+			t.Errorf("bad fix (%d, %q): want %q, got %q", i, tt.config, tt.fixed, fixed)
+		}
+	}
+}
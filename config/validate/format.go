@@ -0,0 +1,210 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// The version of the Static Analysis Results Interchange Format (SARIF)
+// written by WriteReports, and the location of its schema.
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// Document is the report resulting from the validation of the named
+// user-data.
+type Document struct {
+	Name   string
+	Report Report
+}
+
+// WriteReports writes the reports of the given documents to w in the given
+// format, one of "text", "json" or "sarif".
+func WriteReports(w io.Writer, format string, docs []Document) error {
+	switch format {
+	case "text":
+		return writeText(w, docs)
+	case "json":
+		return writeJSON(w, docs)
+	case "sarif":
+		return writeSARIF(w, docs)
+	default:
+		return fmt.Errorf("invalid format %q", format)
+	}
+}
+
+// writeText writes each entry on its own line, prefixed by the name of its
+// document.
+func writeText(w io.Writer, docs []Document) error {
+	for _, d := range docs {
+		for _, e := range d.Report.Entries() {
+			if _, err := fmt.Fprintf(w, "%s: %s\n", d.Name, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeJSON writes a JSON array holding an object with the name and entries
+// of each document.
+func writeJSON(w io.Writer, docs []Document) error {
+	type jsonDocument struct {
+		File    string  `json:"file"`
+		Entries []Entry `json:"entries"`
+	}
+
+	out := []jsonDocument{}
+	for _, d := range docs {
+		entries := d.Report.Entries()
+		if entries == nil {
+			entries = []Entry{}
+		}
+		out = append(out, jsonDocument{File: d.Name, Entries: entries})
+	}
+	return writeIndented(w, out)
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId,omitempty"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// writeSARIF writes a SARIF log with a single run, describing every rule and
+// holding a result for each entry.
+func writeSARIF(w io.Writer, docs []Document) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "coreos-cloudinit",
+			InformationURI: "https://github.com/coreos/coreos-cloudinit",
+		}},
+		Results: []sarifResult{},
+	}
+	for _, r := range append(documentRules, Rules...) {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               r.id,
+			ShortDescription: sarifMessage{r.description},
+		})
+	}
+
+	for _, d := range docs {
+		for _, e := range d.Report.Entries() {
+			location := sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: sarifURI(d.Name)},
+			}
+			if e.line > 0 {
+				location.Region = &sarifRegion{StartLine: e.line, StartColumn: e.column}
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    e.rule,
+				Level:     sarifLevel(e.kind),
+				Message:   sarifMessage{e.message},
+				Locations: []sarifLocation{{location}},
+			})
+		}
+	}
+
+	return writeIndented(w, sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	})
+}
+
+// sarifURI returns the URI of the named file: relative paths are kept as
+// they are, so that they resolve against the root of the repository, and
+// absolute ones are turned into file URIs.
+func sarifURI(name string) string {
+	name = filepath.ToSlash(name)
+	if filepath.IsAbs(name) {
+		return "file://" + name
+	}
+	return name
+}
+
+func sarifLevel(k entryKind) string {
+	switch k {
+	case entryError:
+		return "error"
+	case entryWarning:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+func writeIndented(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,128 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var testDocuments = []Document{
+	{"a.yml", Report{}},
+	{"b.yml", Report{entries: []Entry{
+		{entryWarning, "unrecognized key \"bad\"", 2, 1, "structure"},
+		{entryInfo, "test info", 0, 0, ""},
+	}}},
+	{"/tmp/c.yml", Report{entries: []Entry{
+		{entryError, "invalid value sometimes", 3, 3, "validity"},
+	}}},
+}
+
+func TestWriteReportsText(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteReports(&out, "text", testDocuments); err != nil {
+		t.Fatalf("bad error: want %v, got %v", nil, err)
+	}
+	want := `b.yml: line 2: warning: unrecognized key "bad"
+b.yml: line 0: info: test info
+/tmp/c.yml: line 3: error: invalid value sometimes
+`
+	if out.String() != want {
+		t.Errorf("bad output: want %q, got %q", want, out.String())
+	}
+}
+
+func TestWriteReportsJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteReports(&out, "json", testDocuments[:2]); err != nil {
+		t.Fatalf("bad error: want %v, got %v", nil, err)
+	}
+	want := `[
+  {
+    "file": "a.yml",
+    "entries": []
+  },
+  {
+    "file": "b.yml",
+    "entries": [
+      {
+        "column": 1,
+        "kind": "warning",
+        "line": 2,
+        "message": "unrecognized key \"bad\"",
+        "rule": "structure"
+      },
+      {
+        "column": 0,
+        "kind": "info",
+        "line": 0,
+        "message": "test info"
+      }
+    ]
+  }
+]
+`
+	if out.String() != want {
+		t.Errorf("bad output: want %s, got %s", want, out.String())
+	}
+}
+
+func TestWriteReportsSARIF(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteReports(&out, "sarif", testDocuments); err != nil {
+		t.Fatalf("bad error: want %v, got %v", nil, err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("bad error decoding: want %v, got %v", nil, err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("bad log: %+v", log)
+	}
+
+	run := log.Runs[0]
+	var ids []string
+	for _, r := range run.Tool.Driver.Rules {
+		ids = append(ids, r.ID)
+	}
+	wantIDs := []string{"user-data", "yaml"}
+	for _, r := range Rules {
+		wantIDs = append(wantIDs, r.id)
+	}
+	if !reflect.DeepEqual(wantIDs, ids) {
+		t.Errorf("bad rules: want %q, got %q", wantIDs, ids)
+	}
+
+	location := func(uri string, region *sarifRegion) []sarifLocation {
+		return []sarifLocation{{sarifPhysicalLocation{sarifArtifactLocation{uri}, region}}}
+	}
+	wantResults := []sarifResult{
+		{"structure", "warning", sarifMessage{"unrecognized key \"bad\""}, location("b.yml", &sarifRegion{2, 1})},
+		{"", "note", sarifMessage{"test info"}, location("b.yml", nil)},
+		{"validity", "error", sarifMessage{"invalid value sometimes"}, location("file:///tmp/c.yml", &sarifRegion{3, 3})},
+	}
+	if !reflect.DeepEqual(wantResults, run.Results) {
+		t.Errorf("bad results: want %+v, got %+v", wantResults, run.Results)
+	}
+}
+
+func TestWriteReportsInvalidFormat(t *testing.T) {
+	if err := WriteReports(&bytes.Buffer{}, "xml", testDocuments); err == nil {
+		t.Errorf("bad error: want non-nil, got %v", err)
+	}
+}
@@ -18,16 +18,31 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"strings"
 )
 
 var (
 	yamlKey  = regexp.MustCompile(`^ *-? ?(?P<key>.*?):`)
 	yamlElem = regexp.MustCompile(`^ *-`)
+
+	// yamlFlowKey matches the keys of flow mappings, such as those of
+	// "- {name: core, system: true}".
+	yamlFlowKey = regexp.MustCompile(`[{,] *(?P<key>[^{},:]*?) *:`)
+
+	// yamlLiteral matches the keys whose values are literal block scalars,
+	// whose lines follow the key's line unchanged.
+	yamlLiteral = regexp.MustCompile(`: *\|[-+0-9]* *(#.*)?$`)
+
+	// yamlBlockScalar matches the keys whose values are literal or folded
+	// block scalars.
+	yamlBlockScalar = regexp.MustCompile(`: *[|>][-+0-9]* *(#.*)?$`)
 )
 
 type node struct {
 	name     string
 	line     int
+	column   int
+	literal  bool
 	children []node
 	field    reflect.StructField
 	reflect.Value
@@ -57,7 +72,7 @@ func (n node) HumanType() string {
 }
 
 // NewNode returns the node representation of the given value. The context
-// will be used in an attempt to determine line numbers for the given value.
+// will be used in an attempt to determine the positions of the given value.
 func NewNode(value interface{}, context context) node {
 	var n node
 	toNode(value, context, &n)
@@ -85,9 +100,10 @@ func toNode(v interface{}, c context, n *node) {
 			}
 
 			cn := node{name: k, field: ft}
-			c, ok := findKey(cn.name, c)
+			c, column, ok := findKey(cn.name, c)
 			if ok {
-				cn.line = c.lineNumber
+				cn.line, cn.column = c.lineNumber, column
+				cn.literal = yamlLiteral.MatchString(c.currentLine)
 			}
 			toNode(vv.Field(i).Interface(), c, &cn)
 			n.children = append(n.children, cn)
@@ -97,9 +113,10 @@ func toNode(v interface{}, c context, n *node) {
 		v := v.(map[interface{}]interface{})
 		for k, cv := range v {
 			cn := node{name: fmt.Sprintf("%s", k)}
-			c, ok := findKey(cn.name, c)
+			c, column, ok := findKey(cn.name, c)
 			if ok {
-				cn.line = c.lineNumber
+				cn.line, cn.column = c.lineNumber, column
+				cn.literal = yamlLiteral.MatchString(c.currentLine)
 			}
 			toNode(cv, c, &cn)
 			n.children = append(n.children, cn)
@@ -114,44 +131,85 @@ func toNode(v interface{}, c context, n *node) {
 				name:  fmt.Sprintf("%s[%d]", n.name, i),
 				field: n.field,
 			}
+			var column int
 			var ok bool
-			c, ok = findElem(c)
+			c, column, ok = findElem(c)
 			if ok {
-				cn.line = c.lineNumber
+				cn.line, cn.column = c.lineNumber, column
 			}
 			toNode(vv.Index(i).Interface(), c, &cn)
 			n.children = append(n.children, cn)
 			c.Increment()
 		}
+	case reflect.Ptr:
+		// Optional values are represented by the value they point to, or
+		// its zero value if they aren't set.
+		if vv.IsNil() {
+			toNode(reflect.Zero(vv.Type().Elem()).Interface(), c, n)
+		} else {
+			toNode(vv.Elem().Interface(), c, n)
+		}
 	case reflect.String, reflect.Int, reflect.Bool, reflect.Float64:
 	default:
 		panic(fmt.Sprintf("toNode(): unhandled kind %s", vv.Kind()))
 	}
 }
 
-// findKey attempts to find the requested key within the provided context.
-// A modified copy of the context is returned with every line up to the key
-// incremented past. A boolean, true if the key was found, is also returned.
-func findKey(key string, context context) (context, bool) {
-	return find(yamlKey, key, context)
+// findKey attempts to find the requested key, either as the key of a block
+// mapping or of a flow mapping, within the provided context. The contents of
+// block scalars are skipped. A modified copy of the context is returned with
+// every line up to the key incremented past, along with the column of the
+// key. A boolean, true if the key was found, is also returned.
+func findKey(key string, context context) (context, int, bool) {
+	for len(context.currentLine) > 0 || len(context.remainingLines) > 0 {
+		line := context.currentLine
+		m := yamlKey.FindStringSubmatchIndex(line)
+		if m != nil && line[m[2]:m[3]] == key {
+			return context, m[2] + 1, true
+		}
+		for _, f := range yamlFlowKey.FindAllStringSubmatchIndex(line, -1) {
+			if line[f[2]:f[3]] == key {
+				return context, f[2] + 1, true
+			}
+		}
+
+		context.Increment()
+		if m != nil && yamlBlockScalar.MatchString(line) {
+			context = skipBlock(context, m[2])
+		}
+	}
+	return context, 0, false
 }
 
 // findElem attempts to find an array element within the provided context.
 // A modified copy of the context is returned with every line up to the array
-// element incremented past. A boolean, true if the key was found, is also
-// returned.
-func findElem(context context) (context, bool) {
-	return find(yamlElem, "", context)
+// element incremented past, along with the column of the element (or of its
+// dash, if the element starts on the next line). A boolean, true if the
+// element was found, is also returned.
+func findElem(context context) (context, int, bool) {
+	for len(context.currentLine) > 0 || len(context.remainingLines) > 0 {
+		line := context.currentLine
+		if m := yamlElem.FindStringIndex(line); m != nil {
+			if i := m[1] + len(line[m[1]:]) - len(strings.TrimLeft(line[m[1]:], " ")); i < len(line) {
+				return context, i + 1, true
+			}
+			return context, m[1], true
+		}
+
+		context.Increment()
+	}
+	return context, 0, false
 }
 
-func find(exp *regexp.Regexp, key string, context context) (context, bool) {
+// skipBlock moves the context past the lines of a block scalar, which are
+// blank or indented by more than the given number of spaces.
+func skipBlock(context context, indentation int) context {
 	for len(context.currentLine) > 0 || len(context.remainingLines) > 0 {
-		matches := exp.FindStringSubmatch(context.currentLine)
-		if len(matches) > 0 && (key == "" || matches[1] == key) {
-			return context, true
+		line := context.currentLine
+		if strings.TrimSpace(line) != "" && len(line)-len(strings.TrimLeft(line, " ")) <= indentation {
+			break
 		}
-
 		context.Increment()
 	}
-	return context, false
+	return context
 }
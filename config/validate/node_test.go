@@ -142,15 +142,57 @@ func TestToNode(t *testing.T) {
 			node: node{
 				children: []node{
 					node{
-						line: 1,
-						name: "a",
+						line:   1,
+						column: 1,
+						name:   "a",
+						children: []node{
+							node{name: "b", line: 2, column: 3},
+						},
+					},
+				},
+			},
+		},
+		{
+			value: map[interface{}]interface{}{
+				"a": []interface{}{
+					map[interface{}]interface{}{"b": 1, "c": 2},
+				},
+			},
+			context: NewContext([]byte("a:\n  - {b: 1, c: 2}")),
+			node: node{
+				children: []node{
+					node{
+						line:   1,
+						column: 1,
+						name:   "a",
 						children: []node{
-							node{name: "b", line: 2},
+							node{
+								name:   "a[0]",
+								line:   2,
+								column: 5,
+								children: []node{
+									node{name: "b", line: 2, column: 6},
+									node{name: "c", line: 2, column: 12},
+								},
+							},
 						},
 					},
 				},
 			},
 		},
+		{
+			value: map[interface{}]interface{}{
+				"a": "b\nc\n",
+				"d": "e f",
+			},
+			context: NewContext([]byte("a: |\n  b\n  c\nd: >\n  e\n  f")),
+			node: node{
+				children: []node{
+					node{line: 1, column: 1, name: "a", literal: true},
+					node{line: 4, column: 1, name: "d"},
+				},
+			},
+		},
 		{
 			value: struct {
 				A struct {
@@ -203,13 +245,16 @@ func TestFindKey(t *testing.T) {
 		key     string
 		context context
 
-		found bool
+		found  bool
+		line   int
+		column int
 	}{
 		{},
 		{
 			key:     "key1",
 			context: NewContext([]byte("key1: hi")),
 			found:   true,
+			column:  1,
 		},
 		{
 			key:     "key2",
@@ -220,22 +265,41 @@ func TestFindKey(t *testing.T) {
 			key:     "key3",
 			context: NewContext([]byte("key1:\n  key2:\n    key3: hi")),
 			found:   true,
+			column:  5,
 		},
 		{
 			key:     "key4",
 			context: NewContext([]byte("key1:\n  - key4: hi")),
 			found:   true,
+			column:  5,
 		},
 		{
 			key:     "key5",
 			context: NewContext([]byte("#key5")),
 			found:   false,
 		},
+		{
+			key:     "key6",
+			context: NewContext([]byte("key1: {key2: a, key6: b}")),
+			found:   true,
+			column:  17,
+		},
+		{
+			key:     "key7",
+			context: NewContext([]byte("key1: |\n  key7: a\n\n  b\nkey7: c")),
+			found:   true,
+			line:    5,
+			column:  1,
+		},
 	}
 
 	for _, tt := range tests {
-		if _, found := findKey(tt.key, tt.context); tt.found != found {
-			t.Errorf("bad find (%q): want %t, got %t", tt.key, tt.found, found)
+		c, column, found := findKey(tt.key, tt.context)
+		if tt.found != found || tt.column != column {
+			t.Errorf("bad find (%q): want %t at %d, got %t at %d", tt.key, tt.found, tt.column, found, column)
+		}
+		if tt.line != 0 && tt.line != c.lineNumber {
+			t.Errorf("bad line (%q): want %d, got %d", tt.key, tt.line, c.lineNumber)
 		}
 	}
 }
@@ -244,7 +308,8 @@ func TestFindElem(t *testing.T) {
 	tests := []struct {
 		context context
 
-		found bool
+		found  bool
+		column int
 	}{
 		{},
 		{
@@ -254,16 +319,18 @@ func TestFindElem(t *testing.T) {
 		{
 			context: NewContext([]byte("test:\n  - a\n  -b")),
 			found:   true,
+			column:  5,
 		},
 		{
 			context: NewContext([]byte("test:\n  -\n    a")),
 			found:   true,
+			column:  3,
 		},
 	}
 
 	for _, tt := range tests {
-		if _, found := findElem(tt.context); tt.found != found {
-			t.Errorf("bad find (%q): want %t, got %t", tt.context, tt.found, found)
+		if _, column, found := findElem(tt.context); tt.found != found || tt.column != column {
+			t.Errorf("bad find (%+v): want %t at %d, got %t at %d", tt.context, tt.found, tt.column, found, column)
 		}
 	}
 }
@@ -271,12 +338,15 @@ func TestFindElem(t *testing.T) {
 func nodesEqual(a, b node) bool {
 	if a.name != b.name ||
 		a.line != b.line ||
+		a.column != b.column ||
+		a.literal != b.literal ||
 		!reflect.DeepEqual(a.field, b.field) ||
 		len(a.children) != len(b.children) {
 		return false
 	}
-	for i := 0; i < len(a.children); i++ {
-		if !nodesEqual(a.children[i], b.children[i]) {
+	// The children of maps are in no particular order.
+	for _, ca := range a.children {
+		if !nodesEqual(ca, b.Child(ca.name)) {
 			return false
 		}
 	}
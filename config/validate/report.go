@@ -25,18 +25,18 @@ type Report struct {
 }
 
 // Error adds an error entry to the report.
-func (r *Report) Error(line int, message string) {
-	r.entries = append(r.entries, Entry{entryError, message, line})
+func (r *Report) Error(line, column int, message string) {
+	r.entries = append(r.entries, Entry{entryError, message, line, column, ""})
 }
 
 // Warning adds a warning entry to the report.
-func (r *Report) Warning(line int, message string) {
-	r.entries = append(r.entries, Entry{entryWarning, message, line})
+func (r *Report) Warning(line, column int, message string) {
+	r.entries = append(r.entries, Entry{entryWarning, message, line, column, ""})
 }
 
 // Info adds an info entry to the report.
-func (r *Report) Info(line int, message string) {
-	r.entries = append(r.entries, Entry{entryInfo, message, line})
+func (r *Report) Info(line, column int, message string) {
+	r.entries = append(r.entries, Entry{entryInfo, message, line, column, ""})
 }
 
 // Entries returns the list of entries in the report.
@@ -44,11 +44,38 @@ func (r *Report) Entries() []Entry {
 	return r.entries
 }
 
-// Entry represents a single generic item in the report.
+// Fails returns whether the report has an entry at least as severe as
+// failOn, which is one of "error", "warning" or "info". Any other value fails
+// on every entry.
+func (r *Report) Fails(failOn string) bool {
+	threshold, err := parseEntryKind(failOn)
+	if err != nil {
+		threshold = entryInfo
+	}
+	for _, e := range r.entries {
+		if e.kind <= threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// attribute sets the rule of the entries from the given index on to id.
+func (r *Report) attribute(from int, id string) {
+	for i := from; i < len(r.entries); i++ {
+		r.entries[i].rule = id
+	}
+}
+
+// Entry represents a single generic item in the report. Lines and columns
+// are counted from 1; the column is 0 if it isn't known. The rule is the ID
+// of the check which reported the entry.
 type Entry struct {
 	kind    entryKind
 	message string
 	line    int
+	column  int
+	rule    string
 }
 
 // String returns a human-readable representation of the entry.
@@ -59,11 +86,41 @@ func (e Entry) String() string {
 // MarshalJSON satisfies the json.Marshaler interface, returning the entry
 // encoded as a JSON object.
 func (e Entry) MarshalJSON() ([]byte, error) {
-	return json.Marshal(map[string]interface{}{
+	v := map[string]interface{}{
 		"kind":    e.kind.String(),
 		"message": e.message,
 		"line":    e.line,
-	})
+		"column":  e.column,
+	}
+	if e.rule != "" {
+		v["rule"] = e.rule
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface, decoding an entry
+// encoded by MarshalJSON.
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Kind    string `json:"kind"`
+		Message string `json:"message"`
+		Line    int    `json:"line"`
+		Column  int    `json:"column"`
+		Rule    string `json:"rule"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	kind, err := parseEntryKind(v.Kind)
+	if err != nil {
+		return err
+	}
+	e.kind = kind
+	e.message = v.Message
+	e.line = v.Line
+	e.column = v.Column
+	e.rule = v.Rule
+	return nil
 }
 
 type entryKind int
@@ -86,3 +143,16 @@ func (k entryKind) String() string {
 		panic(fmt.Sprintf("invalid kind %d", k))
 	}
 }
+
+func parseEntryKind(s string) (entryKind, error) {
+	switch s {
+	case "error":
+		return entryError, nil
+	case "warning":
+		return entryWarning, nil
+	case "info":
+		return entryInfo, nil
+	default:
+		return 0, fmt.Errorf("invalid kind %q", s)
+	}
+}
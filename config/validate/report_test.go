@@ -28,19 +28,24 @@ func TestEntry(t *testing.T) {
 		json []byte
 	}{
 		{
-			Entry{entryInfo, "test info", 1},
+			Entry{entryInfo, "test info", 1, 0, ""},
 			"line 1: info: test info",
-			[]byte(`{"kind":"info","line":1,"message":"test info"}`),
+			[]byte(`{"column":0,"kind":"info","line":1,"message":"test info"}`),
 		},
 		{
-			Entry{entryWarning, "test warning", 1},
+			Entry{entryWarning, "test warning", 1, 5, ""},
 			"line 1: warning: test warning",
-			[]byte(`{"kind":"warning","line":1,"message":"test warning"}`),
+			[]byte(`{"column":5,"kind":"warning","line":1,"message":"test warning"}`),
 		},
 		{
-			Entry{entryError, "test error", 2},
+			Entry{entryError, "test error", 2, 3, ""},
 			"line 2: error: test error",
-			[]byte(`{"kind":"error","line":2,"message":"test error"}`),
+			[]byte(`{"column":3,"kind":"error","line":2,"message":"test error"}`),
+		},
+		{
+			Entry{entryError, "test rule", 4, 1, "structure"},
+			"line 4: error: test rule",
+			[]byte(`{"column":1,"kind":"error","line":4,"message":"test rule","rule":"structure"}`),
 		},
 	}
 
@@ -55,13 +60,21 @@ func TestEntry(t *testing.T) {
 		if !bytes.Equal(tt.json, json) {
 			t.Errorf("bad JSON (%q): want %q, got %q", tt.entry, tt.json, json)
 		}
+		var entry Entry
+		if err := entry.UnmarshalJSON(json); err != nil {
+			t.Errorf("bad error decoding (%q): want %v, got %q", tt.entry, nil, err)
+		}
+		if entry != tt.entry {
+			t.Errorf("bad decoded entry: want %q, got %q", tt.entry, entry)
+		}
 	}
 }
 
 func TestReport(t *testing.T) {
 	type reportFunc struct {
-		fn      func(*Report, int, string)
+		fn      func(*Report, int, int, string)
 		line    int
+		column  int
 		message string
 	}
 
@@ -72,14 +85,14 @@ func TestReport(t *testing.T) {
 	}{
 		{
 			[]reportFunc{
-				{(*Report).Warning, 1, "test warning 1"},
-				{(*Report).Error, 2, "test error 2"},
-				{(*Report).Info, 10, "test info 10"},
+				{(*Report).Warning, 1, 1, "test warning 1"},
+				{(*Report).Error, 2, 3, "test error 2"},
+				{(*Report).Info, 10, 0, "test info 10"},
 			},
 			[]Entry{
-				Entry{entryWarning, "test warning 1", 1},
-				Entry{entryError, "test error 2", 2},
-				Entry{entryInfo, "test info 10", 10},
+				Entry{entryWarning, "test warning 1", 1, 1, ""},
+				Entry{entryError, "test error 2", 2, 3, ""},
+				Entry{entryInfo, "test info 10", 10, 0, ""},
 			},
 		},
 	}
@@ -87,10 +100,37 @@ func TestReport(t *testing.T) {
 	for _, tt := range tests {
 		r := Report{}
 		for _, f := range tt.fs {
-			f.fn(&r, f.line, f.message)
+			f.fn(&r, f.line, f.column, f.message)
 		}
 		if es := r.Entries(); !reflect.DeepEqual(tt.es, es) {
 			t.Errorf("bad entries (%v): want %#v, got %#v", tt.fs, tt.es, es)
 		}
 	}
 }
+
+func TestReportFails(t *testing.T) {
+	report := Report{entries: []Entry{
+		{entryInfo, "test info", 1, 0, ""},
+		{entryWarning, "test warning", 2, 0, ""},
+	}}
+
+	tests := []struct {
+		report Report
+		failOn string
+
+		fails bool
+	}{
+		{Report{}, "info", false},
+		{report, "error", false},
+		{report, "warning", true},
+		{report, "info", true},
+		{Report{entries: report.entries[:1]}, "warning", false},
+		{Report{entries: report.entries[:1]}, "bad", true},
+	}
+
+	for _, tt := range tests {
+		if fails := tt.report.Fails(tt.failOn); tt.fails != fails {
+			t.Errorf("bad result (%v, %q): want %t, got %t", tt.report, tt.failOn, tt.fails, fails)
+		}
+	}
+}
@@ -24,16 +24,38 @@ import (
 	"github.com/coreos/coreos-cloudinit/config"
 )
 
-type rule func(config node, report *Report)
+// rule is a check run against each cloud-config. The id identifies the
+// entries reported by the check and doesn't change between releases.
+type rule struct {
+	id          string
+	description string
+	check       func(config node, report *Report)
+}
 
 // Rules contains all of the validation rules.
 var Rules []rule = []rule{
-	checkDiscoveryUrl,
-	checkEncoding,
-	checkStructure,
-	checkValidity,
-	checkWriteFiles,
-	checkWriteFilesUnderCoreos,
+	{"discovery-url", "The etcd discovery URL is a valid URL", checkDiscoveryUrl},
+	{"encoding", "The content of each file can be decoded with its encoding", checkEncoding},
+	{"structure", "Every key is known and its value has the expected type", checkStructure},
+	{"unit-contents", "The sections and directives of each unit are known for its type", checkUnitContents},
+	{"unit-names", "Each unit and drop-in has a valid and unique name", checkUnitNames},
+	{"validity", "Every value is one of those accepted for its key", checkValidity},
+	{"read-only-path", "No file is written to a read-only filesystem", checkWriteFiles},
+	{"write-files-under-coreos", "write_files is not nested under coreos", checkWriteFilesUnderCoreos},
+}
+
+// The IDs of the entries reported while reading the user-data, before any
+// of the Rules are run.
+const (
+	userDataRule = "user-data"
+	yamlRule     = "yaml"
+)
+
+// documentRules describes the entries reported while reading the
+// user-data.
+var documentRules = []rule{
+	{userDataRule, "The user-data can be decoded and is of a known kind", nil},
+	{yamlRule, "The cloud-config is valid YAML", nil},
 }
 
 // checkDiscoveryUrl verifies that the string is a valid url.
@@ -44,7 +66,7 @@ func checkDiscoveryUrl(cfg node, report *Report) {
 	}
 
 	if _, err := url.ParseRequestURI(c.String()); err != nil {
-		report.Warning(c.line, "discovery URL is not valid")
+		report.Warning(c.line, c.column, "discovery URL is not valid")
 	}
 }
 
@@ -59,7 +81,7 @@ func checkEncoding(cfg node, report *Report) {
 
 		c := f.Child("contents")
 		if _, err := config.DecodeContent(c.String(), e.String()); err != nil {
-			report.Error(c.line, fmt.Sprintf("contents cannot be decoded as %q", e.String()))
+			report.Error(c.line, c.column, fmt.Sprintf("contents cannot be decoded as %q", e.String()))
 		}
 	}
 }
@@ -74,7 +96,7 @@ func checkStructure(cfg node, report *Report) {
 
 func checkNodeStructure(n, g node, r *Report) {
 	if !isCompatible(n.Kind(), g.Kind()) {
-		r.Warning(n.line, fmt.Sprintf("incorrect type for %q (want %s)", n.name, g.HumanType()))
+		r.Warning(n.line, n.column, fmt.Sprintf("incorrect type for %q (want %s)", n.name, g.HumanType()))
 		return
 	}
 
@@ -84,7 +106,7 @@ func checkNodeStructure(n, g node, r *Report) {
 			if cg := g.Child(cn.name); cg.IsValid() {
 				checkNodeStructure(cn, cg, r)
 			} else {
-				r.Warning(cn.line, fmt.Sprintf("unrecognized key %q", cn.name))
+				r.Warning(cn.line, cn.column, unrecognizedKey(cn.name, g))
 			}
 		}
 	case reflect.Slice:
@@ -118,6 +140,172 @@ func isCompatible(n, g reflect.Kind) bool {
 	}
 }
 
+// unrecognizedKey returns the message for the unrecognized key name of the
+// structure g, suggesting the key it is closest to, if any.
+func unrecognizedKey(name string, g node) string {
+	if s := suggestKey(name, g); s != "" {
+		return fmt.Sprintf("unrecognized key %q (did you mean %q?)", name, s)
+	}
+	return fmt.Sprintf("unrecognized key %q", name)
+}
+
+// suggestKey returns the key of the structure g which is closest to name, by
+// edit distance, as long as it differs in at most a third of the characters
+// of name (and at least one). It returns an empty string otherwise.
+func suggestKey(name string, g node) string {
+	best, bestDistance := "", len(name)/3
+	if bestDistance < 1 {
+		bestDistance = 1
+	}
+	for _, c := range g.children {
+		if d := editDistance(name, c.name); d <= bestDistance && (best == "" || d < bestDistance) {
+			best, bestDistance = c.name, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// checkUnitContents parses the contents of each unit and its drop-ins, and
+// checks their sections and directives against those known for the type of
+// the unit. Units with contents must have the section specific to their type,
+// and enabled units must have an [Install] section.
+func checkUnitContents(cfg node, report *Report) {
+	for _, u := range cfg.Child("coreos").Child("units").children {
+		n := u.Child("name")
+		if !isString(n) {
+			continue
+		}
+		known, ok := unitSections[unitType(n.String())]
+		if !ok {
+			continue
+		}
+
+		found := map[string]bool{}
+		checkUnitContent(u.Child("content"), n.String(), known, found, report)
+		for _, d := range u.Child("drop_ins").children {
+			if dn := d.Child("name"); isString(dn) {
+				checkUnitContent(d.Child("content"), fmt.Sprintf("%s of %s", dn.String(), n.String()), known, found, report)
+			}
+		}
+
+		// Without contents, the unit is assumed to exist already.
+		c := u.Child("content")
+		if !isString(c) || c.String() == "" {
+			continue
+		}
+		if s, ok := requiredSections[unitType(n.String())]; ok && !found[s] {
+			report.Error(c.line, c.column, fmt.Sprintf("%s has no [%s] section", n.String(), s))
+		}
+		if e := u.Child("enable"); e.IsValid() && e.Kind() == reflect.Bool && e.Bool() && !found["Install"] {
+			report.Warning(e.line, e.column, fmt.Sprintf("%s is enabled but has no [Install] section", n.String()))
+		}
+	}
+}
+
+// checkUnitContent checks the contents of the unit or drop-in in the given
+// node, recording each section found in it. Line numbers are only mapped into
+// the contents if they are a literal block scalar, whose lines match those of
+// the document; the lines of folded and quoted scalars don't, so entries for
+// them point at the content key instead.
+func checkUnitContent(c node, name string, known map[string]directives, found map[string]bool, report *Report) {
+	if !isString(c) {
+		return
+	}
+
+	// The column of the lines of a literal block isn't known.
+	position := func(l int) (int, int) {
+		if c.literal {
+			return c.line + l, 0
+		}
+		return c.line, c.column
+	}
+
+	lines, errs := parseUnit(c.String())
+	for _, e := range errs {
+		line, column := position(e.line)
+		report.Error(line, column, fmt.Sprintf("%s in %s", e.message, name))
+	}
+	for _, l := range lines {
+		found[l.section] = true
+		// Sections and directives starting with X- are ignored by
+		// systemd, for use by other programs.
+		if strings.HasPrefix(l.section, "X-") || strings.HasPrefix(l.directive, "X-") {
+			continue
+		}
+		line, column := position(l.line)
+		directives, ok := known[l.section]
+		switch {
+		case !ok && l.directive == "":
+			report.Warning(line, column, fmt.Sprintf("unrecognized section %q in %s", l.section, name))
+		case ok && l.directive != "" && !directives[l.directive]:
+			report.Warning(line, column, fmt.Sprintf("unrecognized directive %q in section [%s] of %s", l.directive, l.section, name))
+		}
+	}
+}
+
+// checkUnitNames checks that the names of the units end with the suffix of a
+// type of unit, that the names of their drop-ins end with .conf, and that no
+// unit is listed more than once.
+func checkUnitNames(cfg node, report *Report) {
+	seen := map[string]bool{}
+	for _, u := range cfg.Child("coreos").Child("units").children {
+		n := u.Child("name")
+		if !isString(n) {
+			continue
+		}
+		if _, ok := unitSections[unitType(n.String())]; !ok {
+			report.Error(n.line, n.column, fmt.Sprintf("invalid unit type for %q", n.String()))
+		}
+		if seen[n.String()] {
+			report.Warning(n.line, n.column, fmt.Sprintf("unit %q is listed more than once", n.String()))
+		}
+		seen[n.String()] = true
+
+		for _, d := range u.Child("drop_ins").children {
+			dn := d.Child("name")
+			if isString(dn) && !strings.HasSuffix(dn.String(), ".conf") {
+				report.Error(dn.line, dn.column, fmt.Sprintf("drop-in %q of %q is ignored because it doesn't end with .conf", dn.String(), n.String()))
+			}
+		}
+	}
+}
+
+// isString returns whether the node holds a string.
+func isString(n node) bool {
+	return n.IsValid() && n.Kind() == reflect.String
+}
+
 // checkValidity checks the value of every node in the provided config by
 // running config.AssertValid() on it.
 func checkValidity(cfg node, report *Report) {
@@ -127,7 +315,7 @@ func checkValidity(cfg node, report *Report) {
 
 func checkNodeValidity(n, g node, r *Report) {
 	if err := config.AssertValid(n.Value, g.field.Tag.Get("valid")); err != nil {
-		r.Error(n.line, fmt.Sprintf("invalid value %v", n.Value.Interface()))
+		r.Error(n.line, n.column, fmt.Sprintf("invalid value %v", n.Value.Interface()))
 	}
 	switch g.Kind() {
 	case reflect.Struct:
@@ -162,7 +350,7 @@ func checkWriteFiles(cfg node, report *Report) {
 		d := path.Dir(c.String())
 		switch {
 		case strings.HasPrefix(d, "/usr"):
-			report.Error(c.line, "file cannot be written to a read-only filesystem")
+			report.Error(c.line, c.column, "file cannot be written to a read-only filesystem")
 		}
 	}
 }
@@ -172,6 +360,6 @@ func checkWriteFiles(cfg node, report *Report) {
 func checkWriteFilesUnderCoreos(cfg node, report *Report) {
 	c := cfg.Child("coreos").Child("write_files")
 	if c.IsValid() {
-		report.Info(c.line, "write_files doesn't belong under coreos")
+		report.Info(c.line, c.column, "write_files doesn't belong under coreos")
 	}
 }
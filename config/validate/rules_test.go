@@ -34,7 +34,7 @@ func TestCheckDiscoveryUrl(t *testing.T) {
 		},
 		{
 			config:  "coreos:\n  etcd:\n    discovery: disco",
-			entries: []Entry{{entryWarning, "discovery URL is not valid", 3}},
+			entries: []Entry{{entryWarning, "discovery URL is not valid", 3, 5, ""}},
 		},
 	}
 
@@ -67,7 +67,7 @@ func TestCheckEncoding(t *testing.T) {
 		},
 		{
 			config:  "write_files:\n  - encoding: base64\n    contents: !!binary aGVsbG8K",
-			entries: []Entry{{entryError, `contents cannot be decoded as "base64"`, 3}},
+			entries: []Entry{{entryError, `contents cannot be decoded as "base64"`, 3, 5, ""}},
 		},
 		{
 			config: "write_files:\n  - encoding: base64\n    contents: !!binary YUdWc2JHOEsK",
@@ -80,7 +80,7 @@ func TestCheckEncoding(t *testing.T) {
 		},
 		{
 			config:  "write_files:\n  - encoding: custom\n    contents: hello",
-			entries: []Entry{{entryError, `contents cannot be decoded as "custom"`, 3}},
+			entries: []Entry{{entryError, `contents cannot be decoded as "custom"`, 3, 5, ""}},
 		},
 	}
 
@@ -109,22 +109,30 @@ func TestCheckStructure(t *testing.T) {
 		// Test for unrecognized keys
 		{
 			config:  "test:",
-			entries: []Entry{{entryWarning, "unrecognized key \"test\"", 1}},
+			entries: []Entry{{entryWarning, "unrecognized key \"test\"", 1, 1, ""}},
 		},
 		{
 			config:  "coreos:\n  etcd:\n    bad:",
-			entries: []Entry{{entryWarning, "unrecognized key \"bad\"", 3}},
+			entries: []Entry{{entryWarning, "unrecognized key \"bad\"", 3, 5, ""}},
 		},
 		{
 			config: "coreos:\n  etcd:\n    discovery: good",
 		},
+		{
+			config:  "ssh_authorised_keys:\n  - foo",
+			entries: []Entry{{entryWarning, "unrecognized key \"ssh_authorised_keys\" (did you mean \"ssh_authorized_keys\"?)", 1, 1, ""}},
+		},
+		{
+			config:  "coreos:\n  units:\n    - name: foo.service\n      comand: start",
+			entries: []Entry{{entryWarning, "unrecognized key \"comand\" (did you mean \"command\"?)", 4, 7, ""}},
+		},
 
 		// Test for error on list of nodes
 		{
 			config: "coreos:\n  units:\n    - hello\n    - goodbye",
 			entries: []Entry{
-				{entryWarning, "incorrect type for \"units[0]\" (want struct)", 3},
-				{entryWarning, "incorrect type for \"units[1]\" (want struct)", 4},
+				{entryWarning, "incorrect type for \"units[0]\" (want struct)", 3, 7, ""},
+				{entryWarning, "incorrect type for \"units[1]\" (want struct)", 4, 7, ""},
 			},
 		},
 
@@ -135,19 +143,19 @@ func TestCheckStructure(t *testing.T) {
 		},
 		{
 			config:  "coreos:\n  units:\n    - enable: 4",
-			entries: []Entry{{entryWarning, "incorrect type for \"enable\" (want bool)", 3}},
+			entries: []Entry{{entryWarning, "incorrect type for \"enable\" (want bool)", 3, 7, ""}},
 		},
 		{
 			config:  "coreos:\n  units:\n    - enable: bad",
-			entries: []Entry{{entryWarning, "incorrect type for \"enable\" (want bool)", 3}},
+			entries: []Entry{{entryWarning, "incorrect type for \"enable\" (want bool)", 3, 7, ""}},
 		},
 		{
 			config:  "coreos:\n  units:\n    - enable:\n        bad:",
-			entries: []Entry{{entryWarning, "incorrect type for \"enable\" (want bool)", 3}},
+			entries: []Entry{{entryWarning, "incorrect type for \"enable\" (want bool)", 3, 7, ""}},
 		},
 		{
 			config:  "coreos:\n  units:\n    - enable:\n      - bad",
-			entries: []Entry{{entryWarning, "incorrect type for \"enable\" (want bool)", 3}},
+			entries: []Entry{{entryWarning, "incorrect type for \"enable\" (want bool)", 3, 7, ""}},
 		},
 		// Want string
 		{
@@ -161,72 +169,72 @@ func TestCheckStructure(t *testing.T) {
 		},
 		{
 			config:  "hostname:\n  name:",
-			entries: []Entry{{entryWarning, "incorrect type for \"hostname\" (want string)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"hostname\" (want string)", 1, 1, ""}},
 		},
 		{
 			config:  "hostname:\n  - name",
-			entries: []Entry{{entryWarning, "incorrect type for \"hostname\" (want string)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"hostname\" (want string)", 1, 1, ""}},
 		},
 		// Want struct
 		{
 			config:  "coreos: true",
-			entries: []Entry{{entryWarning, "incorrect type for \"coreos\" (want struct)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"coreos\" (want struct)", 1, 1, ""}},
 		},
 		{
 			config:  "coreos: 4",
-			entries: []Entry{{entryWarning, "incorrect type for \"coreos\" (want struct)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"coreos\" (want struct)", 1, 1, ""}},
 		},
 		{
 			config:  "coreos: hello",
-			entries: []Entry{{entryWarning, "incorrect type for \"coreos\" (want struct)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"coreos\" (want struct)", 1, 1, ""}},
 		},
 		{
 			config: "coreos:\n  etcd:\n    discovery: fire in the disco",
 		},
 		{
 			config:  "coreos:\n  - hello",
-			entries: []Entry{{entryWarning, "incorrect type for \"coreos\" (want struct)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"coreos\" (want struct)", 1, 1, ""}},
 		},
 		// Want []string
 		{
 			config:  "ssh_authorized_keys: true",
-			entries: []Entry{{entryWarning, "incorrect type for \"ssh_authorized_keys\" (want []string)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"ssh_authorized_keys\" (want []string)", 1, 1, ""}},
 		},
 		{
 			config:  "ssh_authorized_keys: 4",
-			entries: []Entry{{entryWarning, "incorrect type for \"ssh_authorized_keys\" (want []string)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"ssh_authorized_keys\" (want []string)", 1, 1, ""}},
 		},
 		{
 			config:  "ssh_authorized_keys: key",
-			entries: []Entry{{entryWarning, "incorrect type for \"ssh_authorized_keys\" (want []string)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"ssh_authorized_keys\" (want []string)", 1, 1, ""}},
 		},
 		{
 			config:  "ssh_authorized_keys:\n  key: value",
-			entries: []Entry{{entryWarning, "incorrect type for \"ssh_authorized_keys\" (want []string)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"ssh_authorized_keys\" (want []string)", 1, 1, ""}},
 		},
 		{
 			config: "ssh_authorized_keys:\n  - key",
 		},
 		{
 			config:  "ssh_authorized_keys:\n  - key: value",
-			entries: []Entry{{entryWarning, "incorrect type for \"ssh_authorized_keys[0]\" (want string)", 2}},
+			entries: []Entry{{entryWarning, "incorrect type for \"ssh_authorized_keys[0]\" (want string)", 2, 5, ""}},
 		},
 		// Want []struct
 		{
 			config:  "users:\n  true",
-			entries: []Entry{{entryWarning, "incorrect type for \"users\" (want []struct)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"users\" (want []struct)", 1, 1, ""}},
 		},
 		{
 			config:  "users:\n  4",
-			entries: []Entry{{entryWarning, "incorrect type for \"users\" (want []struct)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"users\" (want []struct)", 1, 1, ""}},
 		},
 		{
 			config:  "users:\n  bad",
-			entries: []Entry{{entryWarning, "incorrect type for \"users\" (want []struct)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"users\" (want []struct)", 1, 1, ""}},
 		},
 		{
 			config:  "users:\n  bad:",
-			entries: []Entry{{entryWarning, "incorrect type for \"users\" (want []struct)", 1}},
+			entries: []Entry{{entryWarning, "incorrect type for \"users\" (want []struct)", 1, 1, ""}},
 		},
 		{
 			config: "users:\n  - name: good",
@@ -234,23 +242,23 @@ func TestCheckStructure(t *testing.T) {
 		// Want struct within array
 		{
 			config:  "users:\n  - true",
-			entries: []Entry{{entryWarning, "incorrect type for \"users[0]\" (want struct)", 2}},
+			entries: []Entry{{entryWarning, "incorrect type for \"users[0]\" (want struct)", 2, 5, ""}},
 		},
 		{
 			config:  "users:\n  - name: hi\n  - true",
-			entries: []Entry{{entryWarning, "incorrect type for \"users[1]\" (want struct)", 3}},
+			entries: []Entry{{entryWarning, "incorrect type for \"users[1]\" (want struct)", 3, 5, ""}},
 		},
 		{
 			config:  "users:\n  - 4",
-			entries: []Entry{{entryWarning, "incorrect type for \"users[0]\" (want struct)", 2}},
+			entries: []Entry{{entryWarning, "incorrect type for \"users[0]\" (want struct)", 2, 5, ""}},
 		},
 		{
 			config:  "users:\n  - bad",
-			entries: []Entry{{entryWarning, "incorrect type for \"users[0]\" (want struct)", 2}},
+			entries: []Entry{{entryWarning, "incorrect type for \"users[0]\" (want struct)", 2, 5, ""}},
 		},
 		{
 			config:  "users:\n  - - bad",
-			entries: []Entry{{entryWarning, "incorrect type for \"users[0]\" (want struct)", 2}},
+			entries: []Entry{{entryWarning, "incorrect type for \"users[0]\" (want struct)", 2, 5, ""}},
 		},
 	}
 
@@ -268,6 +276,113 @@ func TestCheckStructure(t *testing.T) {
 	}
 }
 
+func TestCheckUnitContents(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "coreos:\n  units:\n    - name: foo.service\n      enable: true\n      content: |\n        [Unit]\n        Description=Foo\n\n        [Service]\n        ExecStart=/bin/foo \\\n          --bar\n        X-Custom=1\n\n        [X-Fleet]\n        Global=true\n\n        [Install]\n        WantedBy=multi-user.target",
+		},
+		{
+			config: "coreos:\n  units:\n    - name: etcd.service\n      command: start\n      drop_ins:\n        - name: 10-foo.conf\n          content: |\n            [Service]\n            Environment=FOO=bar",
+		},
+		{
+			config: "coreos:\n  units:\n    - name: foo.service\n      content: |\n        [Service]\n        ExecStrat=/bin/foo\n        [Servce]\n        Type=oneshot",
+			entries: []Entry{
+				{entryWarning, `unrecognized directive "ExecStrat" in section [Service] of foo.service`, 6, 0, ""},
+				{entryWarning, `unrecognized section "Servce" in foo.service`, 7, 0, ""},
+			},
+		},
+		{
+			config: "coreos:\n  units:\n    - name: foo.service\n      enable: true\n      content: |\n        [Unit]\n        Description=Foo\n        ExecStart=/bin/foo",
+			entries: []Entry{
+				{entryWarning, `unrecognized directive "ExecStart" in section [Unit] of foo.service`, 8, 0, ""},
+				{entryError, "foo.service has no [Service] section", 5, 7, ""},
+				{entryWarning, "foo.service is enabled but has no [Install] section", 4, 7, ""},
+			},
+		},
+		{
+			config: "coreos:\n  units:\n    - name: foo.service\n      enable: true\n      content: |\n        [Service]\n        ExecStart=/bin/foo\n      drop_ins:\n        - name: 10-install.conf\n          content: |\n            [Install]\n            WantedBy=multi-user.target",
+		},
+		{
+			config: "coreos:\n  units:\n    - name: foo.service\n      content: \"Description=Foo\\n[Service\\nExecStart=/bin/foo\\n\"",
+			entries: []Entry{
+				{entryError, `directive "Description=Foo" outside of a section in foo.service`, 4, 7, ""},
+				{entryError, `invalid section header "[Service" in foo.service`, 4, 7, ""},
+				{entryError, "foo.service has no [Service] section", 4, 7, ""},
+			},
+		},
+		{
+			config: "coreos:\n  units:\n    - name: 50-eth0.network\n      content: |\n        [Match]\n        Name=eth0\n\n        [Network]\n        Adress=10.0.0.1/24\n\n        [Install]\n        WantedBy=multi-user.target",
+			entries: []Entry{
+				{entryWarning, `unrecognized directive "Adress" in section [Network] of 50-eth0.network`, 9, 0, ""},
+				{entryWarning, `unrecognized section "Install" in 50-eth0.network`, 11, 0, ""},
+			},
+		},
+		{
+			config:  "coreos:\n  units:\n    - name: foo.service\n      drop_ins:\n        - name: 10-foo.conf\n          content: |\n            [Service]\n            foo",
+			entries: []Entry{{entryError, `invalid line "foo" in 10-foo.conf of foo.service`, 8, 0, ""}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkUnitContents(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckUnitNames(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "coreos:\n  units:\n    - name: foo.service\n    - name: foo@bar.socket\n    - name: 50-eth0.network\n      drop_ins:\n        - name: 10-foo.conf",
+		},
+		{
+			config: "coreos:\n  units:\n    - name: foo\n    - name: foo.servce",
+			entries: []Entry{
+				{entryError, `invalid unit type for "foo"`, 3, 7, ""},
+				{entryError, `invalid unit type for "foo.servce"`, 4, 7, ""},
+			},
+		},
+		{
+			config:  "coreos:\n  units:\n    - name: foo.service\n    - name: bar.service\n    - name: foo.service",
+			entries: []Entry{{entryWarning, `unit "foo.service" is listed more than once`, 5, 7, ""}},
+		},
+		{
+			config:  "coreos:\n  units:\n    - name: foo.service\n      drop-ins:\n        - name: 10-foo",
+			entries: []Entry{{entryError, `drop-in "10-foo" of "foo.service" is ignored because it doesn't end with .conf`, 5, 11, ""}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkUnitNames(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
 func TestCheckValidity(t *testing.T) {
 	tests := []struct {
 		config string
@@ -295,7 +410,7 @@ func TestCheckValidity(t *testing.T) {
 		},
 		{
 			config:  "coreos:\n  units:\n    - command: lol",
-			entries: []Entry{{entryError, "invalid value lol", 3}},
+			entries: []Entry{{entryError, "invalid value lol", 3, 7, ""}},
 		},
 
 		// struct
@@ -304,7 +419,7 @@ func TestCheckValidity(t *testing.T) {
 		},
 		{
 			config:  "coreos:\n  update:\n    reboot_strategy: always",
-			entries: []Entry{{entryError, "invalid value always", 3}},
+			entries: []Entry{{entryError, "invalid value always", 3, 5, ""}},
 		},
 
 		// unknown
@@ -342,11 +457,11 @@ func TestCheckWriteFiles(t *testing.T) {
 		},
 		{
 			config:  "write_files:\n  - path: /usr/invalid",
-			entries: []Entry{{entryError, "file cannot be written to a read-only filesystem", 2}},
+			entries: []Entry{{entryError, "file cannot be written to a read-only filesystem", 2, 5, ""}},
 		},
 		{
 			config:  "write-files:\n  - path: /tmp/../usr/invalid",
-			entries: []Entry{{entryError, "file cannot be written to a read-only filesystem", 2}},
+			entries: []Entry{{entryError, "file cannot be written to a read-only filesystem", 2, 5, ""}},
 		},
 	}
 
@@ -376,11 +491,11 @@ func TestCheckWriteFilesUnderCoreos(t *testing.T) {
 		},
 		{
 			config:  "coreos:\n  write_files:\n    - path: /hi",
-			entries: []Entry{{entryInfo, "write_files doesn't belong under coreos", 2}},
+			entries: []Entry{{entryInfo, "write_files doesn't belong under coreos", 2, 3, ""}},
 		},
 		{
 			config:  "coreos:\n  write-files:\n    - path: /hyphen",
-			entries: []Entry{{entryInfo, "write_files doesn't belong under coreos", 2}},
+			entries: []Entry{{entryInfo, "write_files doesn't belong under coreos", 2, 3, ""}},
 		},
 	}
 
@@ -0,0 +1,169 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// SchemaURI identifies the version of JSON Schema generated by NewSchema.
+const SchemaURI = "http://json-schema.org/draft-04/schema#"
+
+var (
+	// enumPattern matches the 'valid' tags which only list literal values,
+	// such as "^(start|stop)$".
+	enumPattern = regexp.MustCompile(`^\^\(((?:[^()|\\.*+?{}\[\]^$]|\\.)+(?:\|(?:[^()|\\.*+?{}\[\]^$]|\\.)+)*)\)\$$`)
+	escaped     = regexp.MustCompile(`\\(.)`)
+)
+
+// descriptions holds the descriptions of the cloud-config keys, by their
+// dotted path. Keys which set an environment variable are described by it
+// instead.
+var descriptions = map[string]string{
+	"":                                     "The cloud-config of a CoreOS machine",
+	"ssh_authorized_keys":                  "Public SSH keys to authorize for the core user",
+	"coreos":                               "CoreOS-specific configuration",
+	"coreos.etcd":                          "Configuration of etcd, written to a drop-in for etcd.service",
+	"coreos.flannel":                       "Configuration of flannel, written to a drop-in for flanneld.service",
+	"coreos.fleet":                         "Configuration of fleet, written to a drop-in for fleet.service",
+	"coreos.locksmith":                     "Configuration of locksmith, written to a drop-in for locksmithd.service",
+	"coreos.oem":                           "Identity of the OEM, written to /etc/oem-release",
+	"coreos.oem.id":                        "Identifier of the OEM",
+	"coreos.oem.name":                      "Name of the OEM",
+	"coreos.oem.version_id":                "Version of the OEM",
+	"coreos.oem.home_url":                  "Home page of the OEM",
+	"coreos.oem.bug_report_url":            "Where to report bugs in the OEM",
+	"coreos.update":                        "Configuration of updates, written to /etc/coreos/update.conf",
+	"coreos.units":                         "systemd units to write, enable, mask or run commands on",
+	"coreos.units.name":                    "Name of the unit, including its suffix",
+	"coreos.units.mask":                    "Whether to mask the unit by symlinking it to /dev/null",
+	"coreos.units.enable":                  "Whether to handle the [Install] section of the unit",
+	"coreos.units.runtime":                 "Whether to write the unit to /run rather than /etc, so it doesn't persist across reboots",
+	"coreos.units.content":                 "Contents of the unit file; if empty, the unit is assumed to exist already",
+	"coreos.units.command":                 "Command to run on the unit",
+	"coreos.units.wait":                    "Whether to wait for the job of the command to complete (the default) or only queue it",
+	"coreos.units.drop_ins":                "Drop-ins to write for the unit",
+	"coreos.units.drop_ins.name":           "Name of the drop-in, ending with .conf",
+	"coreos.units.drop_ins.content":        "Contents of the drop-in",
+	"write_files":                          "Files to write",
+	"write_files.encoding":                 "Encoding of the content",
+	"write_files.content":                  "Data to write to the file",
+	"write_files.owner":                    "User and group which should own the file, as <user>:<group>",
+	"write_files.path":                     "Absolute path of the file",
+	"write_files.permissions":              "Permissions of the file, in octal",
+	"hostname":                             "Hostname of the machine",
+	"users":                                "Users to create",
+	"users.name":                           "Login name of the user",
+	"users.passwd":                         "Hash of the password of the user",
+	"users.ssh_authorized_keys":            "Public SSH keys to authorize for the user",
+	"users.coreos_ssh_import_github":       "GitHub user whose SSH keys to authorize for the user",
+	"users.coreos_ssh_import_github_users": "GitHub users whose SSH keys to authorize for the user",
+	"users.coreos_ssh_import_url":          "URL from which to import SSH keys to authorize for the user",
+	"users.gecos":                          "GECOS comment of the user",
+	"users.homedir":                        "Home directory of the user, by default /home/<name>",
+	"users.no_create_home":                 "Whether to skip creating the home directory",
+	"users.primary_group":                  "Primary group of the user, by default a new group named after the user",
+	"users.groups":                         "Additional groups of the user",
+	"users.no_user_group":                  "Whether to skip creating a group named after the user",
+	"users.system":                         "Whether to create a system user, without a home directory",
+	"users.no_log_init":                    "Whether to skip initializing the lastlog and faillog databases for the user",
+	"manage_etc_hosts":                     "Set to \"localhost\" to generate /etc/hosts resolving the hostname to 127.0.0.1",
+	"frequency":                            "How often to apply each section of the cloud-config",
+	"frequency.hostname":                   "How often to set the hostname",
+	"frequency.users":                      "How often to create the users",
+	"frequency.ssh_authorized_keys":        "How often to authorize the SSH keys of the core user",
+	"frequency.write_files":                "How often to write the files",
+	"frequency.units":                      "How often to process the units",
+	"frequency.scripts":                    "How often to run the scripts",
+}
+
+// Schema is a JSON Schema describing (part of) a cloud-config.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 interface{}        `json:"type"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+// NewSchema generates the JSON Schema of a cloud-config from the
+// config.CloudConfig structure, the same way the structure of a cloud-config
+// is validated: keys are the YAML tags of the fields, and the values of the
+// fields with a 'valid' tag are restricted to the values it lists or to the
+// pattern it contains. Like the validator, which only warns about them,
+// the schema does not allow unknown keys, and it allows numbers and booleans
+// where strings are expected.
+func NewSchema() *Schema {
+	s := newSchema(reflect.TypeOf(config.CloudConfig{}), "", reflect.StructField{})
+	s.Schema = SchemaURI
+	return s
+}
+
+func newSchema(t reflect.Type, path string, field reflect.StructField) *Schema {
+	s := &Schema{Description: descriptions[path]}
+	if env := field.Tag.Get("env"); env != "" && s.Description == "" {
+		s.Description = fmt.Sprintf("Sets %s in the environment of the service", env)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		no := false
+		s.Type = "object"
+		s.AdditionalProperties = &no
+		s.Properties = map[string]*Schema{}
+		for i := 0; i < t.NumField(); i++ {
+			ft := t.Field(i)
+			k := ft.Tag.Get("yaml")
+			if k == "-" || k == "" {
+				continue
+			}
+			s.Properties[k] = newSchema(ft.Type, strings.TrimPrefix(path+"."+k, "."), ft)
+		}
+	case reflect.Slice:
+		s.Type = "array"
+		s.Items = newSchema(t.Elem(), path, reflect.StructField{})
+		s.Items.Description = ""
+	case reflect.String:
+		s.Type = []string{"string", "number", "boolean"}
+		if valid := field.Tag.Get("valid"); valid != "" {
+			if m := enumPattern.FindStringSubmatch(valid); m != nil {
+				for _, v := range strings.Split(m[1], "|") {
+					s.Enum = append(s.Enum, escaped.ReplaceAllString(v, "$1"))
+				}
+			} else {
+				s.Pattern = valid
+			}
+		}
+	case reflect.Int:
+		s.Type = "integer"
+	case reflect.Float64:
+		s.Type = "number"
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.Ptr:
+		return newSchema(t.Elem(), path, field)
+	default:
+		panic(fmt.Sprintf("newSchema(): unhandled kind %s", t.Kind()))
+	}
+	return s
+}
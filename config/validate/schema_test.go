@@ -0,0 +1,74 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewSchema(t *testing.T) {
+	s := NewSchema()
+	if s.Schema != SchemaURI || s.Type != "object" || s.AdditionalProperties == nil || *s.AdditionalProperties {
+		t.Fatalf("bad root schema: %+v", s)
+	}
+
+	units := s.Properties["coreos"].Properties["units"]
+	if units.Type != "array" || units.Items.Type != "object" {
+		t.Fatalf("bad units schema: %+v", units)
+	}
+	if command := units.Items.Properties["command"]; !reflect.DeepEqual(command.Enum, []string{"start", "stop", "restart", "reload", "try-restart", "reload-or-restart", "reload-or-try-restart"}) {
+		t.Errorf("bad enum for command: %v", command.Enum)
+	}
+	if wait := units.Items.Properties["wait"]; wait.Type != "boolean" || wait.Description == "" {
+		t.Errorf("bad schema for wait: %+v", wait)
+	}
+
+	files := s.Properties["write_files"].Items
+	if encoding := files.Properties["encoding"]; !reflect.DeepEqual(encoding.Enum, []string{"base64", "b64", "gz", "gzip", "gz+base64", "gzip+base64", "gz+b64", "gzip+b64"}) {
+		t.Errorf("bad enum for encoding: %v", encoding.Enum)
+	}
+	if permissions := files.Properties["permissions"]; permissions.Enum != nil || permissions.Pattern != `^0?[0-7]{3,4}$` {
+		t.Errorf("bad schema for permissions: %+v", permissions)
+	}
+
+	etcd := s.Properties["coreos"].Properties["etcd"]
+	if size := etcd.Properties["cluster_active_size"]; size.Type != "integer" || size.Description != "Sets ETCD_CLUSTER_ACTIVE_SIZE in the environment of the service" {
+		t.Errorf("bad schema for cluster_active_size: %+v", size)
+	}
+	if keys := s.Properties["ssh_authorized_keys"]; keys.Items.Description != "" || !reflect.DeepEqual(keys.Items.Type, []string{"string", "number", "boolean"}) {
+		t.Errorf("bad schema for ssh_authorized_keys items: %+v", keys.Items)
+	}
+}
+
+func TestSchemaDescriptions(t *testing.T) {
+	s := NewSchema()
+	for path := range descriptions {
+		if path == "" {
+			continue
+		}
+		c := s
+		for _, k := range strings.Split(path, ".") {
+			if c.Items != nil {
+				c = c.Items
+			}
+			if c = c.Properties[k]; c == nil {
+				t.Errorf("description of unknown key %q", path)
+				break
+			}
+		}
+	}
+}
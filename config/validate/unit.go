@@ -0,0 +1,245 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// unitSections maps each type of unit, by the suffix of its name, to the
+// sections and directives its contents may have. The directives are taken
+// from the man pages of systemd 235 (systemd.unit(5), systemd.service(5),
+// systemd.exec(5) and so on), which is newer than the systemd of older CoreOS
+// releases, so that units written for newer machines aren't flagged; the
+// directives a release doesn't know are still ignored by its systemd.
+var unitSections = map[string]map[string]directives{
+	"service": {
+		"Unit":    unitDirectives,
+		"Install": installDirectives,
+		"Service": newDirectives(serviceDirectives, execDirectives, killDirectives, resourceControlDirectives),
+	},
+	"socket": {
+		"Unit":    unitDirectives,
+		"Install": installDirectives,
+		"Socket":  newDirectives(socketDirectives, execDirectives, killDirectives, resourceControlDirectives),
+	},
+	"device": {
+		"Unit":    unitDirectives,
+		"Install": installDirectives,
+	},
+	"mount": {
+		"Unit":    unitDirectives,
+		"Install": installDirectives,
+		"Mount":   newDirectives(mountDirectives, execDirectives, killDirectives, resourceControlDirectives),
+	},
+	"automount": {
+		"Unit":      unitDirectives,
+		"Install":   installDirectives,
+		"Automount": newDirectives([]string{"Where", "DirectoryMode", "TimeoutIdleSec"}),
+	},
+	"swap": {
+		"Unit":    unitDirectives,
+		"Install": installDirectives,
+		"Swap":    newDirectives([]string{"What", "Priority", "Options", "TimeoutSec"}, execDirectives, killDirectives, resourceControlDirectives),
+	},
+	"target": {
+		"Unit":    unitDirectives,
+		"Install": installDirectives,
+	},
+	"path": {
+		"Unit":    unitDirectives,
+		"Install": installDirectives,
+		"Path":    newDirectives([]string{"PathExists", "PathExistsGlob", "PathChanged", "PathModified", "DirectoryNotEmpty", "Unit", "MakeDirectory", "DirectoryMode"}),
+	},
+	"timer": {
+		"Unit":    unitDirectives,
+		"Install": installDirectives,
+		"Timer":   newDirectives([]string{"OnActiveSec", "OnBootSec", "OnStartupSec", "OnUnitActiveSec", "OnUnitInactiveSec", "OnCalendar", "AccuracySec", "RandomizedDelaySec", "Unit", "Persistent", "WakeSystem", "RemainAfterElapse"}),
+	},
+	"slice": {
+		"Unit":    unitDirectives,
+		"Install": installDirectives,
+		"Slice":   newDirectives(resourceControlDirectives),
+	},
+	"network": {
+		"Match":        newDirectives([]string{"MACAddress", "Path", "Driver", "Type", "Name", "Host", "Virtualization", "KernelCommandLine", "Architecture"}),
+		"Link":         newDirectives([]string{"MACAddress", "MTUBytes", "ARP", "Unmanaged"}),
+		"Network":      newDirectives(networkDirectives),
+		"Address":      newDirectives([]string{"Address", "Peer", "Broadcast", "Label", "PreferredLifetime", "Scope", "HomeAddress", "DuplicateAddressDetection", "ManageTemporaryAddress", "PrefixRoute", "AutoJoin"}),
+		"Route":        newDirectives([]string{"Gateway", "GatewayOnlink", "Destination", "Source", "Metric", "Scope", "PreferredSource", "Table", "IPv6Preference", "Protocol", "Type", "InitialCongestionWindow", "InitialAdvertisedReceiveWindow", "QuickAck", "MTUBytes"}),
+		"DHCP":         newDirectives([]string{"UseDNS", "UseNTP", "UseMTU", "SendHostname", "UseHostname", "Hostname", "UseDomains", "UseDomainName", "UseRoutes", "UseTimezone", "CriticalConnection", "ClientIdentifier", "VendorClassIdentifier", "DUIDType", "DUIDRawData", "IAID", "RequestBroadcast", "RouteMetric", "RouteTable", "ListenPort"}),
+		"DHCPServer":   newDirectives([]string{"PoolOffset", "PoolSize", "DefaultLeaseTimeSec", "MaxLeaseTimeSec", "EmitDNS", "DNS", "EmitNTP", "NTP", "EmitRouter", "EmitTimezone", "Timezone"}),
+		"IPv6AcceptRA": newDirectives([]string{"UseDNS", "UseDomains", "RouteTable"}),
+		"Bridge":       newDirectives([]string{"UnicastFlood", "MulticastFlood", "HairPin", "UseBPDU", "FastLeave", "AllowPortToBeRoot", "Cost", "Priority"}),
+		"BridgeFDB":    newDirectives([]string{"MACAddress", "VLANId"}),
+		"BridgeVLAN":   newDirectives([]string{"VLAN", "EgressUntagged", "PVID"}),
+	},
+	"netdev": {
+		"Match":   newDirectives([]string{"Host", "Virtualization", "KernelCommandLine", "Architecture"}),
+		"NetDev":  newDirectives([]string{"Description", "Name", "Kind", "MTUBytes", "MACAddress"}),
+		"VLAN":    newDirectives([]string{"Id", "GVRP", "MVRP", "LooseBinding", "ReorderHeader"}),
+		"MACVLAN": newDirectives([]string{"Mode"}),
+		"MACVTAP": newDirectives([]string{"Mode"}),
+		"IPVLAN":  newDirectives([]string{"Mode", "Flags"}),
+		"VXLAN":   newDirectives([]string{"Id", "Group", "Remote", "Local", "TOS", "TTL", "MacLearning", "FDBAgeingSec", "MaximumFDBEntries", "ARPProxy", "L2MissNotification", "L3MissNotification", "RouteShortCircuit", "UDPChecksum", "UDP6ZeroChecksumTx", "UDP6ZeroChecksumRx", "RemoteChecksumTx", "RemoteChecksumRx", "GroupPolicyExtension", "DestinationPort", "PortRange"}),
+		"Tunnel":  newDirectives([]string{"Local", "Remote", "TOS", "TTL", "DiscoverPathMTU", "IPv6FlowLabel", "CopyDSCP", "EncapsulationLimit", "Key", "InputKey", "OutputKey", "Mode", "Independent"}),
+		"Peer":    newDirectives([]string{"Name", "MACAddress"}),
+		"Tun":     newDirectives([]string{"OneQueue", "MultiQueue", "PacketInfo", "VNetHeader", "User", "Group"}),
+		"Tap":     newDirectives([]string{"OneQueue", "MultiQueue", "PacketInfo", "VNetHeader", "User", "Group"}),
+		"Bond":    newDirectives([]string{"Mode", "TransmitHashPolicy", "LACPTransmitRate", "MIIMonitorSec", "UpDelaySec", "DownDelaySec", "LearnPacketIntervalSec", "AdSelect", "FailOverMACPolicy", "ARPValidate", "ARPIntervalSec", "ARPIPTargets", "ARPAllTargets", "PrimaryReselectPolicy", "ResendIGMP", "PacketsPerSlave", "GratuitousARP", "AllSlavesActive", "MinLinks"}),
+		"Bridge":  newDirectives([]string{"HelloTimeSec", "MaxAgeSec", "ForwardDelaySec", "AgeingTimeSec", "Priority", "GroupForwardMask", "DefaultPVID", "MulticastQuerier", "MulticastSnooping", "VLANFiltering", "STP"}),
+		"VRF":     newDirectives([]string{"Table", "TableId"}),
+	},
+	"link": {
+		"Match": newDirectives([]string{"MACAddress", "OriginalName", "Path", "Driver", "Type", "Host", "Virtualization", "KernelCommandLine", "Architecture"}),
+		"Link":  newDirectives([]string{"Description", "Alias", "MACAddressPolicy", "MACAddress", "NamePolicy", "Name", "MTUBytes", "BitsPerSecond", "Duplex", "AutoNegotiation", "WakeOnLan", "Port", "TCPSegmentationOffload", "TCP6SegmentationOffload", "GenericSegmentationOffload", "GenericReceiveOffload", "LargeReceiveOffload", "RxChannels", "TxChannels", "OtherChannels", "CombinedChannels"}),
+	},
+}
+
+// requiredSections maps the types of units which can't be loaded without a
+// section specific to their type to that section.
+var requiredSections = map[string]string{
+	"service":   "Service",
+	"socket":    "Socket",
+	"mount":     "Mount",
+	"automount": "Automount",
+	"swap":      "Swap",
+	"path":      "Path",
+	"timer":     "Timer",
+}
+
+var (
+	conditions = []string{"Architecture", "Virtualization", "Host", "KernelCommandLine", "KernelVersion", "Security", "Capability", "ACPower", "NeedsUpdate", "FirstBoot", "PathExists", "PathExistsGlob", "PathIsDirectory", "PathIsSymbolicLink", "PathIsMountPoint", "PathIsReadWrite", "DirectoryNotEmpty", "FileNotEmpty", "FileIsExecutable", "User", "Group", "ControlGroupController", "Null"}
+
+	unitDirectives = newDirectives([]string{
+		"Description", "Documentation", "Requires", "RequiresOverridable", "Requisite", "RequisiteOverridable", "Wants", "BindsTo", "PartOf", "Conflicts", "Before", "After", "OnFailure", "PropagatesReloadTo", "ReloadPropagatedFrom", "JoinsNamespaceOf", "RequiresMountsFor", "OnFailureJobMode", "OnFailureIsolate", "IgnoreOnIsolate", "StopWhenUnneeded", "RefuseManualStart", "RefuseManualStop", "AllowIsolate", "DefaultDependencies", "JobTimeoutSec", "JobTimeoutAction", "JobTimeoutRebootArgument", "StartLimitInterval", "StartLimitIntervalSec", "StartLimitBurst", "StartLimitAction", "FailureAction", "SuccessAction", "RebootArgument", "SourcePath",
+	}, prefixed("Condition", conditions), prefixed("Assert", conditions))
+
+	installDirectives = newDirectives([]string{"Alias", "WantedBy", "RequiredBy", "Also", "DefaultInstance"})
+
+	serviceDirectives = []string{
+		"Type", "RemainAfterExit", "GuessMainPID", "PIDFile", "BusName", "BusPolicy", "ExecStart", "ExecStartPre", "ExecStartPost", "ExecReload", "ExecStop", "ExecStopPost", "RestartSec", "TimeoutStartSec", "TimeoutStopSec", "TimeoutSec", "RuntimeMaxSec", "WatchdogSec", "Restart", "SuccessExitStatus", "RestartPreventExitStatus", "RestartForceExitStatus", "PermissionsStartOnly", "RootDirectoryStartOnly", "NonBlocking", "NotifyAccess", "Sockets", "FailureAction", "FileDescriptorStoreMax", "USBFunctionDescriptors", "USBFunctionStrings", "StartLimitInterval", "StartLimitBurst", "StartLimitAction", "RebootArgument",
+	}
+
+	socketDirectives = []string{
+		"ListenStream", "ListenDatagram", "ListenSequentialPacket", "ListenFIFO", "ListenSpecial", "ListenNetlink", "ListenMessageQueue", "ListenUSBFunction", "SocketProtocol", "BindIPv6Only", "Backlog", "BindToDevice", "SocketUser", "SocketGroup", "SocketMode", "DirectoryMode", "Accept", "Writable", "MaxConnections", "MaxConnectionsPerSource", "KeepAlive", "KeepAliveTimeSec", "KeepAliveIntervalSec", "KeepAliveProbes", "NoDelay", "Priority", "DeferAcceptSec", "ReceiveBuffer", "SendBuffer", "IPTOS", "IPTTL", "Mark", "ReusePort", "SmackLabel", "SmackLabelIPIn", "SmackLabelIPOut", "SELinuxContextFromNet", "PipeSize", "MessageQueueMaxMessages", "MessageQueueMessageSize", "FreeBind", "Transparent", "Broadcast", "PassCredentials", "PassSecurity", "TCPCongestion", "ExecStartPre", "ExecStartPost", "ExecStopPre", "ExecStopPost", "TimeoutSec", "Service", "RemoveOnStop", "Symlinks", "FileDescriptorName", "TriggerLimitIntervalSec", "TriggerLimitBurst",
+	}
+
+	mountDirectives = []string{"What", "Where", "Type", "Options", "SloppyOptions", "LazyUnmount", "ForceUnmount", "DirectoryMode", "TimeoutSec"}
+
+	execDirectives = []string{
+		"WorkingDirectory", "RootDirectory", "User", "Group", "SupplementaryGroups", "DynamicUser", "Nice", "OOMScoreAdjust", "IOSchedulingClass", "IOSchedulingPriority", "CPUSchedulingPolicy", "CPUSchedulingPriority", "CPUSchedulingResetOnFork", "CPUAffinity", "UMask", "Environment", "EnvironmentFile", "PassEnvironment", "StandardInput", "StandardOutput", "StandardError", "TTYPath", "TTYReset", "TTYVHangup", "TTYVTDisallocate", "SyslogIdentifier", "SyslogFacility", "SyslogLevel", "SyslogLevelPrefix", "TimerSlackNSec", "LimitCPU", "LimitFSIZE", "LimitDATA", "LimitSTACK", "LimitCORE", "LimitRSS", "LimitNOFILE", "LimitAS", "LimitNPROC", "LimitMEMLOCK", "LimitLOCKS", "LimitSIGPENDING", "LimitMSGQUEUE", "LimitNICE", "LimitRTPRIO", "LimitRTTIME", "PAMName", "CapabilityBoundingSet", "AmbientCapabilities", "SecureBits", "Capabilities", "ReadWriteDirectories", "ReadOnlyDirectories", "InaccessibleDirectories", "ReadWritePaths", "ReadOnlyPaths", "InaccessiblePaths", "PrivateTmp", "PrivateDevices", "PrivateNetwork", "PrivateUsers", "ProtectSystem", "ProtectHome", "ProtectKernelTunables", "ProtectKernelModules", "ProtectControlGroups", "MountFlags", "UtmpIdentifier", "UtmpMode", "SELinuxContext", "AppArmorProfile", "SmackProcessLabel", "IgnoreSIGPIPE", "NoNewPrivileges", "SystemCallFilter", "SystemCallErrorNumber", "SystemCallArchitectures", "RestrictAddressFamilies", "RestrictRealtime", "RestrictNamespaces", "MemoryDenyWriteExecute", "LockPersonality", "Personality", "RemoveIPC", "RuntimeDirectory", "RuntimeDirectoryMode", "StateDirectory", "CacheDirectory", "LogsDirectory", "ConfigurationDirectory", "KeyringMode",
+	}
+
+	killDirectives = []string{"KillMode", "KillSignal", "SendSIGHUP", "SendSIGKILL", "FinalKillSignal"}
+
+	resourceControlDirectives = []string{
+		"CPUAccounting", "CPUShares", "StartupCPUShares", "CPUWeight", "StartupCPUWeight", "CPUQuota", "MemoryAccounting", "MemoryLimit", "MemoryLow", "MemoryHigh", "MemoryMax", "MemorySwapMax", "TasksAccounting", "TasksMax", "IOAccounting", "IOWeight", "StartupIOWeight", "IODeviceWeight", "IOReadBandwidthMax", "IOWriteBandwidthMax", "IOReadIOPSMax", "IOWriteIOPSMax", "BlockIOAccounting", "BlockIOWeight", "StartupBlockIOWeight", "BlockIODeviceWeight", "BlockIOReadBandwidth", "BlockIOWriteBandwidth", "DeviceAllow", "DevicePolicy", "Slice", "Delegate", "IPAccounting", "IPAddressAllow", "IPAddressDeny",
+	}
+
+	networkDirectives = []string{
+		"Description", "DHCP", "DHCPServer", "LinkLocalAddressing", "IPv4LLRoute", "IPv6Token", "LLMNR", "MulticastDNS", "DNSSEC", "DNSSECNegativeTrustAnchors", "LLDP", "EmitLLDP", "BindCarrier", "Address", "Gateway", "DNS", "Domains", "NTP", "IPForward", "IPMasquerade", "IPv6PrivacyExtensions", "IPv6AcceptRA", "IPv6AcceptRouterAdvertisements", "IPv6DuplicateAddressDetection", "IPv6HopLimit", "ProxyARP", "Bridge", "Bond", "VRF", "VLAN", "MACVLAN", "MACVTAP", "VXLAN", "Tunnel", "IPVLAN", "ActiveSlave", "PrimarySlave", "ConfigureWithoutCarrier",
+	}
+)
+
+// directives is the set of the names of the directives of a section.
+type directives map[string]bool
+
+func newDirectives(names ...[]string) directives {
+	d := directives{}
+	for _, ns := range names {
+		for _, n := range ns {
+			d[n] = true
+		}
+	}
+	return d
+}
+
+func prefixed(prefix string, names []string) []string {
+	var p []string
+	for _, n := range names {
+		p = append(p, prefix+n)
+	}
+	return p
+}
+
+// unitType returns the type of the unit with the given name, which is the
+// suffix of the name without the period.
+func unitType(name string) string {
+	return strings.TrimPrefix(path.Ext(name), ".")
+}
+
+// unitLine is a section header or a directive in the contents of a unit. The
+// line is relative to the start of the contents.
+type unitLine struct {
+	section   string
+	directive string
+	line      int
+}
+
+// unitError is a line of the contents of a unit which systemd can't parse.
+type unitError struct {
+	line    int
+	message string
+}
+
+// parseUnit parses the contents of a unit or drop-in the way systemd does,
+// returning the section headers (which have an empty directive) and the
+// directives, along with the lines which can't be parsed. Comments and
+// empty lines are skipped, and lines ending with a backslash are continued
+// on the next line. The directives following an invalid section header are
+// skipped.
+func parseUnit(content string) ([]unitLine, []unitError) {
+	var lines []unitLine
+	var errs []unitError
+	section := ""
+	invalidSection := false
+	continued := false
+	for i, l := range strings.Split(strings.Replace(content, "\r", "", -1), "\n") {
+		l = strings.TrimSpace(l)
+		wasContinued := continued
+		continued = strings.HasSuffix(l, "\\")
+		switch {
+		case wasContinued:
+			// Comments within a continued directive are skipped,
+			// without ending it.
+			if strings.HasPrefix(l, "#") || strings.HasPrefix(l, ";") {
+				continued = true
+			}
+		case l == "", strings.HasPrefix(l, "#"), strings.HasPrefix(l, ";"):
+			continued = false
+		case strings.HasPrefix(l, "["):
+			continued = false
+			invalidSection = !strings.HasSuffix(l, "]") || len(l) < 3
+			if invalidSection {
+				errs = append(errs, unitError{i + 1, fmt.Sprintf("invalid section header %q", l)})
+				continue
+			}
+			section = l[1 : len(l)-1]
+			lines = append(lines, unitLine{section: section, line: i + 1})
+		case invalidSection:
+		case !strings.Contains(l, "="):
+			errs = append(errs, unitError{i + 1, fmt.Sprintf("invalid line %q", l)})
+		case section == "":
+			errs = append(errs, unitError{i + 1, fmt.Sprintf("directive %q outside of a section", l)})
+		default:
+			d := strings.TrimSpace(strings.SplitN(l, "=", 2)[0])
+			lines = append(lines, unitLine{section: section, directive: d, line: i + 1})
+		}
+	}
+	return lines, errs
+}
@@ -0,0 +1,61 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUnit(t *testing.T) {
+	tests := []struct {
+		content string
+
+		lines []unitLine
+		errs  []unitError
+	}{
+		{},
+		{
+			content: "# comment\n[Unit]\nDescription = Foo\n\n; comment\n[Service]\nExecStart=/bin/foo \\\n# comment\n  --bar=baz\r\nType=oneshot\n",
+			lines: []unitLine{
+				{"Unit", "", 2},
+				{"Unit", "Description", 3},
+				{"Service", "", 6},
+				{"Service", "ExecStart", 7},
+				{"Service", "Type", 10},
+			},
+		},
+		{
+			content: "Description=Foo\n[Unit\nAfter=foo.service\n[]\n[Service]\nfoo\n",
+			lines:   []unitLine{{"Service", "", 5}},
+			errs: []unitError{
+				{1, `directive "Description=Foo" outside of a section`},
+				{2, `invalid section header "[Unit"`},
+				{4, `invalid section header "[]"`},
+				{6, `invalid line "foo"`},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		lines, errs := parseUnit(tt.content)
+		if !reflect.DeepEqual(tt.lines, lines) {
+			t.Errorf("bad lines (%d): want %#v, got %#v", i, tt.lines, lines)
+		}
+		if !reflect.DeepEqual(tt.errs, errs) {
+			t.Errorf("bad errors (%d): want %#v, got %#v", i, tt.errs, errs)
+		}
+	}
+}
@@ -22,8 +22,6 @@ import (
 	"strings"
 
 	"github.com/coreos/coreos-cloudinit/config"
-
-	"github.com/coreos/coreos-cloudinit/Godeps/_workspace/src/github.com/coreos/yaml"
 )
 
 var (
@@ -31,26 +29,73 @@ var (
 	yamlError     = regexp.MustCompile(`^YAML error: (?P<msg>.*)$`)
 )
 
+// The kinds of user-data, as returned by DetectKind.
+const (
+	KindEmpty       = "empty"
+	KindScript      = "script"
+	KindInclude     = "include"
+	KindCloudConfig = "cloud-config"
+	KindMultipart   = "multipart"
+	KindUnknown     = "unknown"
+)
+
+// DetectKind returns the kind of the given user-data, decompressing it first
+// if needed. User-data which can't be decoded is of unknown kind.
+func DetectKind(userdataBytes []byte) string {
+	decoded, err := config.DecodeUserData(string(userdataBytes))
+	if err != nil {
+		return KindUnknown
+	}
+	return detectKind(decoded)
+}
+
+func detectKind(userdata string) string {
+	switch {
+	case len(userdata) == 0:
+		return KindEmpty
+	case config.IsScript(userdata):
+		return KindScript
+	case config.IsInclude(userdata), config.IsIncludeOnce(userdata):
+		return KindInclude
+	case config.IsCloudConfig(userdata):
+		return KindCloudConfig
+	case config.IsMultipart(userdata):
+		return KindMultipart
+	default:
+		return KindUnknown
+	}
+}
+
 // Validate runs a series of validation tests against the given userdata and
 // returns a report detailing all of the issues. Presently, only cloud-configs
-// can be validated.
+// (including the cloud-config parts of multipart user-data) can be validated.
+// Gzipped user-data is decompressed before being validated.
 func Validate(userdataBytes []byte) (Report, error) {
-	switch {
-	case len(userdataBytes) == 0:
-		return Report{}, nil
-	case config.IsScript(string(userdataBytes)):
+	decoded, err := config.DecodeUserData(string(userdataBytes))
+	if err != nil {
+		return Report{entries: []Entry{
+			Entry{kind: entryError, message: err.Error(), line: 1, rule: userDataRule},
+		}}, nil
+	}
+	userdataBytes = []byte(decoded)
+
+	switch detectKind(decoded) {
+	case KindEmpty, KindScript, KindInclude:
 		return Report{}, nil
-	case config.IsCloudConfig(string(userdataBytes)):
+	case KindCloudConfig:
 		return validateCloudConfig(userdataBytes, Rules)
+	case KindMultipart:
+		return validateMultipart(userdataBytes, Rules)
 	default:
 		return Report{entries: []Entry{
-			Entry{kind: entryError, message: `must be "#cloud-config" or begin with "#!"`, line: 1},
+			Entry{kind: entryError, message: `must be "#cloud-config" or begin with "#!"`, line: 1, rule: userDataRule},
 		}}, nil
 	}
 }
 
 // validateCloudConfig runs all of the validation rules in Rules and returns
-// the resulting report and any errors encountered.
+// the resulting report and any errors encountered. Each entry is attributed
+// to the rule which reported it.
 func validateCloudConfig(config []byte, rules []rule) (report Report, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -59,12 +104,40 @@ func validateCloudConfig(config []byte, rules []rule) (report Report, err error)
 	}()
 
 	c, err := parseCloudConfig(config, &report)
+	report.attribute(0, yamlRule)
 	if err != nil {
 		return report, err
 	}
 
 	for _, r := range rules {
-		r(c, &report)
+		n := len(report.entries)
+		r.check(c, &report)
+		report.attribute(n, r.id)
+	}
+	return report, nil
+}
+
+// validateMultipart validates each of the cloud-config parts of the multipart
+// user-data and returns the combined report. Line numbers are relative to the
+// start of each part.
+func validateMultipart(userdata []byte, rules []rule) (Report, error) {
+	parts, err := config.NewMultipart(string(userdata))
+	if err != nil {
+		return Report{entries: []Entry{
+			Entry{kind: entryError, message: fmt.Sprintf("invalid multipart user-data: %v", err), line: 1, rule: userDataRule},
+		}}, nil
+	}
+
+	var report Report
+	for _, part := range parts {
+		if part.ContentType != config.ContentTypeCloudConfig {
+			continue
+		}
+		r, err := validateCloudConfig(part.Content, rules)
+		if err != nil {
+			return report, err
+		}
+		report.entries = append(report.entries, r.entries...)
 	}
 	return report, nil
 }
@@ -73,14 +146,13 @@ func validateCloudConfig(config []byte, rules []rule) (report Report, err error)
 // any parsing issues into the provided report. Unrecoverable errors are
 // returned as an error.
 func parseCloudConfig(cfg []byte, report *Report) (node, error) {
-	yaml.UnmarshalMappingKeyTransform = func(nameIn string) (nameOut string) {
-		return nameIn
-	}
 	// unmarshal the config into an implicitly-typed form. The yaml library
 	// will implicitly convert types into their normalized form
 	// (e.g. 0744 -> 484, off -> false).
 	var weak map[interface{}]interface{}
-	if err := yaml.Unmarshal(cfg, &weak); err != nil {
+	if err := config.UnmarshalYAML(cfg, &weak, func(nameIn string) (nameOut string) {
+		return nameIn
+	}); err != nil {
 		matches := yamlLineError.FindStringSubmatch(err.Error())
 		if len(matches) == 3 {
 			line, err := strconv.Atoi(matches[1])
@@ -88,13 +160,13 @@ func parseCloudConfig(cfg []byte, report *Report) (node, error) {
 				return node{}, err
 			}
 			msg := matches[2]
-			report.Error(line, msg)
+			report.Error(line, 0, msg)
 			return node{}, nil
 		}
 
 		matches = yamlError.FindStringSubmatch(err.Error())
 		if len(matches) == 2 {
-			report.Error(1, matches[1])
+			report.Error(1, 0, matches[1])
 			return node{}, nil
 		}
 
@@ -104,11 +176,10 @@ func parseCloudConfig(cfg []byte, report *Report) (node, error) {
 	w = normalizeNodeNames(w, report)
 
 	// unmarshal the config into the explicitly-typed form.
-	yaml.UnmarshalMappingKeyTransform = func(nameIn string) (nameOut string) {
-		return strings.Replace(nameIn, "-", "_", -1)
-	}
 	var strong config.CloudConfig
-	if err := yaml.Unmarshal([]byte(cfg), &strong); err != nil {
+	if err := config.UnmarshalYAML(cfg, &strong, func(nameIn string) (nameOut string) {
+		return strings.Replace(nameIn, "-", "_", -1)
+	}); err != nil {
 		return node{}, err
 	}
 	s := NewNode(strong, NewContext(cfg))
@@ -152,7 +223,7 @@ func coerceNodes(w, s node) node {
 func normalizeNodeNames(node node, report *Report) node {
 	if strings.Contains(node.name, "-") {
 		// TODO(crawford): Enable this message once the new validator hits stable.
-		//report.Info(node.line, fmt.Sprintf("%q uses '-' instead of '_'", node.name))
+		//report.Info(node.line, node.column, fmt.Sprintf("%q uses '-' instead of '_'", node.name))
 		node.name = strings.Replace(node.name, "-", "_", -1)
 	}
 	for i := range node.children {
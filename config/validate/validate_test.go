@@ -16,7 +16,9 @@ package validate
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -29,15 +31,15 @@ func TestParseCloudConfig(t *testing.T) {
 		{},
 		{
 			config: "	",
-			entries: []Entry{{entryError, "found character that cannot start any token", 1}},
+			entries: []Entry{{entryError, "found character that cannot start any token", 1, 0, ""}},
 		},
 		{
 			config:  "a:\na",
-			entries: []Entry{{entryError, "could not find expected ':'", 2}},
+			entries: []Entry{{entryError, "could not find expected ':'", 2, 0, ""}},
 		},
 		{
 			config:  "#hello\na:\na",
-			entries: []Entry{{entryError, "could not find expected ':'", 3}},
+			entries: []Entry{{entryError, "could not find expected ':'", 3, 0, ""}},
 		},
 	}
 
@@ -60,9 +62,13 @@ func TestValidateCloudConfig(t *testing.T) {
 		err    error
 	}{
 		{
-			rules: []rule{func(_ node, _ *Report) { panic("something happened") }},
+			rules: []rule{{check: func(_ node, _ *Report) { panic("something happened") }}},
 			err:   errors.New("something happened"),
 		},
+		{
+			config: "a:\na",
+			report: Report{entries: []Entry{{entryError, "could not find expected ':'", 2, 0, "yaml"}}},
+		},
 		{
 			config: "write_files:\n  - permissions: 0744",
 			rules:  Rules,
@@ -86,7 +92,22 @@ func TestValidateCloudConfig(t *testing.T) {
 		{
 			config: "coreos:\n  update:\n    reboot-strategy: false",
 			rules:  Rules,
-			report: Report{entries: []Entry{{entryError, "invalid value false", 3}}},
+			report: Report{entries: []Entry{{entryError, "invalid value false", 3, 5, "validity"}}},
+		},
+		{
+			config: "frequency:\n  scripts: per-instance\n  users: sometimes",
+			rules:  Rules,
+			report: Report{entries: []Entry{{entryError, "invalid value sometimes", 3, 3, "validity"}}},
+		},
+		{
+			config: "write_files:\n  - content: |\n      path: /usr/foo\n    path: /usr/bar",
+			rules:  Rules,
+			report: Report{entries: []Entry{{entryError, "file cannot be written to a read-only filesystem", 4, 5, "read-only-path"}}},
+		},
+		{
+			config: "users:\n  - {name: a, passwd: x}\n  - {name: b, system: 1}",
+			rules:  Rules,
+			report: Report{entries: []Entry{{entryWarning, "incorrect type for \"system\" (want bool)", 3, 15, "structure"}}},
 		},
 	}
 
@@ -111,6 +132,18 @@ func TestValidate(t *testing.T) {
 		{
 			config: "#!/bin/bash\necho hey",
 		},
+		{
+			config: "Content-Type: multipart/mixed; boundary=abc\n\n--abc\nContent-Type: text/x-shellscript\n\n#!/bin/bash\n--abc\nContent-Type: text/cloud-config\n\nhostname: test\nbad: key\n--abc--\n",
+			report: Report{entries: []Entry{{entryWarning, "unrecognized key \"bad\"", 2, 1, "structure"}}},
+		},
+		{
+			config: "\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\x03\x53\x4e\xce\xc9\x2f\x4d\xd1\x4d\xce\xcf\x4b\xcb\x4c\xe7\x4a\x4a\x4c\xb1\x52\xc8\x4e\xad\xe4\x02\x00\xd3\x57\xcd\x11\x17\x00\x00\x00",
+			report: Report{entries: []Entry{{entryWarning, "unrecognized key \"bad\"", 2, 1, "structure"}}},
+		},
+		{
+			config: "Content-Type: multipart/mixed\n\n",
+			report: Report{entries: []Entry{{entryError, "invalid multipart user-data: multipart user-data is missing a boundary", 1, 0, "user-data"}}},
+		},
 	}
 
 	for i, tt := range tests {
@@ -124,6 +157,58 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+func TestDetectKind(t *testing.T) {
+	tests := []struct {
+		userdata string
+
+		kind string
+	}{
+		{"", KindEmpty},
+		{"#!/bin/bash\necho hey", KindScript},
+		{"#include\nhttp://example.com/a", KindInclude},
+		{"#include-once\nhttp://example.com/a", KindInclude},
+		{"#cloud-config\nhostname: test", KindCloudConfig},
+		{"Content-Type: multipart/mixed; boundary=abc\n\n--abc--\n", KindMultipart},
+		{"\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\x03\x53\x4e\xce\xc9\x2f\x4d\xd1\x4d\xce\xcf\x4b\xcb\x4c\xe7\x4a\x4a\x4c\xb1\x52\xc8\x4e\xad\xe4\x02\x00\xd3\x57\xcd\x11\x17\x00\x00\x00", KindCloudConfig},
+		{"\x1f\x8b\x08", KindUnknown},
+		{"hostname: test", KindUnknown},
+	}
+
+	for _, tt := range tests {
+		if kind := DetectKind([]byte(tt.userdata)); tt.kind != kind {
+			t.Errorf("bad kind (%q): want %q, got %q", tt.userdata, tt.kind, kind)
+		}
+	}
+}
+
+func TestValidateConcurrently(t *testing.T) {
+	config := []byte("#cloud-config\ncoreos:\n  update:\n    reboot-strategy: off\n")
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 100)
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r, err := Validate(config)
+			if err != nil || len(r.Entries()) != 0 {
+				errs <- fmt.Sprintf("bad validation: want no entries, got %v, %v", r.Entries(), err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := Fix(config); err != nil {
+				errs <- fmt.Sprintf("bad error fixing: want %v, got %v", nil, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
 func BenchmarkValidate(b *testing.B) {
 	config := `#cloud-config
 hostname: test
@@ -18,17 +18,23 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/coreos/coreos-cloudinit/config"
 	"github.com/coreos/coreos-cloudinit/config/validate"
 	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/cache"
 	"github.com/coreos/coreos-cloudinit/datasource/configdrive"
 	"github.com/coreos/coreos-cloudinit/datasource/file"
 	"github.com/coreos/coreos-cloudinit/datasource/metadata/cloudsigma"
 	"github.com/coreos/coreos-cloudinit/datasource/metadata/digitalocean"
 	"github.com/coreos/coreos-cloudinit/datasource/metadata/ec2"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/gce"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/openstack"
+	"github.com/coreos/coreos-cloudinit/datasource/nocloud"
 	"github.com/coreos/coreos-cloudinit/datasource/proc_cmdline"
 	"github.com/coreos/coreos-cloudinit/datasource/url"
 	"github.com/coreos/coreos-cloudinit/datasource/waagent"
@@ -43,6 +49,7 @@ const (
 	datasourceInterval    = 100 * time.Millisecond
 	datasourceMaxInterval = 30 * time.Second
 	datasourceTimeout     = 5 * time.Minute
+	datasourceMergeWindow = 30 * time.Second
 )
 
 var (
@@ -50,6 +57,8 @@ var (
 		printVersion  bool
 		ignoreFailure bool
 		sources       struct {
+			auto                        bool
+			cache                       bool
 			file                        string
 			configDrive                 string
 			waagent                     string
@@ -57,20 +66,37 @@ var (
 			ec2MetadataService          string
 			cloudSigmaMetadataService   bool
 			digitalOceanMetadataService string
+			gceMetadataService          string
+			openStackMetadataService    string
 			url                         string
 			procCmdLine                 bool
+			noCloud                     string
+			noCloudNet                  bool
 		}
-		convertNetconf string
-		workspace      string
-		sshKeyName     string
-		oem            string
-		validate       bool
+		convertNetconf   string
+		workspace        string
+		root             string
+		sshKeyName       string
+		oem              string
+		validate         bool
+		validateFormat   string
+		failOn           string
+		fix              bool
+		mergeDatasources bool
+		dryRun           bool
+		continueOnError  bool
+		cacheMaxAge      time.Duration
+		unitTimeout      time.Duration
+		useSystemctl     bool
 	}{}
 )
 
 func init() {
 	flag.BoolVar(&flags.printVersion, "version", false, "Print the version and exit")
 	flag.BoolVar(&flags.ignoreFailure, "ignore-failure", false, "Exits with 0 status in the event of malformed input from user-data")
+	flag.BoolVar(&flags.sources.auto, "from-auto", false, "Detect the platform and use the datasources plausibly available on it")
+	flag.BoolVar(&flags.sources.cache, "from-cache", false, "Fall back to the data cached in the workspace if no other datasource becomes available")
+	flag.DurationVar(&flags.cacheMaxAge, "cache-max-age", 0, "Ignore cached data older than the given duration (0 means no limit)")
 	flag.StringVar(&flags.sources.file, "from-file", "", "Read user-data from provided file")
 	flag.StringVar(&flags.sources.configDrive, "from-configdrive", "", "Read data from provided cloud-drive directory")
 	flag.StringVar(&flags.sources.waagent, "from-waagent", "", "Read data from provided waagent directory")
@@ -78,38 +104,79 @@ func init() {
 	flag.StringVar(&flags.sources.ec2MetadataService, "from-ec2-metadata", "", "Download EC2 data from the provided url")
 	flag.BoolVar(&flags.sources.cloudSigmaMetadataService, "from-cloudsigma-metadata", false, "Download data from CloudSigma server context")
 	flag.StringVar(&flags.sources.digitalOceanMetadataService, "from-digitalocean-metadata", "", "Download DigitalOcean data from the provided url")
+	flag.StringVar(&flags.sources.gceMetadataService, "from-gce-metadata", "", "Download GCE data from the provided url")
+	flag.StringVar(&flags.sources.openStackMetadataService, "from-openstack-metadata", "", "Download OpenStack data from the provided url")
 	flag.StringVar(&flags.sources.url, "from-url", "", "Download user-data from provided url")
 	flag.BoolVar(&flags.sources.procCmdLine, "from-proc-cmdline", false, fmt.Sprintf("Parse %s for '%s=<url>', using the cloud-config served by an HTTP GET to <url>", proc_cmdline.ProcCmdlineLocation, proc_cmdline.ProcCmdlineCloudConfigFlag))
+	flag.StringVar(&flags.sources.noCloud, "from-nocloud", "", "Read data from provided NoCloud (cidata) directory")
+	flag.BoolVar(&flags.sources.noCloudNet, "from-nocloud-net", false, fmt.Sprintf("Parse %s for 'ds=nocloud-net;s=<url>', reading the NoCloud seed found at <url>", nocloud.ProcCmdlineLocation))
 	flag.StringVar(&flags.oem, "oem", "", "Use the settings specific to the provided OEM")
 	flag.StringVar(&flags.convertNetconf, "convert-netconf", "", "Read the network config provided in cloud-drive and translate it from the specified format into networkd unit files")
 	flag.StringVar(&flags.workspace, "workspace", "/var/lib/coreos-cloudinit", "Base directory coreos-cloudinit should use to store data")
+	flag.StringVar(&flags.root, "root", "/", "Apply the user-data to the image whose root filesystem is at the given path, without using systemd; unit commands and scripts are queued for its first boot")
 	flag.StringVar(&flags.sshKeyName, "ssh-key-name", initialize.DefaultSSHKeyName, "Add SSH keys to the system with the given name")
 	flag.BoolVar(&flags.validate, "validate", false, "[EXPERIMENTAL] Validate the user-data but do not apply it to the system")
+	flag.StringVar(&flags.validateFormat, "validate-format", "text", "With --validate, print the report as 'text', 'json' or 'sarif'; the latter two require the user-data files to validate as arguments")
+	flag.StringVar(&flags.failOn, "fail-on", "info", "With --validate, exit with 1 if there is an entry at least as severe as the given one: 'error', 'warning' or 'info'")
+	flag.BoolVar(&flags.fix, "fix", false, "With --validate, also print a diff fixing the keys of the cloud-config and moving write_files out from under coreos")
+	flag.BoolVar(&flags.dryRun, "dry-run", false, "Print the actions which would be taken to apply the user-data, without changing the system")
+	flag.DurationVar(&flags.unitTimeout, "unit-timeout", system.DefaultJobTimeout, "How long to wait for the command of each unit which sets 'wait' to complete")
+	flag.BoolVar(&flags.useSystemctl, "use-systemctl", false, "Manage units with systemctl rather than over D-Bus, which is otherwise only done if the system bus is unavailable")
+	flag.BoolVar(&flags.continueOnError, "continue-on-error", false, "Carry on applying the steps which don't depend on a failed one, and the scripts, then report every error")
+	flag.BoolVar(&flags.mergeDatasources, "merge-datasources", false, "Fetch from every available datasource and merge the results in order of precedence")
 }
 
+// commands maps the names of subcommands to the functions which run them.
+// Each is given the remaining arguments and returns the exit code.
+var commands = map[string]func(args []string) int{
+	"schema":         schemaCommand,
+	"serve-validate": serveValidateCommand,
+	"status":         statusCommand,
+}
+
+// detectedNetconf maps the type of each datasource found by --from-auto to the
+// network config format it provides.
+var detectedNetconf = map[string]string{}
+
 type oemConfig map[string]string
 
 var (
 	oemConfigs = map[string]oemConfig{
 		"digitalocean": oemConfig{
 			"from-digitalocean-metadata": "http://169.254.169.254/",
+			"from-cache":                 "true",
 			"convert-netconf":            "digitalocean",
 		},
 		"ec2-compat": oemConfig{
 			"from-ec2-metadata": "http://169.254.169.254/",
 			"from-configdrive":  "/media/configdrive",
+			"from-cache":        "true",
+		},
+		"openstack": oemConfig{
+			"from-openstack-metadata": "http://169.254.169.254/",
+			"from-configdrive":        "/media/configdrive",
+			"merge-datasources":       "true",
 		},
 		"rackspace-onmetal": oemConfig{
 			"from-configdrive": "/media/configdrive",
-			"convert-netconf":  "debian",
+			"convert-netconf":  "openstack",
 		},
 		"azure": oemConfig{
 			"from-waagent": "/var/lib/waagent",
 		},
+		"gce": oemConfig{
+			"from-gce-metadata": "http://metadata.google.internal/",
+		},
 	}
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+
 	failure := false
 
 	flag.Parse()
@@ -136,74 +203,241 @@ func main() {
 	case "":
 	case "debian":
 	case "digitalocean":
+	case "nocloud":
+	case "openstack":
 	default:
-		fmt.Printf("Invalid option to -convert-netconf: '%s'. Supported options: 'debian, digitalocean'\n", flags.convertNetconf)
+		fmt.Printf("Invalid option to -convert-netconf: '%s'. Supported options: 'debian, digitalocean, nocloud, openstack'\n", flags.convertNetconf)
 		os.Exit(2)
 	}
 
+	switch flags.validateFormat {
+	case "text":
+	case "json", "sarif":
+		if flags.validate && flag.NArg() == 0 {
+			fmt.Printf("--validate-format=%s requires the user-data files to validate as arguments\n", flags.validateFormat)
+			os.Exit(2)
+		}
+		if flags.fix {
+			fmt.Println("--fix can only be used with --validate-format=text")
+			os.Exit(2)
+		}
+	default:
+		fmt.Printf("Invalid option to --validate-format: '%s'. Supported options: 'text, json, sarif'\n", flags.validateFormat)
+		os.Exit(2)
+	}
+
+	switch flags.failOn {
+	case "error":
+	case "warning":
+	case "info":
+	default:
+		fmt.Printf("Invalid option to --fail-on: '%s'. Supported options: 'error, warning, info'\n", flags.failOn)
+		os.Exit(2)
+	}
+
+	if flags.validate && flag.NArg() > 0 {
+		os.Exit(validateFiles(flag.Args()))
+	}
+
 	dss := getDatasources()
-	if len(dss) == 0 {
-		fmt.Println("Provide at least one of --from-file, --from-configdrive, --from-ec2-metadata, --from-cloudsigma-metadata, --from-url or --from-proc-cmdline")
+	var cached *cache.Cache
+	if flags.sources.cache {
+		cached = cache.New(flags.workspace, flags.cacheMaxAge)
+	}
+	if len(dss) == 0 && cached == nil {
+		fmt.Println("Provide at least one of --from-auto, --from-cache, --from-file, --from-configdrive, --from-ec2-metadata, --from-cloudsigma-metadata, --from-gce-metadata, --from-openstack-metadata, --from-nocloud, --from-nocloud-net, --from-url or --from-proc-cmdline")
 		os.Exit(2)
 	}
 
-	ds := selectDatasource(dss)
-	if ds == nil {
+	// Record the progress of the run in the workspace, unless nothing is
+	// meant to change or the user-data is applied to an image, whose status
+	// doesn't belong to this machine.
+	status := initialize.NewStatus(strings.Join(os.Args[1:], " "))
+	recordStatus := !flags.validate && !flags.dryRun && path.Clean(flags.root) == "/"
+	var recorder *system.Recorder
+	if recordStatus {
+		if err := status.Write(flags.workspace); err != nil {
+			fmt.Printf("Failed writing status: %v\n", err)
+		}
+	}
+	exit := func(code int) {
+		if recordStatus {
+			if recorder != nil {
+				status.Actions = recorder.Actions()
+			}
+			status.Finish(code)
+			if err := status.Write(flags.workspace); err != nil {
+				fmt.Printf("Failed writing status: %v\n", err)
+			}
+		}
+		os.Exit(code)
+	}
+
+	var sources []datasource.Datasource
+	if flags.mergeDatasources {
+		sources = selectDatasources(dss, datasourceTimeout)
+	} else if ds := selectDatasource(dss, datasourceTimeout); ds != nil {
+		sources = []datasource.Datasource{ds}
+	}
+	// The cached data is only used once the other datasources have timed
+	// out, so that a slow metadata service doesn't cause stale data to be
+	// replayed.
+	replayed := false
+	if len(sources) == 0 && cached != nil && cached.IsAvailable() {
+		fmt.Println("Falling back to cached data")
+		var err error
+		if sources, err = cached.Datasources(); err != nil {
+			fmt.Printf("Failed reading cached data: %v\n", err)
+			status.Errorf("Failed reading cached data: %v", err)
+			exit(1)
+		}
+		replayed = true
+	}
+	if len(sources) == 0 {
 		fmt.Println("No datasources available in time")
-		os.Exit(1)
+		status.Errorf("No datasources available in time")
+		exit(1)
 	}
 
-	fmt.Printf("Fetching user-data from datasource of type %q\n", ds.Type())
-	userdataBytes, err := ds.FetchUserdata()
-	if err != nil {
-		fmt.Printf("Failed fetching user-data from datasource: %v\nContinuing...\n", err)
-		failure = true
+	for _, ds := range sources {
+		status.Datasources = append(status.Datasources, ds.Type())
+		if format, ok := detectedNetconf[ds.Type()]; ok && flags.convertNetconf == "" {
+			flags.convertNetconf = format
+		}
 	}
 
-	if report, err := validate.Validate(userdataBytes); err == nil {
-		ret := 0
-		for _, e := range report.Entries() {
-			fmt.Println(e)
-			ret = 1
+	userdatas := make([][]byte, len(sources))
+	fetched := true
+	ret := 0
+	for i, ds := range sources {
+		fmt.Printf("Fetching user-data from datasource of type %q\n", ds.Type())
+		userdataBytes, err := ds.FetchUserdata()
+		if err != nil {
+			fmt.Printf("Failed fetching user-data from datasource: %v\nContinuing...\n", err)
+			status.Errorf("Failed fetching user-data from datasource of type %q: %v", ds.Type(), err)
+			failure = true
+			fetched = false
 		}
-		if flags.validate {
-			os.Exit(ret)
+		userdatas[i] = userdataBytes
+
+		if report, err := validate.Validate(userdataBytes); err == nil {
+			for _, e := range report.Entries() {
+				fmt.Println(e)
+			}
+			if report.Fails(flags.failOn) {
+				ret = 1
+			}
+			status.Validation = append(status.Validation, report.Entries()...)
+		} else {
+			fmt.Printf("Failed while validating user_data (%q)\n", err)
+			status.Errorf("Failed while validating user-data: %v", err)
+			ret = 1
 		}
-	} else {
-		fmt.Printf("Failed while validating user_data (%q)\n", err)
-		if flags.validate {
-			os.Exit(1)
+
+		if flags.validate && flags.fix && len(userdataBytes) > 0 {
+			if fixed, err := validate.Fix(userdataBytes); err == nil {
+				fmt.Print(pkg.UnifiedDiff("a/user-data", "b/user-data", userdataBytes, fixed))
+			} else {
+				fmt.Printf("Failed fixing user-data: %v\n", err)
+				ret = 1
+			}
 		}
 	}
+	if flags.validate {
+		os.Exit(ret)
+	}
 
-	fmt.Printf("Fetching meta-data from datasource of type %q\n", ds.Type())
-	metadata, err := ds.FetchMetadata()
-	if err != nil {
-		fmt.Printf("Failed fetching meta-data from datasource: %v\n", err)
-		os.Exit(1)
+	mds := make([]datasource.Metadata, len(sources))
+	for i, ds := range sources {
+		fmt.Printf("Fetching meta-data from datasource of type %q\n", ds.Type())
+		metadata, err := ds.FetchMetadata()
+		if err != nil {
+			fmt.Printf("Failed fetching meta-data from datasource: %v\n", err)
+			status.Errorf("Failed fetching meta-data from datasource of type %q: %v", ds.Type(), err)
+			exit(1)
+		}
+		mds[i] = metadata
+	}
+	metadata := datasource.MergeMetadata(mds...)
+
+	offline := path.Clean(flags.root) != "/"
+
+	// Cache the data of every datasource used, so that the same merged
+	// result can be replayed. Data cached for another instance is
+	// discarded even if it can't be replaced.
+	if !replayed && !flags.dryRun && !offline {
+		if fetched {
+			snapshots := make([]cache.Snapshot, len(sources))
+			for i, ds := range sources {
+				snapshots[i] = cache.Snapshot{Type: ds.Type(), Userdata: userdatas[i], Metadata: mds[i]}
+			}
+			if err := cache.Save(flags.workspace, metadata.InstanceID, snapshots); err != nil {
+				fmt.Printf("Failed caching data from datasource: %v\n", err)
+			}
+		} else if id, err := cache.New(flags.workspace, 0).InstanceID(); err == nil && id != metadata.InstanceID {
+			fmt.Printf("Discarding data cached for instance %q\n", id)
+			if err := cache.Discard(flags.workspace); err != nil {
+				fmt.Printf("Failed discarding cached data: %v\n", err)
+			}
+		}
 	}
 
 	// Apply environment to user-data
-	env := initialize.NewEnvironment("/", ds.ConfigRoot(), flags.workspace, flags.sshKeyName, metadata)
-	userdata := env.Apply(string(userdataBytes))
+	env := initialize.NewEnvironment(flags.root, sources[0].ConfigRoot(), flags.workspace, flags.sshKeyName, metadata)
 
-	var ccu *config.CloudConfig
-	var script *config.Script
-	if ud, err := initialize.ParseUserData(userdata); err != nil {
-		fmt.Printf("Failed to parse user-data: %v\nContinuing...\n", err)
-		failure = true
-	} else {
+	// Don't cache the content of #include-once URLs during a dry run.
+	includeWorkspace := env.Workspace()
+	if flags.dryRun {
+		includeWorkspace = ""
+	}
+
+	var ccs []config.CloudConfig
+	var scripts []config.Script
+	for i, userdataBytes := range userdatas {
+		ud, err := initialize.ParseUserDataInWorkspace(string(userdataBytes), includeWorkspace, env)
+		if err != nil {
+			fmt.Printf("Failed to parse user-data: %v\nContinuing...\n", err)
+			status.Errorf("Failed to parse user-data: %v", err)
+			failure = true
+			continue
+		}
 		switch t := ud.(type) {
 		case *config.CloudConfig:
-			ccu = t
+			ccs = append(ccs, *t)
 		case *config.Script:
-			script = t
+			scripts = addScripts(scripts, sources[i], *t)
+		case *initialize.MultipartUserData:
+			if t.CloudConfig != nil {
+				ccs = append(ccs, *t.CloudConfig)
+			}
+			scripts = addScripts(scripts, sources[i], t.Scripts...)
+		}
+	}
+
+	// Only merge the cloud-configs of several datasources, so that the
+	// entries of a single one are applied as they are. The datasources are
+	// ordered from highest to lowest precedence.
+	var ccu *config.CloudConfig
+	switch len(ccs) {
+	case 0:
+	case 1:
+		ccu = &ccs[0]
+	default:
+		for i, j := 0, len(ccs)-1; i < j; i, j = i+1, j-1 {
+			ccs[i], ccs[j] = ccs[j], ccs[i]
 		}
+		merged := config.Merge(ccs...)
+		ccu = &merged
 	}
 
 	fmt.Println("Merging cloud-config from meta-data and user-data")
 	cc := mergeConfigs(ccu, metadata)
 
+	// Drop the sections which were already applied, according to their
+	// frequency.
+	instance := initialize.NewInstance(env.Workspace(), metadata.InstanceID, userdatas...)
+	cc, scripts, ran := instance.Filter(cc, scripts)
+
 	var ifaces []network.InterfaceGenerator
 	if flags.convertNetconf != "" {
 		var err error
@@ -212,30 +446,98 @@ func main() {
 			ifaces, err = network.ProcessDebianNetconf(metadata.NetworkConfig)
 		case "digitalocean":
 			ifaces, err = network.ProcessDigitalOceanNetconf(metadata.NetworkConfig)
+		case "nocloud":
+			ifaces, err = network.ProcessNoCloudNetconf(metadata.NetworkConfig)
+		case "openstack":
+			ifaces, err = network.ProcessOpenStackNetconf(metadata.NetworkConfig)
 		default:
 			err = fmt.Errorf("Unsupported network config format %q", flags.convertNetconf)
 		}
 		if err != nil {
 			fmt.Printf("Failed to generate interfaces: %v\n", err)
-			os.Exit(1)
+			status.Errorf("Failed to generate interfaces: %v", err)
+			exit(1)
 		}
 	}
 
-	if err = initialize.Apply(cc, ifaces, env); err != nil {
-		fmt.Printf("Failed to apply cloud-config: %v\n", err)
-		os.Exit(1)
+	var hm system.HostManager = system.NewHostManager()
+	var um system.UnitManager
+	var plan *system.Plan
+	var image *system.Offline
+	if flags.dryRun {
+		plan = system.NewPlan(env.Root())
+		hm, um = plan, plan
+	} else {
+		switch {
+		case offline:
+			image = system.NewOffline(env.Root(), flags.workspace)
+			hm, um = image, image
+		case flags.useSystemctl:
+			um = system.NewSystemctlUnitManager(env.Root(), flags.unitTimeout)
+		default:
+			um = system.NewUnitManager(env.Root(), flags.unitTimeout)
+		}
+		recorder = system.NewRecorder(hm, um, env.Root())
+		hm, um = recorder, recorder
+	}
+
+	// Failing to apply the user-data is an error even with --ignore-failure.
+	applyFailed := false
+	env.SetContinueOnError(flags.continueOnError)
+	if err := initialize.Apply(cc, ifaces, env, hm, um); err != nil {
+		if errs, ok := err.(initialize.Errors); ok {
+			for _, err := range errs {
+				fmt.Printf("Failed to apply cloud-config: %v\n", err)
+			}
+		} else {
+			fmt.Printf("Failed to apply cloud-config: %v\n", err)
+		}
+		status.Errorf("Failed to apply cloud-config: %v", err)
+		if !flags.continueOnError {
+			exit(1)
+		}
+		applyFailed = true
 	}
 
-	if script != nil {
-		if err = runScript(*script, env); err != nil {
+	for _, script := range scripts {
+		description := fmt.Sprintf("Execute script (%d bytes)", len(script))
+		if plan != nil {
+			plan.Record("%s", description)
+			continue
+		}
+		if err := recorder.Do(description, func() error { return runScript(script, env, image) }); err != nil {
 			fmt.Printf("Failed to run script: %v\n", err)
-			os.Exit(1)
+			if !flags.continueOnError {
+				exit(1)
+			}
+			applyFailed = true
+		}
+	}
+
+	if plan != nil {
+		fmt.Printf("Dry run, the following actions would be taken:\n%s\n", plan)
+	} else {
+		// Sections are only recorded as applied if nothing failed, so
+		// that they are retried.
+		if applyFailed {
+			ran = nil
+		}
+		if err := instance.Ran(ran...); err != nil {
+			fmt.Printf("Failed recording the applied sections: %v\n", err)
+			status.Errorf("Failed recording the applied sections: %v", err)
+			failure = true
+		}
+		if err := instance.Save(); err != nil {
+			fmt.Printf("Failed recording the instance: %v\n", err)
+			status.Errorf("Failed recording the instance: %v", err)
+			failure = true
 		}
 	}
 
-	if failure && !flags.ignoreFailure {
-		os.Exit(1)
+	if applyFailed || (failure && !flags.ignoreFailure) {
+		exit(1)
 	}
+	exit(0)
 }
 
 // mergeConfigs merges certain options from md (meta-data from the datasource)
@@ -259,10 +561,30 @@ func mergeConfigs(cc *config.CloudConfig, md datasource.Metadata) (out config.Cl
 	return
 }
 
+// addScripts adds the scripts from the datasource ds to the given scripts,
+// unless they already contain those of a datasource with a higher precedence.
+func addScripts(scripts []config.Script, ds datasource.Datasource, add ...config.Script) []config.Script {
+	if len(scripts) > 0 && len(add) > 0 {
+		fmt.Printf("Ignoring scripts from datasource of type %q\n", ds.Type())
+		return scripts
+	}
+	return append(scripts, add...)
+}
+
 // getDatasources creates a slice of possible Datasources for cloudinit based
 // on the different source command-line flags.
 func getDatasources() []datasource.Datasource {
 	dss := make([]datasource.Datasource, 0, 5)
+	if flags.sources.auto {
+		for _, d := range datasource.Detect(datasource.NewHost()) {
+			ds := d.New()
+			fmt.Printf("Detected datasource of type %q\n", ds.Type())
+			if d.Netconf != "" {
+				detectedNetconf[ds.Type()] = d.Netconf
+			}
+			dss = append(dss, ds)
+		}
+	}
 	if flags.sources.file != "" {
 		dss = append(dss, file.NewDatasource(flags.sources.file))
 	}
@@ -284,12 +606,24 @@ func getDatasources() []datasource.Datasource {
 	if flags.sources.digitalOceanMetadataService != "" {
 		dss = append(dss, digitalocean.NewDatasource(flags.sources.digitalOceanMetadataService))
 	}
+	if flags.sources.gceMetadataService != "" {
+		dss = append(dss, gce.NewDatasource(flags.sources.gceMetadataService))
+	}
+	if flags.sources.openStackMetadataService != "" {
+		dss = append(dss, openstack.NewDatasource(flags.sources.openStackMetadataService))
+	}
 	if flags.sources.waagent != "" {
 		dss = append(dss, waagent.NewDatasource(flags.sources.waagent))
 	}
 	if flags.sources.procCmdLine {
 		dss = append(dss, proc_cmdline.NewDatasource())
 	}
+	if flags.sources.noCloud != "" {
+		dss = append(dss, nocloud.NewDatasource(flags.sources.noCloud))
+	}
+	if flags.sources.noCloudNet {
+		dss = append(dss, nocloud.NewNetworkDatasource())
+	}
 	return dss
 }
 
@@ -297,8 +631,8 @@ func getDatasources() []datasource.Datasource {
 // current availability. The first Datasource to report to be available is
 // returned. Datasources will be retried if possible if they are not
 // immediately available. If all Datasources are permanently unavailable or
-// datasourceTimeout is reached before one becomes available, nil is returned.
-func selectDatasource(sources []datasource.Datasource) datasource.Datasource {
+// timeout is reached before one becomes available, nil is returned.
+func selectDatasource(sources []datasource.Datasource, timeout time.Duration) datasource.Datasource {
 	ds := make(chan datasource.Datasource)
 	stop := make(chan struct{})
 	var wg sync.WaitGroup
@@ -337,22 +671,96 @@ func selectDatasource(sources []datasource.Datasource) datasource.Datasource {
 	select {
 	case s = <-ds:
 	case <-done:
-	case <-time.After(datasourceTimeout):
+	case <-time.After(timeout):
 	}
 
 	close(stop)
 	return s
 }
 
+// selectDatasources waits for the availability of all of the given
+// Datasources and returns those which are available, in the order they were
+// given. Once the first Datasource becomes available, the others are given
+// datasourceMergeWindow to become available too. If no Datasource becomes
+// available before timeout is reached, nil is returned.
+func selectDatasources(sources []datasource.Datasource, timeout time.Duration) []datasource.Datasource {
+	available := make([]bool, len(sources))
+	ds := make(chan int)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for i, s := range sources {
+		wg.Add(1)
+		go func(i int, s datasource.Datasource) {
+			defer wg.Done()
+
+			duration := datasourceInterval
+			for {
+				fmt.Printf("Checking availability of %q\n", s.Type())
+				if s.IsAvailable() {
+					select {
+					case ds <- i:
+					case <-stop:
+					}
+					return
+				} else if !s.AvailabilityChanges() {
+					return
+				}
+				select {
+				case <-stop:
+					return
+				case <-time.After(duration):
+					duration = pkg.ExpBackoff(duration, datasourceMaxInterval)
+				}
+			}
+		}(i, s)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	expired := time.After(timeout)
+	found := false
+wait:
+	for {
+		select {
+		case i := <-ds:
+			available[i] = true
+			if !found {
+				found = true
+				expired = time.After(datasourceMergeWindow)
+			}
+		case <-done:
+			break wait
+		case <-expired:
+			break wait
+		}
+	}
+	close(stop)
+
+	var selected []datasource.Datasource
+	for i, s := range sources {
+		if available[i] {
+			selected = append(selected, s)
+		}
+	}
+	return selected
+}
+
 // TODO(jonboulle): this should probably be refactored and moved into a different module
-func runScript(script config.Script, env *initialize.Environment) error {
+func runScript(script config.Script, env *initialize.Environment, image *system.Offline) error {
 	err := initialize.PrepWorkspace(env.Workspace())
 	if err != nil {
 		fmt.Printf("Failed preparing workspace: %v\n", err)
 		return err
 	}
 	path, err := initialize.PersistScriptInWorkspace(script, env.Workspace())
-	if err == nil {
+	if err == nil && image != nil {
+		return image.QueueScript(path)
+	} else if err == nil {
 		var name string
 		name, err = system.ExecuteScript(path)
 		initialize.PersistUnitNameInWorkspace(name, env.Workspace())
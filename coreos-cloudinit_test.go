@@ -87,3 +87,47 @@ func TestMergeConfigs(t *testing.T) {
 		}
 	}
 }
+
+type staticDatasource struct {
+	available bool
+	name      string
+}
+
+func (s staticDatasource) IsAvailable() bool         { return s.available }
+func (s staticDatasource) AvailabilityChanges() bool { return false }
+func (s staticDatasource) ConfigRoot() string        { return "" }
+func (s staticDatasource) FetchMetadata() (datasource.Metadata, error) {
+	return datasource.Metadata{}, nil
+}
+func (s staticDatasource) FetchUserdata() ([]byte, error) { return nil, nil }
+func (s staticDatasource) Type() string                   { return s.name }
+
+func TestSelectDatasources(t *testing.T) {
+	tests := []struct {
+		sources []datasource.Datasource
+
+		out []datasource.Datasource
+	}{
+		{},
+		{
+			sources: []datasource.Datasource{staticDatasource{false, "a"}},
+		},
+		{
+			sources: []datasource.Datasource{
+				staticDatasource{true, "a"},
+				staticDatasource{false, "b"},
+				staticDatasource{true, "c"},
+			},
+			out: []datasource.Datasource{
+				staticDatasource{true, "a"},
+				staticDatasource{true, "c"},
+			},
+		},
+	}
+	for i, tt := range tests {
+		out := selectDatasources(tt.sources, datasourceTimeout)
+		if !reflect.DeepEqual(tt.out, out) {
+			t.Errorf("bad datasources (%d): want %#v, got %#v", i, tt.out, out)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+)
+
+const (
+	cacheDir       = "cache"
+	instanceIDFile = "instance-id"
+	userdataFile   = "user-data"
+	metadataFile   = "meta-data.json"
+	datasourceFile = "datasource"
+)
+
+// Cache holds the user-data and meta-data which were last fetched
+// successfully from the datasources used by a run, along with the ID of the
+// instance they were fetched for.
+type Cache struct {
+	root   string
+	maxAge time.Duration
+}
+
+// New returns the cache in workspace. Cached data older than maxAge is
+// considered stale and is not used; a maxAge of zero disables this check.
+func New(workspace string, maxAge time.Duration) *Cache {
+	return &Cache{path.Join(workspace, cacheDir), maxAge}
+}
+
+// IsAvailable reports whether there is cached data which isn't stale.
+func (c *Cache) IsAvailable() bool {
+	// The instance ID file marks a complete cache.
+	info, err := os.Stat(path.Join(c.root, instanceIDFile))
+	if err != nil {
+		return false
+	}
+	if c.maxAge > 0 && time.Since(info.ModTime()) > c.maxAge {
+		fmt.Printf("Cached data in %q is older than %s, ignoring\n", c.root, c.maxAge)
+		return false
+	}
+	return true
+}
+
+// InstanceID returns the ID of the instance for which the data was cached.
+func (c *Cache) InstanceID() (string, error) {
+	id, err := ioutil.ReadFile(path.Join(c.root, instanceIDFile))
+	return string(id), err
+}
+
+// Datasources returns a datasource replaying the data of each of the cached
+// datasources, in the order in which they were saved.
+func (c *Cache) Datasources() ([]datasource.Datasource, error) {
+	var dss []datasource.Datasource
+	for i := 0; ; i++ {
+		root := path.Join(c.root, strconv.Itoa(i))
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			return dss, nil
+		} else if err != nil {
+			return nil, err
+		}
+		dss = append(dss, &snapshot{root, ioutil.ReadFile})
+	}
+}
+
+// snapshot replays the user-data and meta-data cached from a single
+// datasource.
+type snapshot struct {
+	root     string
+	readFile func(filename string) ([]byte, error)
+}
+
+func (s *snapshot) IsAvailable() bool {
+	return true
+}
+
+func (s *snapshot) AvailabilityChanges() bool {
+	return false
+}
+
+func (s *snapshot) ConfigRoot() string {
+	return s.root
+}
+
+func (s *snapshot) FetchMetadata() (metadata datasource.Metadata, err error) {
+	if source, err := s.readFile(path.Join(s.root, datasourceFile)); err == nil {
+		fmt.Printf("Replaying data cached from datasource of type %q\n", source)
+	}
+
+	data, err := s.readFile(path.Join(s.root, metadataFile))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &metadata)
+	return
+}
+
+func (s *snapshot) FetchUserdata() ([]byte, error) {
+	return s.readFile(path.Join(s.root, userdataFile))
+}
+
+func (s *snapshot) Type() string {
+	return "cache"
+}
+
+// Snapshot is the data fetched from a datasource of the given type.
+type Snapshot struct {
+	Type     string
+	Userdata []byte
+	Metadata datasource.Metadata
+}
+
+// Save stores the snapshots, in order of precedence, and the ID of the
+// instance for which they were fetched in workspace, replacing any previously
+// cached data.
+func Save(workspace, instanceID string, snapshots []Snapshot) error {
+	if err := os.MkdirAll(workspace, 0700); err != nil {
+		return err
+	}
+	// The cache is assembled next to its final location and then swapped
+	// in, so that it is never left incomplete.
+	tmp, err := ioutil.TempDir(workspace, cacheDir+".")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	for i, snapshot := range snapshots {
+		root := path.Join(tmp, strconv.Itoa(i))
+		if err := os.Mkdir(root, 0700); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(snapshot.Metadata)
+		if err != nil {
+			return err
+		}
+		for _, f := range []struct {
+			name string
+			data []byte
+		}{
+			{userdataFile, snapshot.Userdata},
+			{metadataFile, data},
+			{datasourceFile, []byte(snapshot.Type)},
+		} {
+			if err := ioutil.WriteFile(path.Join(root, f.name), f.data, 0600); err != nil {
+				return err
+			}
+		}
+	}
+	if err := ioutil.WriteFile(path.Join(tmp, instanceIDFile), []byte(instanceID), 0600); err != nil {
+		return err
+	}
+
+	if err := Discard(workspace); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path.Join(workspace, cacheDir))
+}
+
+// Discard removes the cached data from workspace.
+func Discard(workspace string) error {
+	return os.RemoveAll(path.Join(workspace, cacheDir))
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+)
+
+func TestCache(t *testing.T) {
+	workspace, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(workspace)
+
+	if New(workspace, 0).IsAvailable() {
+		t.Fatalf("empty cache reported as available")
+	}
+
+	snapshots := []Snapshot{
+		{
+			Type:     "ec2-metadata-service",
+			Userdata: []byte("#cloud-config\nhostname: test"),
+			Metadata: datasource.Metadata{
+				PrivateIPv4:   net.ParseIP("10.0.0.1"),
+				Hostname:      "host",
+				SSHPublicKeys: map[string]string{"key": "ssh-rsa AAAA"},
+				NetworkConfig: []byte("config"),
+				InstanceID:    "i-1234",
+			},
+		},
+		{
+			Type:     "cloud-drive",
+			Userdata: []byte("#cloud-config\nssh_authorized_keys:\n  - ssh-rsa BBBB"),
+		},
+	}
+	if err := Save(workspace, "i-5678", snapshots[1:]); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := Save(workspace, "i-1234", snapshots); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	c := New(workspace, time.Hour)
+	if !c.IsAvailable() {
+		t.Fatalf("cache not available")
+	}
+	if id, err := c.InstanceID(); err != nil || id != "i-1234" {
+		t.Fatalf("bad instance ID: want %q, got %q (%v)", "i-1234", id, err)
+	}
+	dss, err := c.Datasources()
+	if err != nil || len(dss) != len(snapshots) {
+		t.Fatalf("bad datasources: want %d, got %d (%v)", len(snapshots), len(dss), err)
+	}
+	for i, ds := range dss {
+		if ud, err := ds.FetchUserdata(); err != nil || !reflect.DeepEqual(snapshots[i].Userdata, ud) {
+			t.Errorf("bad user-data (%d): want %q, got %q (%v)", i, snapshots[i].Userdata, ud, err)
+		}
+		if md, err := ds.FetchMetadata(); err != nil || !reflect.DeepEqual(snapshots[i].Metadata, md) {
+			t.Errorf("bad meta-data (%d): want %#v, got %#v (%v)", i, snapshots[i].Metadata, md, err)
+		}
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(path.Join(workspace, cacheDir, instanceIDFile), old, old); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	if c.IsAvailable() {
+		t.Fatalf("stale cache reported as available")
+	}
+	if !New(workspace, 0).IsAvailable() {
+		t.Fatalf("cache without max age not available")
+	}
+
+	if err := Discard(workspace); err != nil {
+		t.Fatalf("Discard failed: %v", err)
+	}
+	if New(workspace, 0).IsAvailable() {
+		t.Fatalf("discarded cache reported as available")
+	}
+}
@@ -15,16 +15,17 @@
 package configdrive
 
 import (
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 
 	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/openstack"
 )
 
 const (
+	DefaultRoot         = "/media/configdrive"
 	openstackApiVersion = "latest"
 )
 
@@ -33,6 +34,16 @@ type configDrive struct {
 	readFile func(filename string) ([]byte, error)
 }
 
+func init() {
+	datasource.RegisterDetector(datasource.Detector{
+		Probe: func(host datasource.Host) bool {
+			return host.HasLabel("config-2") || host.HasLabel("CONFIG-2")
+		},
+		New:     func() datasource.Datasource { return NewDatasource(DefaultRoot) },
+		Netconf: "openstack",
+	})
+}
+
 func NewDatasource(root string) *configDrive {
 	return &configDrive{root, ioutil.ReadFile}
 }
@@ -50,28 +61,10 @@ func (cd *configDrive) ConfigRoot() string {
 	return cd.openstackRoot()
 }
 
-func (cd *configDrive) FetchMetadata() (metadata datasource.Metadata, err error) {
-	var data []byte
-	var m struct {
-		SSHAuthorizedKeyMap map[string]string `json:"public_keys"`
-		Hostname            string            `json:"hostname"`
-		NetworkConfig       struct {
-			ContentPath string `json:"content_path"`
-		} `json:"network_config"`
-	}
-
-	if data, err = cd.tryReadFile(path.Join(cd.openstackVersionRoot(), "meta_data.json")); err != nil {
-		return
-	}
-	if err = json.Unmarshal([]byte(data), &m); err != nil {
-		return
-	}
-
-	metadata.SSHPublicKeys = m.SSHAuthorizedKeyMap
-	metadata.Hostname = m.Hostname
-	metadata.NetworkConfig, err = cd.tryReadFile(path.Join(cd.openstackRoot(), m.NetworkConfig.ContentPath))
-
-	return
+func (cd *configDrive) FetchMetadata() (datasource.Metadata, error) {
+	return openstack.ReadMetadata(func(name string) ([]byte, error) {
+		return cd.tryReadFile(path.Join(cd.openstackRoot(), name))
+	})
 }
 
 func (cd *configDrive) FetchUserdata() ([]byte, error) {
@@ -53,6 +53,17 @@ func TestFetchMetadata(t *testing.T) {
 				},
 			},
 		},
+		{
+			root: "/media/configdrive",
+			files: test.MockFilesystem{
+				"/media/configdrive/openstack/latest/meta_data.json":    `{"name": "host"}`,
+				"/media/configdrive/openstack/latest/network_data.json": `{"links": []}`,
+			},
+			metadata: datasource.Metadata{
+				Hostname:      "host",
+				NetworkConfig: []byte(`{"links": []}`),
+			},
+		},
 	} {
 		cd := configDrive{tt.root, tt.files.ReadFile}
 		metadata, err := cd.FetchMetadata()
@@ -28,11 +28,72 @@ type Datasource interface {
 }
 
 type Metadata struct {
-	PublicIPv4    net.IP
-	PublicIPv6    net.IP
-	PrivateIPv4   net.IP
-	PrivateIPv6   net.IP
-	Hostname      string
-	SSHPublicKeys map[string]string
-	NetworkConfig []byte
+	PublicIPv4        net.IP
+	PublicIPv6        net.IP
+	PrivateIPv4       net.IP
+	PrivateIPv6       net.IP
+	Hostname          string
+	SSHPublicKeys     map[string]string
+	NetworkConfig     []byte
+	NetworkInterfaces []NetworkInterface
+	InstanceID        string
+	AvailabilityZone  string
+	Region            string
+}
+
+// NetworkInterface holds the addresses assigned to a single NIC.
+type NetworkInterface struct {
+	MAC         string
+	PublicIPv4  []net.IP
+	PrivateIPv4 []net.IP
+	IPv6        []net.IP
+}
+
+// MergeMetadata combines the given metadata, which is ordered from highest to
+// lowest precedence. Each field is taken from the metadata with the highest
+// precedence which sets it, with the exception of the SSH public keys, which
+// are combined (a key with the same name is taken from the metadata with the
+// highest precedence).
+func MergeMetadata(metadata ...Metadata) (out Metadata) {
+	for _, m := range metadata {
+		if out.PublicIPv4 == nil {
+			out.PublicIPv4 = m.PublicIPv4
+		}
+		if out.PublicIPv6 == nil {
+			out.PublicIPv6 = m.PublicIPv6
+		}
+		if out.PrivateIPv4 == nil {
+			out.PrivateIPv4 = m.PrivateIPv4
+		}
+		if out.PrivateIPv6 == nil {
+			out.PrivateIPv6 = m.PrivateIPv6
+		}
+		if out.Hostname == "" {
+			out.Hostname = m.Hostname
+		}
+		for name, key := range m.SSHPublicKeys {
+			if out.SSHPublicKeys == nil {
+				out.SSHPublicKeys = map[string]string{}
+			}
+			if _, ok := out.SSHPublicKeys[name]; !ok {
+				out.SSHPublicKeys[name] = key
+			}
+		}
+		if out.NetworkConfig == nil {
+			out.NetworkConfig = m.NetworkConfig
+		}
+		if out.NetworkInterfaces == nil {
+			out.NetworkInterfaces = m.NetworkInterfaces
+		}
+		if out.InstanceID == "" {
+			out.InstanceID = m.InstanceID
+		}
+		if out.AvailabilityZone == "" {
+			out.AvailabilityZone = m.AvailabilityZone
+		}
+		if out.Region == "" {
+			out.Region = m.Region
+		}
+	}
+	return
 }
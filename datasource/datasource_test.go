@@ -0,0 +1,61 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasource
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestMergeMetadata(t *testing.T) {
+	for _, tt := range []struct {
+		metadata []Metadata
+		merged   Metadata
+	}{
+		{},
+		{
+			metadata: []Metadata{{Hostname: "first"}, {Hostname: "second"}},
+			merged:   Metadata{Hostname: "first"},
+		},
+		{
+			metadata: []Metadata{
+				{
+					PrivateIPv4:   net.ParseIP("10.0.0.1"),
+					SSHPublicKeys: map[string]string{"a": "key-a"},
+				},
+				{
+					PrivateIPv4:   net.ParseIP("10.0.0.2"),
+					PublicIPv4:    net.ParseIP("192.0.2.1"),
+					SSHPublicKeys: map[string]string{"a": "other-a", "b": "key-b"},
+					NetworkConfig: []byte("config"),
+					InstanceID:    "i-1234",
+				},
+			},
+			merged: Metadata{
+				PrivateIPv4:   net.ParseIP("10.0.0.1"),
+				PublicIPv4:    net.ParseIP("192.0.2.1"),
+				SSHPublicKeys: map[string]string{"a": "key-a", "b": "key-b"},
+				NetworkConfig: []byte("config"),
+				InstanceID:    "i-1234",
+			},
+		},
+	} {
+		merged := MergeMetadata(tt.metadata...)
+		if !reflect.DeepEqual(tt.merged, merged) {
+			t.Errorf("bad merge (%+v): want %+v, got %+v", tt.metadata, tt.merged, merged)
+		}
+	}
+}
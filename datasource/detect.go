@@ -0,0 +1,118 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasource
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// Detector describes a cheap probe which reports whether a datasource is
+// plausibly present on the host. Probes may only inspect local state (DMI,
+// block device labels, hypervisor markers, the kernel command line); they must
+// never touch the network.
+type Detector struct {
+	// Probe reports whether the datasource could be present on the host.
+	Probe func(host Host) bool
+	// New creates the datasource with its platform defaults.
+	New func() Datasource
+	// Netconf is the --convert-netconf format to use with the datasource,
+	// if any.
+	Netconf string
+}
+
+var detectors []Detector
+
+// RegisterDetector adds a detector to the registry. It is meant to be called
+// from the init function of a datasource package.
+func RegisterDetector(d Detector) {
+	detectors = append(detectors, d)
+}
+
+// Detect returns the registered detectors whose probe matches the host, in
+// registration order.
+func Detect(host Host) []Detector {
+	var found []Detector
+	for _, d := range detectors {
+		if d.Probe(host) {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// Host provides read-only access to the hardware and kernel details used by
+// detectors. All paths are relative to Root.
+type Host struct {
+	Root string
+}
+
+// NewHost returns a Host backed by the running system.
+func NewHost() Host {
+	return Host{Root: "/"}
+}
+
+// DMI returns the value of the given DMI/SMBIOS field (e.g. sys_vendor or
+// product_name), or an empty string if it cannot be read.
+func (h Host) DMI(field string) string {
+	return h.read(path.Join("sys/class/dmi/id", field))
+}
+
+// HasLabel reports whether a block device with the given filesystem label
+// exists.
+func (h Host) HasLabel(label string) bool {
+	return h.exists(path.Join("dev/disk/by-label", label))
+}
+
+// Hypervisor returns the type of hypervisor the host is running on ("xen" or
+// "hyperv"), or an empty string if none could be identified.
+func (h Host) Hypervisor() string {
+	if t := h.read("sys/hypervisor/type"); t != "" {
+		return t
+	}
+	if h.exists("proc/xen") {
+		return "xen"
+	}
+	if h.exists("sys/bus/vmbus") {
+		return "hyperv"
+	}
+	return ""
+}
+
+// HypervisorUUID returns the UUID exposed by the hypervisor (currently only
+// Xen), or an empty string if none is available.
+func (h Host) HypervisorUUID() string {
+	return h.read("sys/hypervisor/uuid")
+}
+
+// Cmdline returns the kernel command line.
+func (h Host) Cmdline() string {
+	return h.read("proc/cmdline")
+}
+
+func (h Host) read(name string) string {
+	data, err := ioutil.ReadFile(path.Join(h.Root, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func (h Host) exists(name string) bool {
+	_, err := os.Stat(path.Join(h.Root, name))
+	return err == nil
+}
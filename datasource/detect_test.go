@@ -0,0 +1,136 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasource
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func writeHostFiles(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	for name, contents := range files {
+		p := path.Join(root, name)
+		if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+			t.Fatalf("Unable to create directory: %v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatalf("Unable to write file: %v", err)
+		}
+	}
+	return root
+}
+
+func TestHost(t *testing.T) {
+	for _, tt := range []struct {
+		files      map[string]string
+		vendor     string
+		label      bool
+		hypervisor string
+		cmdline    string
+	}{
+		{},
+		{
+			files: map[string]string{
+				"sys/class/dmi/id/sys_vendor": "Amazon EC2\n",
+				"sys/hypervisor/type":         "xen\n",
+			},
+			vendor:     "Amazon EC2",
+			hypervisor: "xen",
+		},
+		{
+			files: map[string]string{
+				"dev/disk/by-label/config-2": "",
+				"proc/xen/capabilities":      "",
+				"proc/cmdline":               "root=/dev/sda1 ds=nocloud\n",
+			},
+			label:      true,
+			hypervisor: "xen",
+			cmdline:    "root=/dev/sda1 ds=nocloud",
+		},
+		{
+			files: map[string]string{
+				"sys/bus/vmbus/drivers/hv_netvsc": "",
+			},
+			hypervisor: "hyperv",
+		},
+	} {
+		root := writeHostFiles(t, tt.files)
+		defer os.RemoveAll(root)
+
+		host := Host{Root: root}
+		if vendor := host.DMI("sys_vendor"); vendor != tt.vendor {
+			t.Errorf("bad vendor (%q): want %q, got %q", tt.files, tt.vendor, vendor)
+		}
+		if label := host.HasLabel("config-2"); label != tt.label {
+			t.Errorf("bad label (%q): want %t, got %t", tt.files, tt.label, label)
+		}
+		if hypervisor := host.Hypervisor(); hypervisor != tt.hypervisor {
+			t.Errorf("bad hypervisor (%q): want %q, got %q", tt.files, tt.hypervisor, hypervisor)
+		}
+		if cmdline := host.Cmdline(); cmdline != tt.cmdline {
+			t.Errorf("bad cmdline (%q): want %q, got %q", tt.files, tt.cmdline, cmdline)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	defer func(d []Detector) { detectors = d }(detectors)
+	detectors = nil
+
+	RegisterDetector(Detector{
+		Probe:   func(host Host) bool { return host.DMI("sys_vendor") == "DigitalOcean" },
+		Netconf: "digitalocean",
+	})
+	RegisterDetector(Detector{
+		Probe:   func(host Host) bool { return host.HasLabel("config-2") },
+		Netconf: "openstack",
+	})
+
+	for _, tt := range []struct {
+		files  map[string]string
+		expect []string
+	}{
+		{},
+		{
+			files:  map[string]string{"dev/disk/by-label/config-2": ""},
+			expect: []string{"openstack"},
+		},
+		{
+			files: map[string]string{
+				"sys/class/dmi/id/sys_vendor": "DigitalOcean\n",
+				"dev/disk/by-label/config-2":  "",
+			},
+			expect: []string{"digitalocean", "openstack"},
+		},
+	} {
+		root := writeHostFiles(t, tt.files)
+		defer os.RemoveAll(root)
+
+		var found []string
+		for _, d := range Detect(Host{Root: root}) {
+			found = append(found, d.Netconf)
+		}
+		if !reflect.DeepEqual(tt.expect, found) {
+			t.Errorf("bad detection (%q): want %q, got %q", tt.files, tt.expect, found)
+		}
+	}
+}
@@ -21,7 +21,6 @@ import (
 	"errors"
 	"io/ioutil"
 	"net"
-	"os"
 	"strings"
 
 	"github.com/coreos/coreos-cloudinit/datasource"
@@ -42,6 +41,15 @@ type serverContextService struct {
 	}
 }
 
+func init() {
+	datasource.RegisterDetector(datasource.Detector{
+		Probe: func(host datasource.Host) bool {
+			return host.DMI("product_name") == "CloudSigma"
+		},
+		New: func() datasource.Datasource { return NewServerContextService() },
+	})
+}
+
 func NewServerContextService() *serverContextService {
 	return &serverContextService{
 		client: cepgo.NewCepgo(),
@@ -49,14 +57,7 @@ func NewServerContextService() *serverContextService {
 }
 
 func (_ *serverContextService) IsAvailable() bool {
-	productNameFile, err := os.Open("/sys/class/dmi/id/product_name")
-	if err != nil {
-		return false
-	}
-	productName := make([]byte, 10)
-	_, err = productNameFile.Read(productName)
-
-	return err == nil && string(productName) == "CloudSigma" && hasDHCPLeases()
+	return datasource.NewHost().DMI("product_name") == "CloudSigma" && hasDHCPLeases()
 }
 
 func (_ *serverContextService) AvailabilityChanges() bool {
@@ -101,6 +102,7 @@ func (scs *serverContextService) FetchMetadata() (metadata datasource.Metadata,
 		return
 	}
 
+	metadata.InstanceID = inputMetadata.UUID
 	if inputMetadata.Name != "" {
 		metadata.Hostname = inputMetadata.Name
 	} else {
@@ -113,6 +113,10 @@ func TestServerContextFetchMetadata(t *testing.T) {
 		t.Error(err.Error())
 	}
 
+	if metadata.InstanceID != "20a0059b-041e-4d0c-bcc6-9b2852de48b3" {
+		t.Errorf("Instance ID is not '20a0059b-041e-4d0c-bcc6-9b2852de48b3' but %s instead", metadata.InstanceID)
+	}
+
 	if metadata.Hostname != "coreos" {
 		t.Errorf("Hostname is not 'coreos' but %s instead", metadata.Hostname)
 	}
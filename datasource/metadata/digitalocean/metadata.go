@@ -54,6 +54,7 @@ type DNS struct {
 }
 
 type Metadata struct {
+	DropletID  int        `json:"droplet_id"`
 	Hostname   string     `json:"hostname"`
 	Interfaces Interfaces `json:"interfaces"`
 	PublicKeys []string   `json:"public_keys"`
@@ -64,8 +65,18 @@ type metadataService struct {
 	metadata.MetadataService
 }
 
+func init() {
+	datasource.RegisterDetector(datasource.Detector{
+		Probe: func(host datasource.Host) bool {
+			return host.DMI("sys_vendor") == "DigitalOcean"
+		},
+		New:     func() datasource.Datasource { return NewDatasource(DefaultAddress) },
+		Netconf: "digitalocean",
+	})
+}
+
 func NewDatasource(root string) *metadataService {
-	return &metadataService{MetadataService: metadata.NewDatasource(root, apiVersion, userdataUrl, metadataPath)}
+	return &metadataService{MetadataService: metadata.NewDatasource(root, apiVersion, userdataUrl, metadataPath, nil)}
 }
 
 func (ms *metadataService) FetchMetadata() (metadata datasource.Metadata, err error) {
@@ -95,6 +106,9 @@ func (ms *metadataService) FetchMetadata() (metadata datasource.Metadata, err er
 			metadata.PrivateIPv6 = net.ParseIP(m.Interfaces.Private[0].IPv6.IPAddress)
 		}
 	}
+	if m.DropletID != 0 {
+		metadata.InstanceID = strconv.Itoa(m.DropletID)
+	}
 	metadata.Hostname = m.Hostname
 	metadata.SSHPublicKeys = map[string]string{}
 	for i, key := range m.PublicKeys {
@@ -18,8 +18,14 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"log"
 	"net"
+	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/coreos/coreos-cloudinit/datasource"
 	"github.com/coreos/coreos-cloudinit/datasource/metadata"
@@ -28,17 +34,41 @@ import (
 
 const (
 	DefaultAddress = "http://169.254.169.254/"
-	apiVersion     = "2009-04-04/"
+	apiVersion     = "latest/"
 	userdataPath   = apiVersion + "user-data"
 	metadataPath   = apiVersion + "meta-data"
+
+	tokenPath      = "latest/api/token"
+	tokenHeader    = "X-aws-ec2-metadata-token"
+	tokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	tokenTTL       = 6 * time.Hour
+	tokenRetries   = 3
 )
 
 type metadataService struct {
 	metadata.MetadataService
 }
 
+func init() {
+	datasource.RegisterDetector(datasource.Detector{
+		Probe: func(host datasource.Host) bool {
+			return host.DMI("sys_vendor") == "Amazon EC2" ||
+				strings.HasPrefix(strings.ToLower(host.DMI("product_uuid")), "ec2") ||
+				strings.HasPrefix(strings.ToLower(host.HypervisorUUID()), "ec2")
+		},
+		New: func() datasource.Datasource { return NewDatasource(DefaultAddress) },
+	})
+}
+
 func NewDatasource(root string) *metadataService {
-	return &metadataService{metadata.NewDatasource(root, apiVersion, userdataPath, metadataPath)}
+	ms := metadata.NewDatasource(root, apiVersion, userdataPath, metadataPath, nil)
+	client := pkg.NewHttpClient()
+	client.ReportUnauthorized = true
+	ms.Client = &tokenClient{
+		tokenUrl: ms.Root + tokenPath,
+		client:   client,
+	}
+	return &metadataService{ms}
 }
 
 func (ms metadataService) FetchMetadata() (datasource.Metadata, error) {
@@ -85,13 +115,191 @@ func (ms metadataService) FetchMetadata() (datasource.Metadata, error) {
 		return metadata, err
 	}
 
+	for attr, value := range map[string]*string{
+		"instance-id":                 &metadata.InstanceID,
+		"placement/availability-zone": &metadata.AvailabilityZone,
+		"placement/region":            &metadata.Region,
+	} {
+		if v, err := ms.fetchAttribute(fmt.Sprintf("%s/%s", ms.MetadataUrl(), attr)); err == nil {
+			*value = v
+		} else if _, ok := err.(pkg.ErrNotFound); !ok {
+			return metadata, err
+		}
+	}
+
+	if err := ms.fetchNetworkInterfaces(&metadata); err != nil {
+		return metadata, err
+	}
+
 	return metadata, nil
 }
 
+// fetchNetworkInterfaces walks network/interfaces/macs, ordering the NICs by
+// their device number. The first IPv6 address of the primary NIC is used as
+// both the public and the private IPv6 address since EC2 doesn't NAT IPv6.
+func (ms metadataService) fetchNetworkInterfaces(metadata *datasource.Metadata) error {
+	macsUrl := fmt.Sprintf("%s/network/interfaces/macs", ms.MetadataUrl())
+	macs, err := ms.fetchAttributes(macsUrl)
+	if err != nil {
+		if _, ok := err.(pkg.ErrNotFound); ok {
+			return nil
+		}
+		return err
+	}
+
+	nics := map[int]datasource.NetworkInterface{}
+	for _, mac := range macs {
+		mac = strings.TrimSuffix(mac, "/")
+		nicUrl := fmt.Sprintf("%s/%s", macsUrl, mac)
+
+		number, err := ms.fetchAttribute(nicUrl + "/device-number")
+		if err != nil {
+			return err
+		}
+		device, err := strconv.Atoi(number)
+		if err != nil {
+			return fmt.Errorf("malformed device number for %q: %q", mac, number)
+		}
+
+		nic := datasource.NetworkInterface{MAC: mac}
+		for attr, ips := range map[string]*[]net.IP{
+			"local-ipv4s":  &nic.PrivateIPv4,
+			"public-ipv4s": &nic.PublicIPv4,
+			"ipv6s":        &nic.IPv6,
+		} {
+			if *ips, err = ms.fetchIPs(fmt.Sprintf("%s/%s", nicUrl, attr)); err != nil {
+				return err
+			}
+		}
+		nics[device] = nic
+	}
+
+	devices := make([]int, 0, len(nics))
+	for device := range nics {
+		devices = append(devices, device)
+	}
+	sort.Ints(devices)
+	for _, device := range devices {
+		metadata.NetworkInterfaces = append(metadata.NetworkInterfaces, nics[device])
+	}
+
+	if len(devices) > 0 && devices[0] == 0 && len(nics[0].IPv6) > 0 {
+		metadata.PrivateIPv6 = nics[0].IPv6[0]
+		metadata.PublicIPv6 = nics[0].IPv6[0]
+	}
+	return nil
+}
+
 func (ms metadataService) Type() string {
 	return "ec2-metadata-service"
 }
 
+type tokenPutter interface {
+	pkg.Getter
+	Put(string, http.Header) ([]byte, error)
+	SetHeader(string, string)
+}
+
+// tokenClient makes requests using IMDSv2 session tokens. A token is
+// requested before the first request, again when it is about to expire and
+// whenever the service rejects the current one. If the service doesn't
+// support tokens, requests are made without them (IMDSv1).
+type tokenClient struct {
+	tokenUrl string
+	client   tokenPutter
+
+	mutex   sync.Mutex
+	token   string
+	expires time.Time
+	v1      bool
+}
+
+func (c *tokenClient) Get(url string) ([]byte, error) {
+	return c.do(url, c.client.Get)
+}
+
+func (c *tokenClient) GetRetry(url string) ([]byte, error) {
+	return c.do(url, c.client.GetRetry)
+}
+
+func (c *tokenClient) do(url string, get func(string) ([]byte, error)) ([]byte, error) {
+	if err := c.ensureToken(""); err != nil {
+		return nil, err
+	}
+
+	data, err := get(url)
+	if _, ok := err.(pkg.ErrUnauthorized); ok {
+		log.Printf("Metadata token rejected, requesting a new one")
+		if err := c.ensureToken(c.currentToken()); err != nil {
+			return nil, err
+		}
+		data, err = get(url)
+	}
+	// A 401 which persists means that the service requires tokens but
+	// none could be obtained. It is returned as is, rather than as not
+	// found, so that the datasource fails instead of providing no data.
+	return data, err
+}
+
+func (c *tokenClient) currentToken() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.token
+}
+
+// ensureToken requests a new token if there is none, if it is about to expire
+// or if it is the given rejected one.
+func (c *tokenClient) ensureToken(rejected string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.v1 || (c.token != "" && c.token != rejected && time.Now().Before(c.expires)) {
+		return nil
+	}
+
+	token, err := c.putToken()
+	switch err.(type) {
+	case nil:
+		c.token = strings.TrimSpace(string(token))
+		// Renew the token a minute early, so that it doesn't expire
+		// while a request is retried.
+		c.expires = time.Now().Add(tokenTTL - time.Minute)
+		c.client.SetHeader(tokenHeader, c.token)
+		return nil
+	case pkg.ErrNotFound:
+		log.Printf("Metadata service doesn't support session tokens, falling back to IMDSv1")
+		c.v1 = true
+		return nil
+	case pkg.ErrNetwork, pkg.ErrServer:
+		// Some proxies and older emulations of the service fail the PUT
+		// outright. Try without a token, and for one again on the next
+		// request.
+		log.Printf("Failed requesting a metadata token, trying IMDSv1: %v", err)
+		return nil
+	default:
+		return err
+	}
+}
+
+// putToken requests a token, retrying on transport and server errors.
+func (c *tokenClient) putToken() ([]byte, error) {
+	header := http.Header{tokenTTLHeader: {strconv.Itoa(int(tokenTTL / time.Second))}}
+	duration := 50 * time.Millisecond
+	for retry := 1; ; retry++ {
+		token, err := c.client.Put(c.tokenUrl, header)
+		switch err.(type) {
+		case pkg.ErrNetwork, pkg.ErrServer:
+			if retry < tokenRetries {
+				log.Printf("Failed requesting a metadata token: %v", err)
+				duration = pkg.ExpBackoff(duration, time.Second)
+				time.Sleep(duration)
+				continue
+			}
+		}
+		return token, err
+	}
+}
+
 func (ms metadataService) fetchAttributes(url string) ([]string, error) {
 	resp, err := ms.FetchData(url)
 	if err != nil {
@@ -105,6 +313,22 @@ func (ms metadataService) fetchAttributes(url string) ([]string, error) {
 	return data, scanner.Err()
 }
 
+func (ms metadataService) fetchIPs(url string) ([]net.IP, error) {
+	attrs, err := ms.fetchAttributes(url)
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, attr := range attrs {
+		ip := net.ParseIP(attr)
+		if ip == nil {
+			return nil, fmt.Errorf("malformed IP address: %q", attr)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
 func (ms metadataService) fetchAttribute(url string) (string, error) {
 	if attrs, err := ms.fetchAttributes(url); err == nil && len(attrs) > 0 {
 		return attrs[0], nil
@@ -17,7 +17,10 @@ package ec2
 import (
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/coreos/coreos-cloudinit/datasource"
@@ -194,6 +197,59 @@ func TestFetchMetadata(t *testing.T) {
 				SSHPublicKeys: map[string]string{"test1": "key"},
 			},
 		},
+		{
+			root:         "/",
+			metadataPath: "latest/meta-data",
+			resources: map[string]string{
+				"/latest/meta-data/hostname":                                                "host",
+				"/latest/meta-data/local-ipv4":                                              "1.2.3.4",
+				"/latest/meta-data/public-ipv4":                                             "5.6.7.8",
+				"/latest/meta-data/instance-id":                                             "i-1234",
+				"/latest/meta-data/placement/availability-zone":                             "us-west-2a",
+				"/latest/meta-data/placement/region":                                        "us-west-2",
+				"/latest/meta-data/network/interfaces/macs":                                 "0a:00:00:00:00:02/\n0a:00:00:00:00:01/\n",
+				"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:01/device-number": "0",
+				"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:01/local-ipv4s":   "1.2.3.4\n1.2.3.5",
+				"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:01/public-ipv4s":  "5.6.7.8",
+				"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:01/ipv6s":         "2001:db8::1",
+				"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:02/device-number": "1",
+				"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:02/local-ipv4s":   "10.0.0.2",
+			},
+			expect: datasource.Metadata{
+				Hostname:         "host",
+				PrivateIPv4:      net.ParseIP("1.2.3.4"),
+				PublicIPv4:       net.ParseIP("5.6.7.8"),
+				PrivateIPv6:      net.ParseIP("2001:db8::1"),
+				PublicIPv6:       net.ParseIP("2001:db8::1"),
+				InstanceID:       "i-1234",
+				AvailabilityZone: "us-west-2a",
+				Region:           "us-west-2",
+				SSHPublicKeys:    map[string]string{},
+				NetworkInterfaces: []datasource.NetworkInterface{
+					{
+						MAC:         "0a:00:00:00:00:01",
+						PrivateIPv4: []net.IP{net.ParseIP("1.2.3.4"), net.ParseIP("1.2.3.5")},
+						PublicIPv4:  []net.IP{net.ParseIP("5.6.7.8")},
+						IPv6:        []net.IP{net.ParseIP("2001:db8::1")},
+					},
+					{
+						MAC:         "0a:00:00:00:00:02",
+						PrivateIPv4: []net.IP{net.ParseIP("10.0.0.2")},
+					},
+				},
+			},
+		},
+		{
+			root:         "/",
+			metadataPath: "latest/meta-data",
+			resources: map[string]string{
+				"/latest/meta-data/network/interfaces/macs":                                 "0a:00:00:00:00:01/",
+				"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:01/device-number": "0",
+				"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:01/local-ipv4s":   "bad",
+			},
+			expect:    datasource.Metadata{SSHPublicKeys: map[string]string{}},
+			expectErr: fmt.Errorf("malformed IP address: \"bad\""),
+		},
 		{
 			clientErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
 			expectErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
@@ -214,6 +270,137 @@ func TestFetchMetadata(t *testing.T) {
 	}
 }
 
+func TestTokenClient(t *testing.T) {
+	for _, tt := range []struct {
+		tokens    bool
+		putFails  bool
+		required  bool
+		expire    bool
+		data      string
+		expectErr error
+		puts      int
+	}{
+		{
+			// IMDSv2 is required and the token is used
+			tokens:   true,
+			required: true,
+			data:     "data",
+			puts:     1,
+		},
+		{
+			// the token is refreshed when it is rejected
+			tokens:   true,
+			required: true,
+			expire:   true,
+			data:     "data",
+			puts:     2,
+		},
+		{
+			// tokens aren't supported, so fall back to IMDSv1
+			tokens: false,
+			data:   "data",
+			puts:   1,
+		},
+		{
+			// token requests keep failing, so they are retried and
+			// then IMDSv1 is tried
+			tokens:   true,
+			putFails: true,
+			data:     "data",
+			puts:     tokenRetries,
+		},
+		{
+			// tokens are required but not supported, which
+			// must fail rather than look like missing data
+			tokens:    false,
+			required:  true,
+			expectErr: pkg.ErrUnauthorized{Err: fmt.Errorf("Unauthorized. HTTP status code: 401")},
+			puts:      1,
+		},
+	} {
+		puts := 0
+		token := ""
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/latest/api/token":
+				puts++
+				if tt.putFails {
+					http.Error(w, "", 500)
+					return
+				}
+				if !tt.tokens || r.Method != "PUT" {
+					http.Error(w, "", 405)
+					return
+				}
+				if r.Header.Get(tokenTTLHeader) == "" {
+					http.Error(w, "", 400)
+					return
+				}
+				token = fmt.Sprintf("token%d", puts)
+				fmt.Fprint(w, token)
+			case tt.required && (token == "" || r.Header.Get(tokenHeader) != token):
+				http.Error(w, "", 401)
+			case tt.expire && puts == 1:
+				// expire the first token
+				http.Error(w, "", 401)
+			default:
+				fmt.Fprint(w, "data")
+			}
+		}))
+
+		service := NewDatasource(ts.URL)
+		data, err := service.Client.GetRetry(ts.URL + "/" + userdataPath)
+		if Error(err) != Error(tt.expectErr) {
+			t.Fatalf("bad error (%+v): want %q, got %q", tt, tt.expectErr, err)
+		}
+		if reflect.TypeOf(err) != reflect.TypeOf(tt.expectErr) {
+			t.Fatalf("bad error type (%+v): want %T, got %T", tt, tt.expectErr, err)
+		}
+		if string(data) != tt.data {
+			t.Fatalf("bad data (%+v): want %q, got %q", tt, tt.data, data)
+		}
+		if puts != tt.puts {
+			t.Fatalf("bad number of token requests (%+v): want %d, got %d", tt, tt.puts, puts)
+		}
+		if _, err := service.FetchUserdata(); (err != nil) != (tt.expectErr != nil) {
+			t.Fatalf("bad error fetching user-data (%+v): want %v, got %v", tt, tt.expectErr, err)
+		}
+		ts.Close()
+	}
+}
+
+func TestTokenClientConcurrently(t *testing.T) {
+	var mutex sync.Mutex
+	token := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case r.URL.Path == "/latest/api/token":
+			token = "token"
+			fmt.Fprint(w, token)
+		case r.Header.Get(tokenHeader) != token:
+			http.Error(w, "", 401)
+		default:
+			fmt.Fprint(w, "data")
+		}
+	}))
+	defer ts.Close()
+
+	service := NewDatasource(ts.URL)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if data, err := service.Client.Get(ts.URL + "/" + userdataPath); err != nil || string(data) != "data" {
+				t.Errorf("bad response: %q, %v", data, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func Error(err error) string {
 	if err != nil {
 		return err.Error()
@@ -0,0 +1,134 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gce
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+)
+
+const (
+	DefaultAddress = "http://metadata.google.internal/"
+	apiVersion     = "computeMetadata/v1/"
+	metadataPath   = apiVersion
+	userdataPath   = apiVersion + "instance/attributes/user-data"
+)
+
+type metadataService struct {
+	metadata.MetadataService
+}
+
+func init() {
+	datasource.RegisterDetector(datasource.Detector{
+		Probe: func(host datasource.Host) bool {
+			return host.DMI("product_name") == "Google Compute Engine" ||
+				host.DMI("sys_vendor") == "Google"
+		},
+		New: func() datasource.Datasource { return NewDatasource(DefaultAddress) },
+	})
+}
+
+func NewDatasource(root string) *metadataService {
+	return &metadataService{metadata.NewDatasource(root, apiVersion, userdataPath, metadataPath, http.Header{"Metadata-Flavor": {"Google"}})}
+}
+
+func (ms metadataService) FetchMetadata() (datasource.Metadata, error) {
+	public, err := ms.fetchIP("instance/network-interfaces/0/access-configs/0/external-ip")
+	if err != nil {
+		return datasource.Metadata{}, err
+	}
+	local, err := ms.fetchIP("instance/network-interfaces/0/ip")
+	if err != nil {
+		return datasource.Metadata{}, err
+	}
+	hostname, err := ms.fetchString("instance/hostname")
+	if err != nil {
+		return datasource.Metadata{}, err
+	}
+	id, err := ms.fetchString("instance/id")
+	if err != nil {
+		return datasource.Metadata{}, err
+	}
+
+	// Keys may be provided through either the current "ssh-keys" attribute
+	// or the deprecated "sshKeys" attribute, at the project or instance level.
+	var keyStrings []string
+	for _, key := range []string{
+		"project/attributes/ssh-keys",
+		"project/attributes/sshKeys",
+		"instance/attributes/ssh-keys",
+		"instance/attributes/sshKeys",
+	} {
+		keys, err := ms.fetchString(key)
+		if err != nil {
+			return datasource.Metadata{}, err
+		}
+		keyStrings = append(keyStrings, strings.Split(keys, "\n")...)
+	}
+
+	sshPublicKeys := map[string]string{}
+	for _, keyString := range keyStrings {
+		// Each line has the form "<username>:<public key>".
+		keySlice := strings.SplitN(strings.TrimSpace(keyString), ":", 2)
+		if len(keySlice) != 2 || keySlice[1] == "" {
+			continue
+		}
+		sshPublicKeys["sshkey-"+strconv.Itoa(len(sshPublicKeys))] = keySlice[1]
+	}
+
+	return datasource.Metadata{
+		PublicIPv4:    public,
+		PrivateIPv4:   local,
+		Hostname:      hostname,
+		InstanceID:    id,
+		SSHPublicKeys: sshPublicKeys,
+	}, nil
+}
+
+func (ms metadataService) Type() string {
+	return "gce-metadata-service"
+}
+
+func (ms metadataService) fetchString(key string) (string, error) {
+	data, err := ms.FetchData(ms.MetadataUrl() + key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (ms metadataService) fetchIP(key string) (net.IP, error) {
+	str, err := ms.fetchString(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if str == "" {
+		return nil, nil
+	}
+
+	if ip := net.ParseIP(str); ip != nil {
+		return ip, nil
+	} else {
+		return nil, fmt.Errorf("couldn't parse %q as IP address", str)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+)
+
+const (
+	DefaultAddress = "http://169.254.169.254/"
+	apiVersion     = "openstack/latest/"
+	userdataPath   = apiVersion + "user_data"
+	metadataPath   = apiVersion + "meta_data.json"
+
+	// The EC2-compatible API is served next to the OpenStack one and is the
+	// only place the instance's addresses are published.
+	ec2MetadataPath = "latest/meta-data/"
+)
+
+// NetworkData is the contents of openstack/<version>/network_data.json.
+type NetworkData struct {
+	Links    []Link    `json:"links"`
+	Networks []Network `json:"networks"`
+	Services []Service `json:"services"`
+}
+
+type Link struct {
+	ID                 string   `json:"id"`
+	Type               string   `json:"type"`
+	EthernetMACAddress string   `json:"ethernet_mac_address"`
+	MTU                int      `json:"mtu"`
+	BondMode           string   `json:"bond_mode"`
+	BondLinks          []string `json:"bond_links"`
+	BondMIIMon         int      `json:"bond_miimon"`
+	BondHashPolicy     string   `json:"bond_xmit_hash_policy"`
+	VLANLink           string   `json:"vlan_link"`
+	VLANID             int      `json:"vlan_id"`
+	VLANMACAddress     string   `json:"vlan_mac_address"`
+}
+
+type Network struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Link      string    `json:"link"`
+	IPAddress string    `json:"ip_address"`
+	Netmask   string    `json:"netmask"`
+	Routes    []Route   `json:"routes"`
+	Services  []Service `json:"services"`
+}
+
+type Route struct {
+	Network string `json:"network"`
+	Netmask string `json:"netmask"`
+	Gateway string `json:"gateway"`
+}
+
+type Service struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+type NetworkConfig struct {
+	ContentPath string `json:"content_path"`
+}
+
+type Metadata struct {
+	UUID          string            `json:"uuid"`
+	Name          string            `json:"name"`
+	Hostname      string            `json:"hostname"`
+	PublicKeys    map[string]string `json:"public_keys"`
+	NetworkConfig NetworkConfig     `json:"network_config"`
+}
+
+// ReadMetadata parses the OpenStack metadata tree shared by the config-drive
+// and the metadata service. The read function is given paths relative to the
+// "openstack" directory and must return an empty result (and no error) for
+// files which do not exist.
+func ReadMetadata(read func(name string) ([]byte, error)) (metadata datasource.Metadata, err error) {
+	var data []byte
+	var m Metadata
+
+	if data, err = read(path.Join("latest", "meta_data.json")); err != nil || len(data) == 0 {
+		return
+	}
+	if err = json.Unmarshal(data, &m); err != nil {
+		return
+	}
+
+	metadata.InstanceID = m.UUID
+	metadata.SSHPublicKeys = m.PublicKeys
+	metadata.Hostname = m.Hostname
+	if metadata.Hostname == "" {
+		metadata.Hostname = m.Name
+	}
+
+	if m.NetworkConfig.ContentPath != "" {
+		metadata.NetworkConfig, err = read(m.NetworkConfig.ContentPath)
+	} else {
+		metadata.NetworkConfig, err = read(path.Join("latest", "network_data.json"))
+	}
+
+	return
+}
+
+type metadataService struct {
+	metadata.MetadataService
+}
+
+func init() {
+	datasource.RegisterDetector(datasource.Detector{
+		Probe: func(host datasource.Host) bool {
+			switch host.DMI("product_name") {
+			case "OpenStack Nova", "OpenStack Compute":
+				return true
+			}
+			return host.DMI("chassis_asset_tag") == "OpenStack Nova"
+		},
+		New:     func() datasource.Datasource { return NewDatasource(DefaultAddress) },
+		Netconf: "openstack",
+	})
+}
+
+func NewDatasource(root string) *metadataService {
+	return &metadataService{metadata.NewDatasource(root, apiVersion, userdataPath, metadataPath, nil)}
+}
+
+func (ms metadataService) FetchMetadata() (datasource.Metadata, error) {
+	metadata, err := ReadMetadata(func(name string) ([]byte, error) {
+		return ms.FetchData(ms.Root + path.Join("openstack", name))
+	})
+	if err != nil {
+		return metadata, err
+	}
+
+	if metadata.PrivateIPv4, err = ms.fetchIP(ms.Root + ec2MetadataPath + "local-ipv4"); err != nil {
+		return metadata, err
+	}
+	if metadata.PublicIPv4, err = ms.fetchIP(ms.Root + ec2MetadataPath + "public-ipv4"); err != nil {
+		return metadata, err
+	}
+
+	return metadata, nil
+}
+
+func (ms metadataService) Type() string {
+	return "openstack-metadata-service"
+}
+
+func (ms metadataService) fetchIP(url string) (net.IP, error) {
+	data, err := ms.FetchData(url)
+	if err != nil {
+		return nil, err
+	}
+
+	str := strings.TrimSpace(string(data))
+	if str == "" {
+		return nil, nil
+	}
+
+	if ip := net.ParseIP(str); ip != nil {
+		return ip, nil
+	} else {
+		return nil, fmt.Errorf("couldn't parse %q as IP address", str)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openstack
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/test"
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+func TestType(t *testing.T) {
+	want := "openstack-metadata-service"
+	if kind := (metadataService{}).Type(); kind != want {
+		t.Fatalf("bad type: want %q, got %q", want, kind)
+	}
+}
+
+func TestReadMetadata(t *testing.T) {
+	for _, tt := range []struct {
+		files  map[string]string
+		expect datasource.Metadata
+		err    error
+	}{
+		{
+			files: map[string]string{},
+		},
+		{
+			files: map[string]string{"latest/meta_data.json": `{"ignore": "me"}`},
+		},
+		{
+			files: map[string]string{"latest/meta_data.json": `bad`},
+			err:   fmt.Errorf("invalid character 'b' looking for beginning of value"),
+		},
+		{
+			files:  map[string]string{"latest/meta_data.json": `{"name": "name"}`},
+			expect: datasource.Metadata{Hostname: "name"},
+		},
+		{
+			files: map[string]string{
+				"latest/meta_data.json":    `{"hostname": "host", "name": "name", "network_config": {"content_path": "/content/0000"}, "public_keys": {"1": "key1"}}`,
+				"content/0000":             "auto eth0",
+				"latest/network_data.json": `{"links": []}`,
+			},
+			expect: datasource.Metadata{
+				Hostname:      "host",
+				NetworkConfig: []byte("auto eth0"),
+				SSHPublicKeys: map[string]string{"1": "key1"},
+			},
+		},
+		{
+			files: map[string]string{
+				"latest/meta_data.json":    `{"hostname": "host", "uuid": "83679162-1378-4288-a2d4-70e13ec132aa"}`,
+				"latest/network_data.json": `{"links": []}`,
+			},
+			expect: datasource.Metadata{
+				InstanceID:    "83679162-1378-4288-a2d4-70e13ec132aa",
+				Hostname:      "host",
+				NetworkConfig: []byte(`{"links": []}`),
+			},
+		},
+	} {
+		metadata, err := ReadMetadata(func(name string) ([]byte, error) {
+			if name[0] == '/' {
+				name = name[1:]
+			}
+			if data, ok := tt.files[name]; ok {
+				return []byte(data), nil
+			}
+			return nil, nil
+		})
+		if Error(err) != Error(tt.err) {
+			t.Fatalf("bad error (%q): want %q, got %q", tt.files, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.expect, metadata) {
+			t.Fatalf("bad metadata (%q): want %#v, got %#v", tt.files, tt.expect, metadata)
+		}
+	}
+}
+
+func TestFetchMetadata(t *testing.T) {
+	for _, tt := range []struct {
+		root      string
+		resources map[string]string
+		expect    datasource.Metadata
+		clientErr error
+		expectErr error
+	}{
+		{
+			root: "/",
+			resources: map[string]string{
+				"/openstack/latest/meta_data.json":    `{"hostname": "host", "public_keys": {"mykey": "key"}}`,
+				"/openstack/latest/network_data.json": `{"links": []}`,
+				"/latest/meta-data/local-ipv4":        "1.2.3.4",
+				"/latest/meta-data/public-ipv4":       "5.6.7.8\n",
+			},
+			expect: datasource.Metadata{
+				Hostname:      "host",
+				PrivateIPv4:   net.ParseIP("1.2.3.4"),
+				PublicIPv4:    net.ParseIP("5.6.7.8"),
+				SSHPublicKeys: map[string]string{"mykey": "key"},
+				NetworkConfig: []byte(`{"links": []}`),
+			},
+		},
+		{
+			root: "/",
+			resources: map[string]string{
+				"/openstack/latest/meta_data.json": `{"hostname": "host"}`,
+				"/latest/meta-data/local-ipv4":     "bad",
+			},
+			expect:    datasource.Metadata{Hostname: "host", NetworkConfig: []byte{}},
+			expectErr: fmt.Errorf("couldn't parse \"bad\" as IP address"),
+		},
+		{
+			root:      "/",
+			clientErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+			expectErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+		},
+	} {
+		service := &metadataService{metadata.MetadataService{
+			Root:   tt.root,
+			Client: &test.HttpClient{Resources: tt.resources, Err: tt.clientErr},
+		}}
+		metadata, err := service.FetchMetadata()
+		if Error(err) != Error(tt.expectErr) {
+			t.Fatalf("bad error (%q): want %q, got %q", tt.resources, tt.expectErr, err)
+		}
+		if !reflect.DeepEqual(tt.expect, metadata) {
+			t.Fatalf("bad fetch (%q): want %#v, got %#v", tt.resources, tt.expect, metadata)
+		}
+	}
+}
+
+func Error(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,278 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nocloud
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+const (
+	DefaultRoot         = "/media/cidata"
+	ProcCmdlineLocation = "/proc/cmdline"
+
+	metadataFile      = "meta-data"
+	userdataFile      = "user-data"
+	networkConfigFile = "network-config"
+)
+
+// nocloud reads a cloud-init NoCloud seed. The seed is either a local
+// directory (e.g. a mounted "cidata" volume) or, when found on the kernel
+// command line as "ds=nocloud-net;s=<url>", a remote location.
+type nocloud struct {
+	root     string
+	cmdline  string
+	readFile func(filename string) ([]byte, error)
+}
+
+func init() {
+	datasource.RegisterDetector(datasource.Detector{
+		Probe: func(host datasource.Host) bool {
+			return host.HasLabel("cidata") || host.HasLabel("CIDATA")
+		},
+		New:     func() datasource.Datasource { return NewDatasource(DefaultRoot) },
+		Netconf: "nocloud",
+	})
+	datasource.RegisterDetector(datasource.Detector{
+		Probe: func(host datasource.Host) bool {
+			for _, arg := range strings.Fields(host.Cmdline()) {
+				if strings.HasPrefix(arg, "ds=nocloud") {
+					return true
+				}
+			}
+			return false
+		},
+		New:     func() datasource.Datasource { return NewNetworkDatasource() },
+		Netconf: "nocloud",
+	})
+}
+
+// NewDatasource returns a datasource for the NoCloud seed in the directory
+// root.
+func NewDatasource(root string) *nocloud {
+	return &nocloud{root: root, readFile: ioutil.ReadFile}
+}
+
+// NewNetworkDatasource returns a datasource for the NoCloud seed whose
+// location is given by the "ds" argument on the kernel command line.
+func NewNetworkDatasource() *nocloud {
+	return &nocloud{cmdline: ProcCmdlineLocation, readFile: ioutil.ReadFile}
+}
+
+func (n *nocloud) IsAvailable() bool {
+	if n.cmdline != "" {
+		_, err := n.seedFromCmdline()
+		return err == nil
+	}
+	_, err := os.Stat(path.Join(n.root, metadataFile))
+	return !os.IsNotExist(err)
+}
+
+func (n *nocloud) AvailabilityChanges() bool {
+	return n.cmdline == ""
+}
+
+func (n *nocloud) ConfigRoot() string {
+	return n.root
+}
+
+func (n *nocloud) FetchMetadata() (metadata datasource.Metadata, err error) {
+	var data, network []byte
+	if data, err = n.fetch(metadataFile); err != nil {
+		return
+	}
+	if network, err = n.fetch(networkConfigFile); err != nil {
+		return
+	}
+	return parseMetadata(data, network)
+}
+
+func (n *nocloud) FetchUserdata() ([]byte, error) {
+	return n.fetch(userdataFile)
+}
+
+func (n *nocloud) Type() string {
+	if n.cmdline != "" {
+		return "nocloud-net"
+	}
+	return "nocloud"
+}
+
+// fetch returns the contents of the named file in the seed. Files which do
+// not exist are returned as empty.
+func (n *nocloud) fetch(name string) ([]byte, error) {
+	root := n.root
+	if n.cmdline != "" {
+		seed, err := n.seedFromCmdline()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(seed, "http") {
+			return fetchRemote(seed + name)
+		}
+		root = strings.TrimPrefix(seed, "file://")
+	}
+
+	filename := path.Join(root, name)
+	fmt.Printf("Attempting to read from %q\n", filename)
+	data, err := n.readFile(filename)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return data, err
+}
+
+func fetchRemote(url string) ([]byte, error) {
+	client := pkg.NewHttpClient()
+	data, err := client.GetRetry(url)
+	if _, ok := err.(pkg.ErrNotFound); ok {
+		return []byte{}, nil
+	}
+	return data, err
+}
+
+func (n *nocloud) seedFromCmdline() (string, error) {
+	contents, err := n.readFile(n.cmdline)
+	if err != nil {
+		return "", err
+	}
+	return findSeed(strings.TrimSpace(string(contents)))
+}
+
+// findSeed looks for "ds=nocloud;s=<seed>" or "ds=nocloud-net;s=<seed>" in
+// the provided kernel command line and returns the seed, which always ends
+// with a slash.
+func findSeed(input string) (seed string, err error) {
+	err = errors.New("nocloud seed not found")
+	for _, token := range strings.Fields(input) {
+		parts := strings.SplitN(token, "=", 2)
+		if parts[0] != "ds" || len(parts) != 2 {
+			continue
+		}
+
+		options := strings.Split(parts[1], ";")
+		if options[0] != "nocloud" && options[0] != "nocloud-net" {
+			continue
+		}
+		for _, option := range options[1:] {
+			kv := strings.SplitN(option, "=", 2)
+			if len(kv) != 2 || (kv[0] != "s" && kv[0] != "seedfrom") {
+				continue
+			}
+			seed = kv[1]
+		}
+		if seed == "" {
+			log.Printf("Found %q in %s with no seed, ignoring.", token, ProcCmdlineLocation)
+			continue
+		}
+		if !strings.HasSuffix(seed, "/") {
+			seed += "/"
+		}
+		err = nil
+	}
+	return
+}
+
+// parseMetadata converts the contents of the meta-data and network-config
+// files into datasource.Metadata. If network-config is not provided, the
+// Debian interfaces stanzas from the meta-data "network-interfaces" key are
+// used as the network config instead.
+func parseMetadata(data, network []byte) (metadata datasource.Metadata, err error) {
+	var m struct {
+		InstanceID        string      `yaml:"instance-id"`
+		LocalHostname     string      `yaml:"local-hostname"`
+		Hostname          string      `yaml:"hostname"`
+		PublicKeys        interface{} `yaml:"public-keys"`
+		NetworkInterfaces string      `yaml:"network-interfaces"`
+	}
+
+	if err = config.UnmarshalYAML(data, &m, func(nameIn string) (nameOut string) {
+		return nameIn
+	}); err != nil {
+		return
+	}
+
+	metadata.InstanceID = m.InstanceID
+	metadata.Hostname = m.LocalHostname
+	if metadata.Hostname == "" {
+		metadata.Hostname = m.Hostname
+	}
+	if metadata.SSHPublicKeys, err = parsePublicKeys(m.PublicKeys); err != nil {
+		return
+	}
+
+	if len(network) > 0 {
+		metadata.NetworkConfig = network
+	} else if m.NetworkInterfaces != "" {
+		metadata.NetworkConfig = []byte(m.NetworkInterfaces)
+	}
+	return
+}
+
+// parsePublicKeys accepts public-keys as a single key, a list of keys, or a
+// map of key names to keys.
+func parsePublicKeys(keys interface{}) (map[string]string, error) {
+	add := func(m map[string]string, name string, key interface{}) error {
+		k, ok := key.(string)
+		if !ok {
+			return fmt.Errorf("public key %q is not a string", name)
+		}
+		if k = strings.TrimSpace(k); k != "" {
+			m[name] = k
+		}
+		return nil
+	}
+
+	switch ks := keys.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		m := map[string]string{}
+		for i, k := range strings.Split(ks, "\n") {
+			if err := add(m, strconv.Itoa(i), k); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		m := map[string]string{}
+		for i, k := range ks {
+			if err := add(m, strconv.Itoa(i), k); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case map[interface{}]interface{}:
+		m := map[string]string{}
+		for name, k := range ks {
+			if err := add(m, fmt.Sprintf("%v", name), k); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unsupported public-keys type %T", keys)
+	}
+}
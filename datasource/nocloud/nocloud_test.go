@@ -0,0 +1,185 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nocloud
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/test"
+)
+
+func TestFindSeed(t *testing.T) {
+	for _, tt := range []struct {
+		input  string
+		expect string
+		found  bool
+	}{
+		{
+			input: "foo=bar",
+		},
+		{
+			input: "ds=nocloud",
+		},
+		{
+			input: "ds=ec2;s=http://example.com/",
+		},
+		{
+			input:  "ds=nocloud-net;s=http://example.com/seed/",
+			expect: "http://example.com/seed/",
+			found:  true,
+		},
+		{
+			input:  "root=/dev/sda ds=nocloud;seedfrom=/var/seed ro",
+			expect: "/var/seed/",
+			found:  true,
+		},
+		{
+			input:  "ds=nocloud-net;h=host;s=file:///seed",
+			expect: "file:///seed/",
+			found:  true,
+		},
+	} {
+		seed, err := findSeed(tt.input)
+		if found := err == nil; found != tt.found {
+			t.Errorf("bad error (%q): want found %t, got %v", tt.input, tt.found, err)
+		}
+		if seed != tt.expect {
+			t.Errorf("bad seed (%q): want %q, got %q", tt.input, tt.expect, seed)
+		}
+	}
+}
+
+func TestFetchMetadata(t *testing.T) {
+	for _, tt := range []struct {
+		root  string
+		files test.MockFilesystem
+
+		metadata datasource.Metadata
+	}{
+		{
+			root:  "/",
+			files: test.MockFilesystem{},
+		},
+		{
+			root: "/media/cidata",
+			files: test.MockFilesystem{
+				"/media/cidata/meta-data": "instance-id: iid-local01\nlocal-hostname: host\npublic-keys:\n  - key1\n  - key2\n",
+			},
+			metadata: datasource.Metadata{
+				InstanceID:    "iid-local01",
+				Hostname:      "host",
+				SSHPublicKeys: map[string]string{"0": "key1", "1": "key2"},
+			},
+		},
+		{
+			root: "/media/cidata",
+			files: test.MockFilesystem{
+				"/media/cidata/meta-data": "hostname: host\npublic-keys:\n  mykey: key\nnetwork-interfaces: |\n  auto eth0\n  iface eth0 inet dhcp\n",
+			},
+			metadata: datasource.Metadata{
+				Hostname:      "host",
+				SSHPublicKeys: map[string]string{"mykey": "key"},
+				NetworkConfig: []byte("auto eth0\niface eth0 inet dhcp\n"),
+			},
+		},
+		{
+			root: "/media/cidata",
+			files: test.MockFilesystem{
+				"/media/cidata/meta-data":      "{\"local-hostname\": \"host\", \"public-keys\": \"key\"}",
+				"/media/cidata/network-config": "version: 1",
+			},
+			metadata: datasource.Metadata{
+				Hostname:      "host",
+				SSHPublicKeys: map[string]string{"0": "key"},
+				NetworkConfig: []byte("version: 1"),
+			},
+		},
+	} {
+		n := nocloud{root: tt.root, readFile: tt.files.ReadFile}
+		metadata, err := n.FetchMetadata()
+		if err != nil {
+			t.Fatalf("bad error for %q: want %v, got %q", tt.files, nil, err)
+		}
+		if !reflect.DeepEqual(tt.metadata, metadata) {
+			t.Fatalf("bad metadata for %q: want %#v, got %#v", tt.files, tt.metadata, metadata)
+		}
+	}
+}
+
+func TestFetchUserdata(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.RequestURI == "/seed/user-data" {
+			fmt.Fprint(w, "userdata from url")
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		n nocloud
+
+		userdata string
+	}{
+		{
+			nocloud{root: "/", readFile: test.MockFilesystem{}.ReadFile},
+			"",
+		},
+		{
+			nocloud{root: "/media/cidata", readFile: test.MockFilesystem{"/media/cidata/user-data": "userdata"}.ReadFile},
+			"userdata",
+		},
+		{
+			nocloud{cmdline: "/proc/cmdline", readFile: test.MockFilesystem{
+				"/proc/cmdline":       "ds=nocloud;s=/var/seed",
+				"/var/seed/user-data": "userdata from cmdline",
+			}.ReadFile},
+			"userdata from cmdline",
+		},
+		{
+			nocloud{cmdline: "/proc/cmdline", readFile: test.MockFilesystem{
+				"/proc/cmdline": fmt.Sprintf("ds=nocloud-net;s=%s/seed", ts.URL),
+			}.ReadFile},
+			"userdata from url",
+		},
+	} {
+		userdata, err := tt.n.FetchUserdata()
+		if err != nil {
+			t.Fatalf("bad error for %+v: want %v, got %q", tt.n, nil, err)
+		}
+		if string(userdata) != tt.userdata {
+			t.Fatalf("bad userdata for %+v: want %q, got %q", tt.n, tt.userdata, userdata)
+		}
+	}
+}
+
+func TestType(t *testing.T) {
+	for _, tt := range []struct {
+		n    nocloud
+		kind string
+	}{
+		{nocloud{root: "/media/cidata"}, "nocloud"},
+		{nocloud{cmdline: "/proc/cmdline"}, "nocloud-net"},
+	} {
+		if kind := tt.n.Type(); kind != tt.kind {
+			t.Fatalf("bad type for %+v: want %q, got %q", tt.n, tt.kind, kind)
+		}
+	}
+}
@@ -33,6 +33,20 @@ type procCmdline struct {
 	Location string
 }
 
+func init() {
+	datasource.RegisterDetector(datasource.Detector{
+		Probe: func(host datasource.Host) bool {
+			for _, arg := range strings.Fields(host.Cmdline()) {
+				if strings.HasPrefix(arg, ProcCmdlineCloudConfigFlag+"=") {
+					return true
+				}
+			}
+			return false
+		},
+		New: func() datasource.Datasource { return NewDatasource() },
+	})
+}
+
 func NewDatasource() *procCmdline {
 	return &procCmdline{Location: ProcCmdlineLocation}
 }
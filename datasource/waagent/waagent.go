@@ -25,11 +25,29 @@ import (
 	"github.com/coreos/coreos-cloudinit/datasource"
 )
 
+const (
+	DefaultRoot = "/var/lib/waagent"
+
+	// azureAssetTag is the chassis asset tag of virtual machines running on
+	// Microsoft Azure.
+	azureAssetTag = "7783-7084-3265-9085-8269-3286-77"
+)
+
 type waagent struct {
 	root     string
 	readFile func(filename string) ([]byte, error)
 }
 
+func init() {
+	datasource.RegisterDetector(datasource.Detector{
+		Probe: func(host datasource.Host) bool {
+			return host.DMI("chassis_asset_tag") == azureAssetTag ||
+				(host.Hypervisor() == "hyperv" && host.DMI("sys_vendor") == "Microsoft Corporation")
+		},
+		New: func() datasource.Datasource { return NewDatasource(DefaultRoot) },
+	})
+}
+
 func NewDatasource(root string) *waagent {
 	return &waagent{root, ioutil.ReadFile}
 }
@@ -41,13 +41,22 @@ type CloudConfigUnit interface {
 
 // Apply renders a CloudConfig to an Environment. This can involve things like
 // configuring the hostname, adding new users, writing various configuration
-// files to disk, and manipulating systemd services.
-func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Environment) error {
+// files to disk, and manipulating systemd services. All changes to the system
+// are made through the given HostManager and UnitManager. Apply stops at the
+// first error unless the Environment continues on error, in which case every
+// step which doesn't depend on a failed one is still taken and all of the
+// errors are returned as Errors.
+func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Environment, hm system.HostManager, um system.UnitManager) error {
+	errs := &errorCollector{continueOnError: env.ContinueOnError()}
+
 	if cfg.Hostname != "" {
-		if err := system.SetHostname(cfg.Hostname); err != nil {
-			return err
+		if err := hm.SetHostname(cfg.Hostname); err != nil {
+			if errs.fail(err) {
+				return errs.err()
+			}
+		} else {
+			log.Printf("Set hostname to %s", cfg.Hostname)
 		}
-		log.Printf("Set hostname to %s", cfg.Hostname)
 	}
 
 	for _, user := range cfg.Users {
@@ -56,55 +65,61 @@ func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Env
 			continue
 		}
 
-		if system.UserExists(&user) {
+		if hm.UserExists(&user) {
 			log.Printf("User '%s' exists, ignoring creation-time fields", user.Name)
 			if user.PasswordHash != "" {
 				log.Printf("Setting '%s' user's password", user.Name)
-				if err := system.SetUserPassword(user.Name, user.PasswordHash); err != nil {
+				if err := hm.SetUserPassword(user.Name, user.PasswordHash); err != nil {
 					log.Printf("Failed setting '%s' user's password: %v", user.Name, err)
-					return err
+					if errs.fail(err) {
+						return errs.err()
+					}
+					continue
 				}
 			}
 		} else {
 			log.Printf("Creating user '%s'", user.Name)
-			if err := system.CreateUser(&user); err != nil {
+			if err := hm.CreateUser(&user); err != nil {
 				log.Printf("Failed creating user '%s': %v", user.Name, err)
-				return err
+				if errs.fail(err) {
+					return errs.err()
+				}
+				continue
 			}
 		}
 
 		if len(user.SSHAuthorizedKeys) > 0 {
 			log.Printf("Authorizing %d SSH keys for user '%s'", len(user.SSHAuthorizedKeys), user.Name)
-			if err := system.AuthorizeSSHKeys(user.Name, env.SSHKeyName(), user.SSHAuthorizedKeys); err != nil {
-				return err
+			if err := hm.AuthorizeSSHKeys(user.Name, env.SSHKeyName(), user.SSHAuthorizedKeys); err != nil && errs.fail(err) {
+				return errs.err()
 			}
 		}
 		if user.SSHImportGithubUser != "" {
 			log.Printf("Authorizing github user %s SSH keys for CoreOS user '%s'", user.SSHImportGithubUser, user.Name)
-			if err := SSHImportGithubUser(user.Name, user.SSHImportGithubUser); err != nil {
-				return err
+			if err := SSHImportGithubUser(hm, user.Name, user.SSHImportGithubUser); err != nil && errs.fail(err) {
+				return errs.err()
 			}
 		}
 		for _, u := range user.SSHImportGithubUsers {
 			log.Printf("Authorizing github user %s SSH keys for CoreOS user '%s'", u, user.Name)
-			if err := SSHImportGithubUser(user.Name, u); err != nil {
-				return err
+			if err := SSHImportGithubUser(hm, user.Name, u); err != nil && errs.fail(err) {
+				return errs.err()
 			}
 		}
 		if user.SSHImportURL != "" {
 			log.Printf("Authorizing SSH keys for CoreOS user '%s' from '%s'", user.Name, user.SSHImportURL)
-			if err := SSHImportKeysFromURL(user.Name, user.SSHImportURL); err != nil {
-				return err
+			if err := SSHImportKeysFromURL(hm, user.Name, user.SSHImportURL); err != nil && errs.fail(err) {
+				return errs.err()
 			}
 		}
 	}
 
 	if len(cfg.SSHAuthorizedKeys) > 0 {
-		err := system.AuthorizeSSHKeys("core", env.SSHKeyName(), cfg.SSHAuthorizedKeys)
+		err := hm.AuthorizeSSHKeys("core", env.SSHKeyName(), cfg.SSHAuthorizedKeys)
 		if err == nil {
 			log.Printf("Authorized SSH keys for core user")
-		} else {
-			return err
+		} else if errs.fail(err) {
+			return errs.err()
 		}
 	}
 
@@ -121,7 +136,10 @@ func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Env
 	} {
 		f, err := ccf.File()
 		if err != nil {
-			return err
+			if errs.fail(err) {
+				return errs.err()
+			}
+			continue
 		}
 		if f != nil {
 			writeFiles = append(writeFiles, *f)
@@ -144,36 +162,42 @@ func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Env
 
 	wroteEnvironment := false
 	for _, file := range writeFiles {
-		fullPath, err := system.WriteFile(&file, env.Root())
-		if err != nil {
-			return err
-		}
+		// Even if writing /etc/environment fails, the default one mustn't
+		// be written in its place.
 		if path.Clean(file.Path) == "/etc/environment" {
 			wroteEnvironment = true
 		}
+		fullPath, err := hm.WriteFile(&file, env.Root())
+		if err != nil {
+			if errs.fail(err) {
+				return errs.err()
+			}
+			continue
+		}
 		log.Printf("Wrote file %s to filesystem", fullPath)
 	}
 
 	if !wroteEnvironment {
 		ef := env.DefaultEnvironmentFile()
 		if ef != nil {
-			err := system.WriteEnvFile(ef, env.Root())
-			if err != nil {
-				return err
+			if err := hm.WriteEnvFile(ef, env.Root()); err != nil {
+				if errs.fail(err) {
+					return errs.err()
+				}
+			} else {
+				log.Printf("Updated /etc/environment")
 			}
-			log.Printf("Updated /etc/environment")
 		}
 	}
 
 	if len(ifaces) > 0 {
 		units = append(units, createNetworkingUnits(ifaces)...)
-		if err := system.RestartNetwork(ifaces); err != nil {
-			return err
+		if err := hm.RestartNetwork(ifaces); err != nil && errs.fail(err) {
+			return errs.err()
 		}
 	}
 
-	um := system.NewUnitManager(env.Root())
-	return processUnits(units, env.Root(), um)
+	return processUnits(units, env.Root(), um, errs)
 }
 
 func createNetworkingUnits(interfaces []network.InterfaceGenerator) (units []system.Unit) {
@@ -198,8 +222,11 @@ func createNetworkingUnits(interfaces []network.InterfaceGenerator) (units []sys
 // processUnits takes a set of Units and applies them to the given root using
 // the given UnitManager. This can involve things like writing unit files to
 // disk, masking/unmasking units, or invoking systemd
-// commands against units. It returns any error encountered.
-func processUnits(units []system.Unit, root string, um system.UnitManager) error {
+// commands against units. The errors are collected in errs, which determines
+// whether to carry on after one; the steps for a unit are skipped once one
+// of them fails, and unit commands are skipped if systemd can't be reloaded.
+// It returns the collected errors.
+func processUnits(units []system.Unit, root string, um system.UnitManager, errs *errorCollector) error {
 	type action struct {
 		unit    system.Unit
 		command string
@@ -216,32 +243,49 @@ func processUnits(units []system.Unit, root string, um system.UnitManager) error
 		if unit.Content != "" {
 			log.Printf("Writing unit %q to filesystem", unit.Name)
 			if err := um.PlaceUnit(unit); err != nil {
-				return err
+				if errs.fail(err) {
+					return errs.err()
+				}
+				continue
 			}
 			log.Printf("Wrote unit %q", unit.Name)
 			reload = true
 		}
 
+		failed := false
 		for _, dropin := range unit.DropIns {
 			if dropin.Name != "" && dropin.Content != "" {
 				log.Printf("Writing drop-in unit %q to filesystem", dropin.Name)
 				if err := um.PlaceUnitDropIn(unit, dropin); err != nil {
-					return err
+					if errs.fail(err) {
+						return errs.err()
+					}
+					failed = true
+					continue
 				}
 				log.Printf("Wrote drop-in unit %q", dropin.Name)
 				reload = true
 			}
 		}
+		if failed {
+			continue
+		}
 
 		if unit.Mask {
 			log.Printf("Masking unit file %q", unit.Name)
 			if err := um.MaskUnit(unit); err != nil {
-				return err
+				if errs.fail(err) {
+					return errs.err()
+				}
+				continue
 			}
 		} else if unit.Runtime {
 			log.Printf("Ensuring runtime unit file %q is unmasked", unit.Name)
 			if err := um.UnmaskUnit(unit); err != nil {
-				return err
+				if errs.fail(err) {
+					return errs.err()
+				}
+				continue
 			}
 		}
 
@@ -249,9 +293,12 @@ func processUnits(units []system.Unit, root string, um system.UnitManager) error
 			if unit.Group() != "network" {
 				log.Printf("Enabling unit file %q", unit.Name)
 				if err := um.EnableUnitFile(unit); err != nil {
-					return err
+					if errs.fail(err) {
+						return errs.err()
+					}
+				} else {
+					log.Printf("Enabled unit %q", unit.Name)
 				}
-				log.Printf("Enabled unit %q", unit.Name)
 			} else {
 				log.Printf("Skipping enable for network-like unit %q", unit.Name)
 			}
@@ -266,7 +313,8 @@ func processUnits(units []system.Unit, root string, um system.UnitManager) error
 
 	if reload {
 		if err := um.DaemonReload(); err != nil {
-			return errors.New(fmt.Sprintf("failed systemd daemon-reload: %s", err))
+			errs.fail(errors.New(fmt.Sprintf("failed systemd daemon-reload: %s", err)))
+			return errs.err()
 		}
 	}
 
@@ -275,19 +323,25 @@ func processUnits(units []system.Unit, root string, um system.UnitManager) error
 		networkd := system.Unit{Unit: config.Unit{Name: "systemd-networkd.service"}}
 		res, err := um.RunUnitCommand(networkd, "restart")
 		if err != nil {
-			return err
+			if errs.fail(err) {
+				return errs.err()
+			}
+		} else {
+			log.Printf("Restarted systemd-networkd (%s)", res)
 		}
-		log.Printf("Restarted systemd-networkd (%s)", res)
 	}
 
 	for _, action := range actions {
 		log.Printf("Calling unit command %q on %q'", action.command, action.unit.Name)
 		res, err := um.RunUnitCommand(action.unit, action.command)
 		if err != nil {
-			return err
+			if errs.fail(err) {
+				return errs.err()
+			}
+			continue
 		}
 		log.Printf("Result of %q on %q: %s", action.command, action.unit.Name, res)
 	}
 
-	return nil
+	return errs.err()
 }
@@ -15,10 +15,13 @@
 package initialize
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/datasource"
 	"github.com/coreos/coreos-cloudinit/network"
 	"github.com/coreos/coreos-cloudinit/system"
 )
@@ -289,7 +292,7 @@ func TestProcessUnits(t *testing.T) {
 
 	for _, tt := range tests {
 		tum := &TestUnitManager{}
-		if err := processUnits(tt.units, "", tum); err != nil {
+		if err := processUnits(tt.units, "", tum, &errorCollector{}); err != nil {
 			t.Errorf("bad error (%+v): want nil, got %s", tt.units, err)
 		}
 		if !reflect.DeepEqual(tt.result, *tum) {
@@ -297,3 +300,111 @@ func TestProcessUnits(t *testing.T) {
 		}
 	}
 }
+
+func TestApplyPlan(t *testing.T) {
+	cfg := config.CloudConfig{
+		Hostname:          "node1",
+		SSHAuthorizedKeys: []string{"key1", "key2"},
+		Users:             []config.User{{Name: "coreos-cloudinit-test-user", PasswordHash: "hash"}},
+		WriteFiles: []config.File{
+			{Path: "/etc/environment", Content: "FOO=bar\n"},
+			{Path: "/etc/motd", Content: "aGk=", Encoding: "base64", RawFilePermissions: "0600"},
+		},
+		CoreOS: config.CoreOS{Units: []config.Unit{
+			{Name: "foo.service", Content: "[Service]\nExecStart=/bin/true", Command: "start", Enable: true},
+			{Name: "bar.service", Mask: true},
+		}},
+	}
+	env := NewEnvironment("/", "", "/var/lib/coreos-cloudinit", DefaultSSHKeyName, datasource.Metadata{})
+	plan := system.NewPlan("/")
+
+	if err := Apply(cfg, nil, env, plan, plan); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	expect := []string{
+		`Set hostname to "node1"`,
+		`Create user "coreos-cloudinit-test-user"`,
+		`Authorize 2 SSH keys for user "core" as "coreos-cloudinit"`,
+		`Write file /etc/environment (8 bytes, mode 0644)`,
+		`Write file /etc/motd (2 bytes, mode 0600)`,
+		`Write unit /etc/systemd/system/foo.service (29 bytes)`,
+		`Enable unit foo.service`,
+		`Mask unit bar.service`,
+		`Unmask unit etcd.service, if masked`,
+		`Unmask unit fleet.service, if masked`,
+		`Unmask unit locksmithd.service, if masked`,
+		`Reload systemd`,
+		`Run "start" on unit foo.service`,
+	}
+	if actions := plan.Actions(); !reflect.DeepEqual(expect, actions) {
+		t.Fatalf("bad plan: want\n%s\ngot\n%s", strings.Join(expect, "\n"), strings.Join(actions, "\n"))
+	}
+}
+
+// failingPlan is a Plan which fails to create users and to write the unit
+// files of units named "bad.service".
+type failingPlan struct {
+	*system.Plan
+}
+
+func (p failingPlan) CreateUser(user *config.User) error {
+	return fmt.Errorf("useradd failed for %s", user.Name)
+}
+
+func (p failingPlan) PlaceUnit(unit system.Unit) error {
+	if unit.Name == "bad.service" {
+		return fmt.Errorf("failed writing %s", unit.Name)
+	}
+	return p.Plan.PlaceUnit(unit)
+}
+
+func TestApplyContinueOnError(t *testing.T) {
+	cfg := config.CloudConfig{
+		Hostname: "node1",
+		Users:    []config.User{{Name: "coreos-cloudinit-test-user", SSHAuthorizedKeys: []string{"key1"}}},
+		WriteFiles: []config.File{
+			{Path: "/etc/motd", Content: "!", Encoding: "base64"},
+			{Path: "/etc/issue", Content: "hi"},
+		},
+		CoreOS: config.CoreOS{Units: []config.Unit{
+			{Name: "bad.service", Content: "[Service]\nExecStart=/bin/true", Command: "start", Enable: true},
+			{Name: "foo.service", Content: "[Service]\nExecStart=/bin/true", Command: "start"},
+		}},
+	}
+
+	for _, continueOnError := range []bool{false, true} {
+		env := NewEnvironment("/", "", "/var/lib/coreos-cloudinit", DefaultSSHKeyName, datasource.Metadata{})
+		env.SetContinueOnError(continueOnError)
+		plan := failingPlan{system.NewPlan("/")}
+
+		err := Apply(cfg, nil, env, plan, plan)
+		if !continueOnError {
+			if err == nil || err.Error() != "useradd failed for coreos-cloudinit-test-user" {
+				t.Errorf("bad error: want the first error, got %v", err)
+			}
+			if actions := plan.Actions(); !reflect.DeepEqual([]string{`Set hostname to "node1"`}, actions) {
+				t.Errorf("bad plan after the first error: %q", actions)
+			}
+			continue
+		}
+
+		errs, ok := err.(Errors)
+		if !ok || len(errs) != 3 {
+			t.Fatalf("bad error: want 3 Errors, got %#v", err)
+		}
+		expect := []string{
+			`Set hostname to "node1"`,
+			`Write file /etc/issue (2 bytes, mode 0644)`,
+			`Write unit /etc/systemd/system/foo.service (29 bytes)`,
+			`Unmask unit etcd.service, if masked`,
+			`Unmask unit fleet.service, if masked`,
+			`Unmask unit locksmithd.service, if masked`,
+			`Reload systemd`,
+			`Run "start" on unit foo.service`,
+		}
+		if actions := plan.Actions(); !reflect.DeepEqual(expect, actions) {
+			t.Errorf("bad plan: want\n%s\ngot\n%s", strings.Join(expect, "\n"), strings.Join(actions, "\n"))
+		}
+	}
+}
@@ -29,11 +29,22 @@ import (
 const DefaultSSHKeyName = "coreos-cloudinit"
 
 type Environment struct {
-	root          string
-	configRoot    string
-	workspace     string
-	sshKeyName    string
-	substitutions map[string]string
+	root            string
+	configRoot      string
+	workspace       string
+	sshKeyName      string
+	substitutions   map[string]string
+	continueOnError bool
+}
+
+// wholeWordSubstitutions are the keys which are only substituted as whole
+// words, since they are prefixes of common shell variable names (e.g.
+// "$region_name"). The older keys keep matching anywhere, as they always
+// have.
+var wholeWordSubstitutions = map[string]bool{
+	"$instance_id":       true,
+	"$availability_zone": true,
+	"$region":            true,
 }
 
 // TODO(jonboulle): this is getting unwieldy, should be able to simplify the interface somehow
@@ -44,13 +55,22 @@ func NewEnvironment(root, configRoot, workspace, sshKeyName string, metadata dat
 		}
 		return ip.String()
 	}
+	firstNonEmpty := func(value string, env string) string {
+		if value == "" {
+			return env
+		}
+		return value
+	}
 	substitutions := map[string]string{
-		"$public_ipv4":  firstNonNull(metadata.PublicIPv4, os.Getenv("COREOS_PUBLIC_IPV4")),
-		"$private_ipv4": firstNonNull(metadata.PrivateIPv4, os.Getenv("COREOS_PRIVATE_IPV4")),
-		"$public_ipv6":  firstNonNull(metadata.PublicIPv6, os.Getenv("COREOS_PUBLIC_IPV6")),
-		"$private_ipv6": firstNonNull(metadata.PrivateIPv6, os.Getenv("COREOS_PRIVATE_IPV6")),
+		"$public_ipv4":       firstNonNull(metadata.PublicIPv4, os.Getenv("COREOS_PUBLIC_IPV4")),
+		"$private_ipv4":      firstNonNull(metadata.PrivateIPv4, os.Getenv("COREOS_PRIVATE_IPV4")),
+		"$public_ipv6":       firstNonNull(metadata.PublicIPv6, os.Getenv("COREOS_PUBLIC_IPV6")),
+		"$private_ipv6":      firstNonNull(metadata.PrivateIPv6, os.Getenv("COREOS_PRIVATE_IPV6")),
+		"$instance_id":       firstNonEmpty(metadata.InstanceID, os.Getenv("COREOS_INSTANCE_ID")),
+		"$availability_zone": firstNonEmpty(metadata.AvailabilityZone, os.Getenv("COREOS_AVAILABILITY_ZONE")),
+		"$region":            firstNonEmpty(metadata.Region, os.Getenv("COREOS_REGION")),
 	}
-	return &Environment{root, configRoot, workspace, sshKeyName, substitutions}
+	return &Environment{root, configRoot, workspace, sshKeyName, substitutions, false}
 }
 
 func (e *Environment) Workspace() string {
@@ -73,12 +93,26 @@ func (e *Environment) SetSSHKeyName(name string) {
 	e.sshKeyName = name
 }
 
+// ContinueOnError returns whether Apply carries on with the steps which
+// don't depend on a failed one, rather than stopping at the first error.
+func (e *Environment) ContinueOnError() bool {
+	return e.continueOnError
+}
+
+func (e *Environment) SetContinueOnError(c bool) {
+	e.continueOnError = c
+}
+
 // Apply goes through the map of substitutions and replaces all instances of
-// the keys with their respective values. It supports escaping substitutions
-// with a leading '\'.
+// the keys with their respective values. The keys in wholeWordSubstitutions
+// only match as whole words. It supports escaping substitutions with a
+// leading '\'.
 func (e *Environment) Apply(data string) string {
 	for key, val := range e.substitutions {
 		matchKey := strings.Replace(key, `$`, `\$`, -1)
+		if wholeWordSubstitutions[key] {
+			matchKey += `\b`
+		}
 		replKey := strings.Replace(key, `$`, `$$`, -1)
 
 		// "key" -> "val"
@@ -108,6 +142,15 @@ func (e *Environment) DefaultEnvironmentFile() *system.EnvFile {
 	if ip, ok := e.substitutions["$private_ipv6"]; ok && len(ip) > 0 {
 		ef.Vars["COREOS_PRIVATE_IPV6"] = ip
 	}
+	if id, ok := e.substitutions["$instance_id"]; ok && len(id) > 0 {
+		ef.Vars["COREOS_INSTANCE_ID"] = id
+	}
+	if zone, ok := e.substitutions["$availability_zone"]; ok && len(zone) > 0 {
+		ef.Vars["COREOS_AVAILABILITY_ZONE"] = zone
+	}
+	if region, ok := e.substitutions["$region"]; ok && len(region) > 0 {
+		ef.Vars["COREOS_REGION"] = region
+	}
 	if len(ef.Vars) == 0 {
 		return nil
 	} else {
@@ -87,6 +87,29 @@ addr: \$private_ipv4
 addr: $private_ipv4
 \$private_ipv4`,
 		},
+		{
+			// Instance and placement details
+			datasource.Metadata{
+				InstanceID:       "i-1234567890abcdef0",
+				AvailabilityZone: "us-west-2a",
+				Region:           "us-west-2",
+			},
+			"$instance_id $availability_zone $region",
+			"i-1234567890abcdef0 us-west-2a us-west-2",
+		},
+		{
+			// The instance and placement details are only
+			// substituted as whole words, leaving other shell
+			// variables alone, while the addresses match anywhere
+			datasource.Metadata{
+				PrivateIPv4:      net.ParseIP("127.0.0.1"),
+				InstanceID:       "i-1234567890abcdef0",
+				AvailabilityZone: "us-west-2a",
+				Region:           "us-west-2",
+			},
+			"$region_name $region/$instance_ids $availability_zone_id $private_ipv4_addr $private_ipv4:7001 \\$instance_id_file",
+			"$region_name us-west-2/$instance_ids $availability_zone_id 127.0.0.1_addr 127.0.0.1:7001 \\$instance_id_file",
+		},
 		{
 			// No substitutions with escaping
 			datasource.Metadata{},
@@ -109,8 +132,10 @@ func TestEnvironmentFile(t *testing.T) {
 		PrivateIPv4: net.ParseIP("5.6.7.8"),
 		PublicIPv6:  net.ParseIP("1234::"),
 		PrivateIPv6: net.ParseIP("5678::"),
+		InstanceID:  "i-1234",
+		Region:      "us-west-2",
 	}
-	expect := "COREOS_PRIVATE_IPV4=5.6.7.8\nCOREOS_PRIVATE_IPV6=5678::\nCOREOS_PUBLIC_IPV4=1.2.3.4\nCOREOS_PUBLIC_IPV6=1234::\n"
+	expect := "COREOS_INSTANCE_ID=i-1234\nCOREOS_PRIVATE_IPV4=5.6.7.8\nCOREOS_PRIVATE_IPV6=5678::\nCOREOS_PUBLIC_IPV4=1.2.3.4\nCOREOS_PUBLIC_IPV6=1234::\nCOREOS_REGION=us-west-2\n"
 
 	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
 	if err != nil {
@@ -0,0 +1,57 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Errors is the list of errors of the steps of Apply which failed.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d steps failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// errorCollector collects the errors of the steps of Apply. Unless it is to
+// continue on error, Apply stops at the first one.
+type errorCollector struct {
+	continueOnError bool
+	errs            Errors
+}
+
+// fail records the error of a step and returns whether Apply must stop.
+func (c *errorCollector) fail(err error) bool {
+	c.errs = append(c.errs, err)
+	return !c.continueOnError
+}
+
+// err returns nil if no step failed, the error if only one did and Errors
+// otherwise.
+func (c *errorCollector) err() error {
+	switch len(c.errs) {
+	case 0:
+		return nil
+	case 1:
+		return c.errs[0]
+	default:
+		return c.errs
+	}
+}
@@ -20,7 +20,7 @@ import (
 	"github.com/coreos/coreos-cloudinit/system"
 )
 
-func SSHImportGithubUser(system_user string, github_user string) error {
+func SSHImportGithubUser(hm system.HostManager, system_user string, github_user string) error {
 	url := fmt.Sprintf("https://api.github.com/users/%s/keys", github_user)
 	keys, err := fetchUserKeys(url)
 	if err != nil {
@@ -28,5 +28,5 @@ func SSHImportGithubUser(system_user string, github_user string) error {
 	}
 
 	key_name := fmt.Sprintf("github-%s", github_user)
-	return system.AuthorizeSSHKeys(system_user, key_name, keys)
+	return hm.AuthorizeSSHKeys(system_user, key_name, keys)
 }
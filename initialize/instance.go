@@ -0,0 +1,172 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/system"
+)
+
+// Instance tracks, in the workspace, which sections of the cloud-config have
+// been applied to which instance so that they can be applied according to
+// their frequency. Instances are identified by the instance ID from the
+// meta-data or, for datasources which don't provide one, by the hash of the
+// user-data.
+type Instance struct {
+	workspace    string
+	instanceID   string
+	userdataHash string
+}
+
+// NewInstance returns the Instance with the given ID to which the given
+// user-data is being applied.
+func NewInstance(workspace, instanceID string, userdata ...[]byte) *Instance {
+	h := sha256.New()
+	for _, ud := range userdata {
+		h.Write(ud)
+	}
+	return &Instance{
+		workspace:    workspace,
+		instanceID:   instanceID,
+		userdataHash: hex.EncodeToString(h.Sum(nil)),
+	}
+}
+
+// ID returns the key identifying the instance.
+func (i *Instance) ID() string {
+	if i.instanceID != "" {
+		return i.instanceID
+	}
+	return "user-data-" + i.userdataHash
+}
+
+// ShouldRun returns whether the section should be applied given its
+// frequency.
+func (i *Instance) ShouldRun(section, frequency string) bool {
+	switch frequency {
+	case config.FrequencyOnce:
+		_, err := os.Stat(i.semaphore(section))
+		return os.IsNotExist(err)
+	case config.FrequencyPerInstance:
+		ran, err := ioutil.ReadFile(i.semaphore(section))
+		return err != nil || strings.TrimSpace(string(ran)) != i.ID()
+	default:
+		return true
+	}
+}
+
+// Ran records that the sections were applied to the instance.
+func (i *Instance) Ran(sections ...string) error {
+	for _, section := range sections {
+		if err := writeWorkspaceFile(i.workspace, path.Join("sem", section), i.ID()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save records the instance ID and the hash of the user-data last applied.
+func (i *Instance) Save() error {
+	if err := writeWorkspaceFile(i.workspace, "instance-id", i.instanceID); err != nil {
+		return err
+	}
+	return writeWorkspaceFile(i.workspace, "user-data.sha256", i.userdataHash)
+}
+
+// Filter removes the sections of the cloud-config, and the scripts, which
+// shouldn't be applied to the instance. It returns what remains along with
+// the sections to record with Ran once they have been applied.
+func (i *Instance) Filter(cfg config.CloudConfig, scripts []config.Script) (config.CloudConfig, []config.Script, []string) {
+	var sections []string
+	run := func(section, frequency string, empty bool) bool {
+		if !i.ShouldRun(section, frequency) {
+			log.Printf("Skipping %s, already applied (frequency %q)", section, frequency)
+			return false
+		}
+		if !empty && frequency != "" && frequency != config.FrequencyAlways {
+			sections = append(sections, section)
+		}
+		return true
+	}
+
+	f := cfg.Frequency
+	if !run("hostname", f.Hostname, cfg.Hostname == "") {
+		cfg.Hostname = ""
+	}
+	if !run("users", f.Users, len(cfg.Users) == 0) {
+		cfg.Users = nil
+	}
+	if !run("ssh_authorized_keys", f.SSHAuthorizedKeys, len(cfg.SSHAuthorizedKeys) == 0) {
+		cfg.SSHAuthorizedKeys = nil
+	}
+	if !run("write_files", f.WriteFiles, len(cfg.WriteFiles) == 0) {
+		cfg.WriteFiles = nil
+	}
+	if !run("units", f.Units, len(cfg.CoreOS.Units) == 0) {
+		cfg.CoreOS.Units = nil
+	}
+	scripts = i.filterScripts(scripts, f.Scripts, run)
+	return cfg, scripts, sections
+}
+
+// filterScripts removes the scripts which shouldn't be run. Scripts setting
+// their own frequency in their header are tracked individually, by the hash
+// of their content, and the others together as the "scripts" section with the
+// given frequency.
+func (i *Instance) filterScripts(scripts []config.Script, frequency string, run func(section, frequency string, empty bool) bool) []config.Script {
+	runOthers := false
+	for _, script := range scripts {
+		if script.Frequency() == "" {
+			runOthers = run("scripts", frequency, false)
+			break
+		}
+	}
+
+	var filtered []config.Script
+	for _, script := range scripts {
+		if f := script.Frequency(); f != "" {
+			if !run(fmt.Sprintf("script-%x", sha256.Sum256(script)), f, false) {
+				continue
+			}
+		} else if !runOthers {
+			continue
+		}
+		filtered = append(filtered, script)
+	}
+	return filtered
+}
+
+func (i *Instance) semaphore(section string) string {
+	return path.Join(i.workspace, "sem", section)
+}
+
+func writeWorkspaceFile(workspace, name, content string) error {
+	file := system.File{File: config.File{
+		Path:               name,
+		RawFilePermissions: "0644",
+		Content:            content + "\n",
+	}}
+	_, err := system.WriteFile(&file, workspace)
+	return err
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestInstanceFilter(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.CloudConfig{
+		Hostname:   "host",
+		Users:      []config.User{{Name: "bob"}},
+		WriteFiles: []config.File{{Path: "/etc/foo"}},
+		CoreOS:     config.CoreOS{Units: []config.Unit{{Name: "foo.service"}}},
+		Frequency: config.Frequency{
+			Users:      config.FrequencyPerInstance,
+			WriteFiles: config.FrequencyOnce,
+			Scripts:    config.FrequencyPerInstance,
+		},
+	}
+	scripts := []config.Script{config.Script("#!/bin/bash")}
+
+	for _, tt := range []struct {
+		instanceID string
+		userdata   string
+		users      bool
+		writeFiles bool
+		scripts    bool
+		ran        []string
+	}{
+		{"i-1", "a", true, true, true, []string{"users", "write_files", "scripts"}},
+		{"i-1", "b", false, false, false, nil},
+		{"i-2", "b", true, false, true, []string{"users", "scripts"}},
+		{"", "b", true, false, true, []string{"users", "scripts"}},
+		{"", "b", false, false, false, nil},
+	} {
+		instance := NewInstance(dir, tt.instanceID, []byte(tt.userdata))
+		out, outScripts, ran := instance.Filter(cfg, scripts)
+		if out.Hostname != "host" || len(out.CoreOS.Units) != 1 {
+			t.Errorf("bad config (%q): sections without a frequency were dropped: %+v", tt.instanceID, out)
+		}
+		if (len(out.Users) > 0) != tt.users || (len(out.WriteFiles) > 0) != tt.writeFiles || (len(outScripts) > 0) != tt.scripts {
+			t.Errorf("bad config (%q): want users %t, write_files %t and scripts %t, got %+v and %q", tt.instanceID, tt.users, tt.writeFiles, tt.scripts, out, outScripts)
+		}
+		if !reflect.DeepEqual(tt.ran, ran) {
+			t.Errorf("bad sections (%q): want %q, got %q", tt.instanceID, tt.ran, ran)
+		}
+		if err := instance.Ran(ran...); err != nil {
+			t.Fatalf("bad error recording sections: %v", err)
+		}
+		if err := instance.Save(); err != nil {
+			t.Fatalf("bad error saving instance: %v", err)
+		}
+	}
+
+	id, err := ioutil.ReadFile(path.Join(dir, "instance-id"))
+	if err != nil || string(id) != "\n" {
+		t.Errorf("bad instance-id: %q, %v", id, err)
+	}
+	hash, err := ioutil.ReadFile(path.Join(dir, "user-data.sha256"))
+	if err != nil || string(hash) != "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d\n" {
+		t.Errorf("bad user-data.sha256: %q, %v", hash, err)
+	}
+}
+
+func TestInstanceFilterScripts(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	always := config.Script("#!/bin/bash\necho always")
+	perInstance := config.Script("#!/bin/bash\n# coreos-cloudinit frequency: per-instance\necho per-instance")
+	once := config.Script("#!/bin/bash\n# coreos-cloudinit frequency: once\necho once")
+	scripts := []config.Script{always, perInstance, once}
+
+	for _, tt := range []struct {
+		instanceID string
+		scripts    []config.Script
+		ran        int
+	}{
+		{"i-1", []config.Script{always, perInstance, once}, 2},
+		{"i-1", []config.Script{always}, 0},
+		{"i-2", []config.Script{always, perInstance}, 1},
+	} {
+		instance := NewInstance(dir, tt.instanceID)
+		_, outScripts, ran := instance.Filter(config.CloudConfig{}, scripts)
+		if !reflect.DeepEqual(tt.scripts, outScripts) {
+			t.Errorf("bad scripts (%q): want %q, got %q", tt.instanceID, tt.scripts, outScripts)
+		}
+		if len(ran) != tt.ran {
+			t.Errorf("bad sections (%q): want %d, got %q", tt.instanceID, tt.ran, ran)
+		}
+		if err := instance.Ran(ran...); err != nil {
+			t.Fatalf("bad error recording sections: %v", err)
+		}
+	}
+}
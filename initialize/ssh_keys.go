@@ -27,14 +27,14 @@ type UserKey struct {
 	Key string `json:"key"`
 }
 
-func SSHImportKeysFromURL(system_user string, url string) error {
+func SSHImportKeysFromURL(hm system.HostManager, system_user string, url string) error {
 	keys, err := fetchUserKeys(url)
 	if err != nil {
 		return err
 	}
 
 	key_name := fmt.Sprintf("coreos-cloudinit-%s", system_user)
-	return system.AuthorizeSSHKeys(system_user, key_name, keys)
+	return hm.AuthorizeSSHKeys(system_user, key_name, keys)
 }
 
 func fetchUserKeys(url string) ([]string, error) {
@@ -0,0 +1,134 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/config/validate"
+	"github.com/coreos/coreos-cloudinit/system"
+)
+
+// StatusDir is the directory of the workspace to which the status of the
+// last run of each invocation is written.
+const StatusDir = "status"
+
+// Status is the machine-readable report of a run of coreos-cloudinit. It is
+// written to the workspace when the run starts and again when it finishes.
+// Runs are told apart by their invocation (the command line arguments), so
+// that the runs of the several units which call coreos-cloudinit during a
+// boot don't overwrite each other's status.
+type Status struct {
+	Invocation  string           `json:"invocation"`
+	Datasources []string         `json:"datasources"`
+	Started     time.Time        `json:"started"`
+	Finished    *time.Time       `json:"finished,omitempty"`
+	Success     bool             `json:"success"`
+	Validation  []validate.Entry `json:"validation"`
+	Actions     []system.Action  `json:"actions"`
+	Errors      []string         `json:"errors"`
+}
+
+// NewStatus returns the Status of a run of the given invocation starting now.
+func NewStatus(invocation string) *Status {
+	return &Status{
+		Invocation:  invocation,
+		Started:     time.Now().UTC(),
+		Datasources: []string{},
+		Validation:  []validate.Entry{},
+		Actions:     []system.Action{},
+		Errors:      []string{},
+	}
+}
+
+// Errorf records an error which isn't attributable to a single action.
+func (s *Status) Errorf(format string, a ...interface{}) {
+	s.Errors = append(s.Errors, fmt.Sprintf(format, a...))
+}
+
+// Finish marks the run as finished with the given exit code. The run only
+// succeeded if it exited with 0 and no errors or failed actions were
+// recorded.
+func (s *Status) Finish(code int) {
+	now := time.Now().UTC()
+	s.Finished = &now
+	s.Success = code == 0 && len(s.Errors) == 0
+	for _, action := range s.Actions {
+		if action.Error != "" {
+			s.Success = false
+		}
+	}
+}
+
+// Write atomically writes the status to the workspace, replacing that of
+// the previous run of the same invocation.
+func (s *Status) Write(workspace string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := system.File{File: config.File{
+		Path:               path.Join(StatusDir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(s.Invocation)))),
+		RawFilePermissions: "0644",
+		Content:            string(data) + "\n",
+	}}
+	_, err = system.WriteFile(&file, workspace)
+	return err
+}
+
+// ReadStatuses reads the status of the last run of each invocation from the
+// workspace, ordered by the time at which they started.
+func ReadStatuses(workspace string) ([]*Status, error) {
+	dir := path.Join(workspace, StatusDir)
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var statuses []*Status
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(path.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var s Status
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("%s: %v", info.Name(), err)
+		}
+		statuses = append(statuses, &s)
+	}
+	sort.Sort(byStarted(statuses))
+	return statuses, nil
+}
+
+type byStarted []*Status
+
+func (s byStarted) Len() int           { return len(s) }
+func (s byStarted) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byStarted) Less(i, j int) bool { return s[i].Started.Before(s[j].Started) }
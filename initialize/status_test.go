@@ -0,0 +1,118 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/config/validate"
+	"github.com/coreos/coreos-cloudinit/system"
+)
+
+func TestStatus(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	report, err := validate.Validate([]byte("#cloud-config\nhostname: [1]"))
+	if err != nil {
+		t.Fatalf("bad error validating: %v", err)
+	}
+
+	for _, tt := range []struct {
+		code    int
+		actions []system.Action
+		errors  []string
+		success bool
+	}{
+		{0, []system.Action{{Description: "Set hostname"}}, nil, true},
+		{1, nil, nil, false},
+		{0, []system.Action{{Description: "Set hostname", Error: "failed"}}, nil, false},
+		{0, nil, []string{"Failed fetching user-data"}, false},
+	} {
+		s := NewStatus("--from-file=user-data")
+		s.Datasources = []string{"file"}
+		s.Validation = report.Entries()
+		s.Actions = append(s.Actions, tt.actions...)
+		for _, e := range tt.errors {
+			s.Errorf("%s", e)
+		}
+		if err := s.Write(dir); err != nil {
+			t.Fatalf("bad error writing status: %v", err)
+		}
+		if running, err := ReadStatuses(dir); err != nil || len(running) != 1 || running[0].Finished != nil {
+			t.Fatalf("bad running status: %+v, %v", running, err)
+		}
+
+		s.Finish(tt.code)
+		if s.Success != tt.success {
+			t.Errorf("bad success (%d, %v, %v): want %t, got %t", tt.code, tt.actions, tt.errors, tt.success, s.Success)
+		}
+		if err := s.Write(dir); err != nil {
+			t.Fatalf("bad error writing status: %v", err)
+		}
+		statuses, err := ReadStatuses(dir)
+		if err != nil || len(statuses) != 1 {
+			t.Fatalf("bad statuses: %+v, %v", statuses, err)
+		}
+		read := statuses[0]
+		if !read.Started.Equal(s.Started) || !read.Finished.Equal(*s.Finished) {
+			t.Errorf("bad times: want %v and %v, got %v and %v", s.Started, s.Finished, read.Started, read.Finished)
+		}
+		read.Started, read.Finished = s.Started, s.Finished
+		if !reflect.DeepEqual(s, read) {
+			t.Errorf("bad status: want %+v, got %+v", s, read)
+		}
+	}
+}
+
+func TestReadStatuses(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if statuses, err := ReadStatuses(dir); err != nil || len(statuses) != 0 {
+		t.Fatalf("bad statuses without a run: %+v, %v", statuses, err)
+	}
+
+	first := NewStatus("--oem=ec2-compat")
+	second := NewStatus("--from-configdrive=/media/configdrive")
+	second.Started = first.Started.Add(time.Second)
+	for _, s := range []*Status{second, first, first} {
+		if err := s.Write(dir); err != nil {
+			t.Fatalf("bad error writing status: %v", err)
+		}
+	}
+
+	statuses, err := ReadStatuses(dir)
+	if err != nil {
+		t.Fatalf("bad error reading statuses: %v", err)
+	}
+	var invocations []string
+	for _, s := range statuses {
+		invocations = append(invocations, s.Invocation)
+	}
+	if expect := []string{first.Invocation, second.Invocation}; !reflect.DeepEqual(expect, invocations) {
+		t.Errorf("bad invocations: want %q, got %q", expect, invocations)
+	}
+}
@@ -15,25 +15,249 @@
 package initialize
 
 import (
+	"crypto/sha256"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path"
+	"strings"
 
 	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/pkg"
 )
 
+// maxIncludeDepth limits how deeply included user-data may itself include
+// other user-data.
+const maxIncludeDepth = 8
+
+// fetchURL retrieves included user-data from an HTTP(S) or file:// URL.
+var fetchURL = func(url string) ([]byte, error) {
+	if strings.HasPrefix(url, "file://") {
+		return ioutil.ReadFile(strings.TrimPrefix(url, "file://"))
+	}
+	return pkg.NewHttpClient().GetRetry(url)
+}
+
+// MultipartUserData is the result of parsing user-data which is made up of
+// several parts, either as a multipart message or through includes. All of its
+// cloud-configs are merged into CloudConfig, in order of precedence, and its
+// scripts are kept in the order they appeared.
+type MultipartUserData struct {
+	CloudConfig *config.CloudConfig
+	Scripts     []config.Script
+}
+
+// ParseUserData parses the given user-data, following any includes. The
+// content of #include-once URLs is not cached.
 func ParseUserData(contents string) (interface{}, error) {
+	return ParseUserDataInWorkspace(contents, "", nil)
+}
+
+// ParseUserDataInWorkspace parses the given user-data like ParseUserData but
+// caches the content of #include-once URLs in workspace, so that they are only
+// ever fetched once. The substitutions of env, if given, are applied to the
+// user-data, to each included user-data and to each part of multipart
+// user-data once it is decoded.
+func ParseUserDataInWorkspace(contents, workspace string, env *Environment) (interface{}, error) {
+	p := userDataParser{workspace: workspace, env: env}
+	return p.parse(contents, "")
+}
+
+// userDataParser parses user-data, keeping track of the chain of includes
+// being followed in order to detect loops.
+type userDataParser struct {
+	workspace string
+	env       *Environment
+	includes  []string
+}
+
+// parse parses the user-data found at the given source (empty for the
+// top-level user-data), decompressing it first if needed.
+func (p *userDataParser) parse(contents, source string) (interface{}, error) {
+	contents, err := config.DecodeUserData(contents)
+	if err != nil {
+		return nil, err
+	}
 	if len(contents) == 0 {
 		return nil, nil
 	}
+	if config.IsMultipart(contents) {
+		// The parts are substituted individually once their transfer
+		// encoding has been undone.
+		log.Printf("Parsing user-data as multipart")
+		return p.parseMultipart(contents)
+	}
+	contents = p.substitute(contents)
 
 	switch {
+	case config.IsIncludeOnce(contents):
+		log.Printf("Parsing user-data as include-once")
+		return p.parseIncludes(contents, true)
+	case config.IsInclude(contents):
+		log.Printf("Parsing user-data as include")
+		return p.parseIncludes(contents, false)
 	case config.IsScript(contents):
 		log.Printf("Parsing user-data as script")
 		return config.NewScript(contents)
 	case config.IsCloudConfig(contents):
 		log.Printf("Parsing user-data as cloud-config")
 		return config.NewCloudConfig(contents)
+	case source != "":
+		return nil, fmt.Errorf("Unrecognized user-data format at %q", source)
 	default:
 		return nil, errors.New("Unrecognized user-data format")
 	}
 }
+
+// substitute applies the substitutions of the environment, if any, to the
+// given user-data.
+func (p *userDataParser) substitute(contents string) string {
+	if p.env == nil {
+		return contents
+	}
+	return p.env.Apply(contents)
+}
+
+// parseMultipart parses each part of the multipart user-data. The
+// cloud-config parts are merged such that later parts take precedence over
+// earlier ones.
+func (p *userDataParser) parseMultipart(contents string) (*MultipartUserData, error) {
+	parts, err := config.NewMultipart(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	var uds []interface{}
+	for _, part := range parts {
+		var ud interface{}
+		var err error
+		content := p.substitute(string(part.Content))
+		switch part.ContentType {
+		case config.ContentTypeCloudConfig:
+			ud, err = config.NewCloudConfig(content)
+		case config.ContentTypeScript:
+			ud, err = config.NewScript(content)
+		case config.ContentTypeIncludeURL:
+			ud, err = p.parseIncludes(content, false)
+		case config.ContentTypeIncludeOnceURL:
+			ud, err = p.parseIncludes(content, true)
+		default:
+			log.Printf("Ignoring user-data part of unsupported type %q", part.ContentType)
+		}
+		if err != nil {
+			return nil, err
+		}
+		uds = append(uds, ud)
+	}
+	return combineUserData(uds), nil
+}
+
+// parseIncludes fetches and parses the user-data at each of the URLs listed in
+// contents. If once is set, the content of each URL is cached in the
+// workspace and only fetched if it hasn't been before.
+func (p *userDataParser) parseIncludes(contents string, once bool) (*MultipartUserData, error) {
+	var uds []interface{}
+	for _, url := range includeURLs(contents) {
+		for _, include := range p.includes {
+			if include == url {
+				return nil, fmt.Errorf("user-data include loop detected at %q", url)
+			}
+		}
+		if len(p.includes) >= maxIncludeDepth {
+			return nil, fmt.Errorf("user-data includes are nested more than %d levels deep", maxIncludeDepth)
+		}
+
+		data, err := p.fetch(url, once)
+		if err != nil {
+			return nil, err
+		}
+
+		p.includes = append(p.includes, url)
+		ud, err := p.parse(string(data), url)
+		p.includes = p.includes[:len(p.includes)-1]
+		if err != nil {
+			return nil, err
+		}
+		uds = append(uds, ud)
+	}
+	return combineUserData(uds), nil
+}
+
+// fetch retrieves the content at url. If once is set and a workspace is
+// configured, the content is read from and stored in the workspace's include
+// cache.
+func (p *userDataParser) fetch(url string, once bool) ([]byte, error) {
+	var cached string
+	if once && p.workspace != "" {
+		cached = path.Join(p.workspace, "includes", fmt.Sprintf("%x", sha256.Sum256([]byte(url))))
+		if data, err := ioutil.ReadFile(cached); err == nil {
+			log.Printf("Using cached user-data for %q", url)
+			return data, nil
+		}
+	}
+
+	log.Printf("Fetching included user-data from %q", url)
+	data, err := fetchURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached != "" {
+		if err := os.MkdirAll(path.Dir(cached), 0700); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(cached, data, 0600); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// combineUserData combines the parsed user-data into a single
+// MultipartUserData, merging the cloud-configs such that later ones take
+// precedence over earlier ones.
+func combineUserData(uds []interface{}) *MultipartUserData {
+	var ccs []config.CloudConfig
+	var scripts []config.Script
+	for _, ud := range uds {
+		switch t := ud.(type) {
+		case *config.CloudConfig:
+			ccs = append(ccs, *t)
+		case *config.Script:
+			scripts = append(scripts, *t)
+		case *MultipartUserData:
+			if t.CloudConfig != nil {
+				ccs = append(ccs, *t.CloudConfig)
+			}
+			scripts = append(scripts, t.Scripts...)
+		}
+	}
+
+	ud := &MultipartUserData{Scripts: scripts}
+	switch len(ccs) {
+	case 0:
+	case 1:
+		ud.CloudConfig = &ccs[0]
+	default:
+		cc := config.Merge(ccs...)
+		ud.CloudConfig = &cc
+	}
+	return ud
+}
+
+// includeURLs returns the URLs listed in include user-data or a
+// text/x-include-url part, skipping blank lines and comments (including the
+// "#include" header).
+func includeURLs(content string) []string {
+	var urls []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls
+}
@@ -15,9 +15,18 @@
 package initialize
 
 import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/datasource"
 )
 
 func TestParseHeaderCRLF(t *testing.T) {
@@ -72,3 +81,215 @@ func TestParseConfigEmpty(t *testing.T) {
 		t.Error("ParseUserData of empty string returned error unexpectedly")
 	}
 }
+
+func TestParseMultipart(t *testing.T) {
+	defer func(f func(string) ([]byte, error)) { fetchURL = f }(fetchURL)
+	fetchURL = func(url string) ([]byte, error) {
+		switch url {
+		case "http://example.com/config":
+			return []byte("#cloud-config\nhostname: included\nssh_authorized_keys:\n  - included"), nil
+		case "http://example.com/loop":
+			return []byte("Content-Type: multipart/mixed; boundary=abc\n\n--abc\nContent-Type: text/x-include-url\n\nhttp://example.com/loop\n--abc--\n"), nil
+		}
+		return nil, fmt.Errorf("not found: %s", url)
+	}
+
+	contents := `Content-Type: multipart/mixed; boundary="abc"
+MIME-Version: 1.0
+
+--abc
+Content-Type: text/cloud-config
+
+hostname: first
+ssh_authorized_keys:
+  - first
+--abc
+Content-Type: text/x-shellscript
+
+#!/bin/bash
+echo first
+--abc
+Content-Type: text/x-include-url
+
+# comment
+http://example.com/config
+--abc
+Content-Type: text/x-shellscript
+
+#!/bin/bash
+echo second
+--abc--
+`
+	ud, err := ParseUserData(contents)
+	if err != nil {
+		t.Fatalf("Failed parsing multipart: %v", err)
+	}
+
+	expect := &MultipartUserData{
+		CloudConfig: &config.CloudConfig{
+			Hostname:          "included",
+			SSHAuthorizedKeys: []string{"first", "included"},
+		},
+		Scripts: []config.Script{
+			config.Script("#!/bin/bash\necho first"),
+			config.Script("#!/bin/bash\necho second"),
+		},
+	}
+	if !reflect.DeepEqual(expect, ud) {
+		t.Fatalf("bad multipart: want %#v, got %#v", expect, ud)
+	}
+
+	loop := "Content-Type: multipart/mixed; boundary=abc\n\n--abc\nContent-Type: text/x-include-url\n\nhttp://example.com/loop\n--abc--\n"
+	if _, err := ParseUserData(loop); err == nil {
+		t.Fatalf("Parsing recursive include unexpectedly succeeded")
+	}
+}
+
+func TestParseMultipartSubstitution(t *testing.T) {
+	contents := `Content-Type: multipart/mixed; boundary="abc"
+MIME-Version: 1.0
+
+--abc
+Content-Type: text/cloud-config
+Content-Transfer-Encoding: base64
+
+` + base64.StdEncoding.EncodeToString([]byte("#cloud-config\nhostname: host-$private_ipv4")) + `
+--abc
+Content-Type: text/x-shellscript
+
+#!/bin/bash
+echo $private_ipv4
+--abc--
+`
+	env := NewEnvironment("./", "./", "./", "", datasource.Metadata{
+		PrivateIPv4: net.ParseIP("192.0.2.1"),
+	})
+	ud, err := ParseUserDataInWorkspace(contents, "", env)
+	if err != nil {
+		t.Fatalf("Failed parsing multipart: %v", err)
+	}
+
+	expect := &MultipartUserData{
+		CloudConfig: &config.CloudConfig{Hostname: "host-192.0.2.1"},
+		Scripts:     []config.Script{config.Script("#!/bin/bash\necho 192.0.2.1")},
+	}
+	if !reflect.DeepEqual(expect, ud) {
+		t.Fatalf("bad multipart: want %#v, got %#v", expect, ud)
+	}
+}
+
+func TestParseInclude(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := path.Join(dir, "local")
+	if err := ioutil.WriteFile(local, []byte("#!/bin/bash\necho local"), 0644); err != nil {
+		t.Fatalf("Unable to write file: %v", err)
+	}
+
+	fetched := map[string]int{}
+	defer func(f func(string) ([]byte, error)) { fetchURL = f }(fetchURL)
+	realFetch := fetchURL
+	fetchURL = func(url string) ([]byte, error) {
+		fetched[url]++
+		switch url {
+		case "http://example.com/config":
+			return []byte("#cloud-config\nhostname: included"), nil
+		case "http://example.com/once":
+			return []byte("#cloud-config\nssh_authorized_keys:\n  - once"), nil
+		case "http://example.com/a":
+			return []byte("#include\nhttp://example.com/b"), nil
+		case "http://example.com/b":
+			return []byte("#include\nhttp://example.com/a"), nil
+		}
+		if strings.HasPrefix(url, "http://example.com/deep") {
+			return []byte("#include\n" + url + "/"), nil
+		}
+		return realFetch(url)
+	}
+
+	workspace := path.Join(dir, "workspace")
+	for _, tt := range []struct {
+		contents string
+
+		ud  interface{}
+		err bool
+	}{
+		{
+			contents: "#include\nhttp://example.com/config\nfile://" + local,
+			ud: &MultipartUserData{
+				CloudConfig: &config.CloudConfig{Hostname: "included"},
+				Scripts:     []config.Script{config.Script("#!/bin/bash\necho local")},
+			},
+		},
+		{
+			contents: "#include-once\nhttp://example.com/once",
+			ud: &MultipartUserData{
+				CloudConfig: &config.CloudConfig{SSHAuthorizedKeys: []string{"once"}},
+			},
+		},
+		{
+			contents: "#include\nhttp://example.com/a",
+			err:      true,
+		},
+		{
+			contents: "#include\nhttp://example.com/deep",
+			err:      true,
+		},
+	} {
+		ud, err := ParseUserDataInWorkspace(tt.contents, workspace, nil)
+		if (err != nil) != tt.err {
+			t.Fatalf("bad error (%q): want %t, got %v", tt.contents, tt.err, err)
+		}
+		if err == nil && !reflect.DeepEqual(tt.ud, ud) {
+			t.Fatalf("bad user-data (%q): want %#v, got %#v", tt.contents, tt.ud, ud)
+		}
+	}
+
+	if _, err := ParseUserDataInWorkspace("#include-once\nhttp://example.com/once", workspace, nil); err != nil {
+		t.Fatalf("Failed parsing include-once: %v", err)
+	}
+	if fetched["http://example.com/once"] != 1 {
+		t.Fatalf("include-once URL fetched %d times", fetched["http://example.com/once"])
+	}
+}
+
+func TestParseIncludeSubstitution(t *testing.T) {
+	defer func(f func(string) ([]byte, error)) { fetchURL = f }(fetchURL)
+	fetchURL = func(url string) ([]byte, error) {
+		return []byte("#cloud-config\nhostname: host-$private_ipv4"), nil
+	}
+
+	env := NewEnvironment("./", "./", "./", "", datasource.Metadata{
+		PrivateIPv4: net.ParseIP("192.0.2.1"),
+	})
+	ud, err := ParseUserDataInWorkspace("#include\nhttp://example.com/$private_ipv4", "", env)
+	if err != nil {
+		t.Fatalf("Failed parsing include: %v", err)
+	}
+	expect := &MultipartUserData{
+		CloudConfig: &config.CloudConfig{Hostname: "host-192.0.2.1"},
+	}
+	if !reflect.DeepEqual(expect, ud) {
+		t.Fatalf("bad user-data: want %#v, got %#v", expect, ud)
+	}
+}
+
+func TestParseCompressed(t *testing.T) {
+	for _, contents := range []string{
+		"\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\x03\x53\x4e\xce\xc9\x2f\x4d\xd1\x4d\xce\xcf\x4b\xcb\x4c\xe7\xca\xc8\x2f\x2e\xc9\x4b\xcc\x4d\xb5\x52\x48\xcb\xcf\xe7\x02\x00\xa2\xc1\x67\xbc\x1c\x00\x00\x00",
+		"H4sIAAAAAAACA1NOzskvTdFNzs9Ly0znysgvLslLzE21UkjLz+cCAKLBZ7wcAAAA\n",
+	} {
+		ud, err := ParseUserData(contents)
+		if err != nil {
+			t.Fatalf("Failed parsing compressed user-data (%q): %v", contents, err)
+		}
+		cfg, ok := ud.(*config.CloudConfig)
+		if !ok || cfg.Hostname != "foo" {
+			t.Fatalf("bad user-data (%q): %#v", contents, ud)
+		}
+	}
+}
@@ -44,6 +44,7 @@ type logicalInterface struct {
 	config      configMethod
 	children    []networkInterface
 	configDepth int
+	mtu         int
 }
 
 func (i *logicalInterface) Name() string {
@@ -58,6 +59,9 @@ func (i *logicalInterface) Network() string {
 	if i.hwaddr != nil {
 		config += fmt.Sprintf("MACAddress=%s\n", i.hwaddr)
 	}
+	if i.mtu != 0 {
+		config += fmt.Sprintf("\n[Link]\nMTUBytes=%d\n", i.mtu)
+	}
 	config += "\n[Network]\n"
 
 	for _, child := range i.children {
@@ -0,0 +1,239 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+type noCloudSubnet struct {
+	Type           string   `yaml:"type"`
+	Address        string   `yaml:"address"`
+	Netmask        string   `yaml:"netmask"`
+	Gateway        string   `yaml:"gateway"`
+	DNSNameservers []string `yaml:"dns_nameservers"`
+	Routes         []struct {
+		Network string `yaml:"network"`
+		Netmask string `yaml:"netmask"`
+		Gateway string `yaml:"gateway"`
+	} `yaml:"routes"`
+}
+
+type noCloudInterface struct {
+	Type           string            `yaml:"type"`
+	Name           string            `yaml:"name"`
+	MACAddress     string            `yaml:"mac_address"`
+	BondInterfaces []string          `yaml:"bond_interfaces"`
+	Params         map[string]string `yaml:"params"`
+	VLANLink       string            `yaml:"vlan_link"`
+	VLANID         int               `yaml:"vlan_id"`
+	Address        []string          `yaml:"address"`
+	Subnets        []noCloudSubnet   `yaml:"subnets"`
+}
+
+type noCloudNetworkConfig struct {
+	Version int                `yaml:"version"`
+	Config  []noCloudInterface `yaml:"config"`
+}
+
+// ProcessNoCloudNetconf translates the NoCloud network configuration into
+// interfaces. Version 1 of the cloud-init network-config format is
+// supported; anything else is treated as Debian interfaces stanzas, which is
+// what NoCloud provides through the meta-data "network-interfaces" key.
+func ProcessNoCloudNetconf(netconf []byte) ([]InterfaceGenerator, error) {
+	log.Println("Processing NoCloud network config")
+	if len(netconf) == 0 {
+		return nil, nil
+	}
+
+	identity := func(nameIn string) (nameOut string) {
+		return nameIn
+	}
+	var wrapped struct {
+		Network *noCloudNetworkConfig `yaml:"network"`
+	}
+	var cfg noCloudNetworkConfig
+	if err := config.UnmarshalYAML(netconf, &wrapped, identity); err != nil || wrapped.Network == nil {
+		if err := config.UnmarshalYAML(netconf, &cfg, identity); err != nil || cfg.Version == 0 {
+			return ProcessDebianNetconf(netconf)
+		}
+	} else {
+		cfg = *wrapped.Network
+	}
+
+	if cfg.Version != 1 {
+		return nil, fmt.Errorf("unsupported network-config version %d", cfg.Version)
+	}
+
+	stanzas, err := parseNoCloudInterfaces(cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Parsed %d network interfaces\n", len(stanzas))
+
+	log.Println("Processed NoCloud network config")
+	return buildInterfaces(stanzas), nil
+}
+
+func parseNoCloudInterfaces(config []noCloudInterface) ([]*stanzaInterface, error) {
+	var nameservers []net.IP
+	for _, c := range config {
+		if c.Type != "nameserver" {
+			continue
+		}
+		for _, ns := range c.Address {
+			ip := net.ParseIP(ns)
+			if ip == nil {
+				return nil, fmt.Errorf("could not parse %q as nameserver IP address", ns)
+			}
+			nameservers = append(nameservers, ip)
+		}
+	}
+
+	stanzas := make([]*stanzaInterface, 0, len(config))
+	for _, c := range config {
+		if c.Type == "nameserver" {
+			continue
+		}
+		if c.Name == "" {
+			return nil, fmt.Errorf("%s interface has no name", c.Type)
+		}
+
+		conf, err := parseNoCloudSubnets(c.Subnets, nameservers)
+		if err != nil {
+			return nil, err
+		}
+
+		stanza := &stanzaInterface{
+			name:         c.Name,
+			auto:         true,
+			configMethod: conf,
+			options:      map[string][]string{},
+		}
+		switch c.Type {
+		case "physical":
+			stanza.kind = interfacePhysical
+		case "bond":
+			stanza.kind = interfaceBond
+			stanza.options["bond-slaves"] = c.BondInterfaces
+			for k, v := range c.Params {
+				stanza.options[k] = []string{v}
+			}
+		case "vlan":
+			stanza.kind = interfaceVLAN
+			stanza.options["id"] = []string{strconv.Itoa(c.VLANID)}
+			stanza.options["raw_device"] = []string{c.VLANLink}
+		default:
+			return nil, fmt.Errorf("unsupported interface type %q", c.Type)
+		}
+		stanzas = append(stanzas, stanza)
+	}
+	return stanzas, nil
+}
+
+// parseNoCloudSubnets collapses the subnets of an interface into a single
+// config method. Static subnets take precedence over DHCP ones.
+func parseNoCloudSubnets(subnets []noCloudSubnet, nameservers []net.IP) (configMethod, error) {
+	if len(subnets) == 0 {
+		return configMethodManual{}, nil
+	}
+
+	static := configMethodStatic{nameservers: append([]net.IP{}, nameservers...)}
+	dhcp := false
+	for _, s := range subnets {
+		switch s.Type {
+		case "dhcp", "dhcp4", "dhcp6":
+			dhcp = true
+			continue
+		case "static", "static6":
+		default:
+			return nil, fmt.Errorf("unsupported subnet type %q", s.Type)
+		}
+
+		addr, err := parseIPNet(s.Address, s.Netmask)
+		if err != nil {
+			return nil, err
+		}
+		static.addresses = append(static.addresses, *addr)
+
+		for _, ns := range s.DNSNameservers {
+			ip := net.ParseIP(ns)
+			if ip == nil {
+				return nil, fmt.Errorf("could not parse %q as nameserver IP address", ns)
+			}
+			static.nameservers = append(static.nameservers, ip)
+		}
+
+		if s.Gateway != "" {
+			gateway := net.ParseIP(s.Gateway)
+			if gateway == nil {
+				return nil, fmt.Errorf("could not parse %q as gateway", s.Gateway)
+			}
+			destination := net.IPNet{IP: net.IPv4zero, Mask: net.IPMask(net.IPv4zero)}
+			if gateway.To4() == nil {
+				destination = net.IPNet{IP: net.IPv6zero, Mask: net.IPMask(net.IPv6zero)}
+			}
+			static.routes = append(static.routes, route{destination, gateway})
+		}
+
+		for _, r := range s.Routes {
+			destination, err := parseIPNet(r.Network, r.Netmask)
+			if err != nil {
+				return nil, err
+			}
+			gateway := net.ParseIP(r.Gateway)
+			if gateway == nil {
+				return nil, fmt.Errorf("could not parse %q as gateway", r.Gateway)
+			}
+			static.routes = append(static.routes, route{*destination, gateway})
+		}
+	}
+
+	if len(static.addresses) == 0 && dhcp {
+		return configMethodDHCP{}, nil
+	}
+	return static, nil
+}
+
+// parseIPNet accepts either an address in CIDR notation or an
+// address with a separate netmask.
+func parseIPNet(address, netmask string) (*net.IPNet, error) {
+	if strings.Contains(address, "/") {
+		ip, ipnet, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, err
+		}
+		return &net.IPNet{IP: ip, Mask: ipnet.Mask}, nil
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("could not parse %q as IP address", address)
+	}
+	mask := net.ParseIP(netmask)
+	if mask == nil {
+		return nil, fmt.Errorf("could not parse %q as netmask", netmask)
+	}
+	if ip.To4() != nil {
+		return &net.IPNet{IP: ip.To4(), Mask: net.IPMask(mask.To4())}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.IPMask(mask)}, nil
+}
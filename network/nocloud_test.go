@@ -0,0 +1,105 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestProcessNoCloudNetconf(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		fail bool
+		n    int
+	}{
+		{"", false, 0},
+		{"iface eth1 inet manual", false, 1},
+		{"version: 2\nethernets: {}", true, -1},
+		{"network:\n  version: 1\n  config:\n    - type: physical\n      name: eth0\n      subnets:\n        - type: dhcp", false, 1},
+		{"version: 1\nconfig:\n  - type: physical\n    subnets:\n      - type: dhcp", true, -1},
+		{"version: 1\nconfig:\n  - type: bridge\n    name: br0", true, -1},
+		{"version: 1\nconfig:\n  - type: physical\n    name: eth0\n  - type: vlan\n    name: eth0.10\n    vlan_link: eth0\n    vlan_id: 10", false, 2},
+		{"version: 1\nconfig:\n  - type: bond\n    name: bond0\n    bond_interfaces: [eth0, eth1]\n    params:\n      bond-mode: 802.3ad", false, 3},
+	} {
+		interfaces, err := ProcessNoCloudNetconf([]byte(tt.in))
+		failed := err != nil
+		if tt.fail != failed {
+			t.Fatalf("bad failure state for %q: got %t (%v), want %t", tt.in, failed, err, tt.fail)
+		}
+		if tt.n != -1 && tt.n != len(interfaces) {
+			t.Fatalf("bad number of interfaces for %q: got %d, want %d", tt.in, len(interfaces), tt.n)
+		}
+	}
+}
+
+func TestParseNoCloudSubnets(t *testing.T) {
+	for _, tt := range []struct {
+		subnets     []noCloudSubnet
+		nameservers []net.IP
+		conf        configMethod
+		fail        bool
+	}{
+		{
+			conf: configMethodManual{},
+		},
+		{
+			subnets: []noCloudSubnet{{Type: "dhcp4"}},
+			conf:    configMethodDHCP{},
+		},
+		{
+			subnets: []noCloudSubnet{{Type: "manual"}},
+			fail:    true,
+		},
+		{
+			subnets: []noCloudSubnet{{Type: "static", Address: "bad"}},
+			fail:    true,
+		},
+		{
+			subnets: []noCloudSubnet{
+				{Type: "dhcp6"},
+				{
+					Type:           "static",
+					Address:        "192.168.1.10",
+					Netmask:        "255.255.255.0",
+					Gateway:        "192.168.1.1",
+					DNSNameservers: []string{"8.8.8.8"},
+				},
+				{Type: "static6", Address: "fe00::10/64", Gateway: "fe00::1"},
+			},
+			nameservers: []net.IP{net.ParseIP("8.8.4.4")},
+			conf: configMethodStatic{
+				addresses: []net.IPNet{
+					{IP: net.ParseIP("192.168.1.10").To4(), Mask: net.CIDRMask(24, 32)},
+					{IP: net.ParseIP("fe00::10"), Mask: net.CIDRMask(64, 128)},
+				},
+				nameservers: []net.IP{net.ParseIP("8.8.4.4"), net.ParseIP("8.8.8.8")},
+				routes: []route{
+					{net.IPNet{IP: net.IPv4zero, Mask: net.IPMask(net.IPv4zero)}, net.ParseIP("192.168.1.1")},
+					{net.IPNet{IP: net.IPv6zero, Mask: net.IPMask(net.IPv6zero)}, net.ParseIP("fe00::1")},
+				},
+			},
+		},
+	} {
+		conf, err := parseNoCloudSubnets(tt.subnets, tt.nameservers)
+		if failed := err != nil; tt.fail != failed {
+			t.Fatalf("bad failure state for %+v: got %t (%v), want %t", tt.subnets, failed, err, tt.fail)
+		}
+		if !tt.fail && !reflect.DeepEqual(tt.conf, conf) {
+			t.Fatalf("bad config method for %+v: want %#v, got %#v", tt.subnets, tt.conf, conf)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/openstack"
+)
+
+// ProcessOpenStackNetconf translates an OpenStack network_data.json document
+// into interfaces. Older config drives only provide Debian interfaces
+// stanzas; these are passed through to ProcessDebianNetconf.
+func ProcessOpenStackNetconf(config []byte) ([]InterfaceGenerator, error) {
+	log.Println("Processing OpenStack network config")
+	if len(config) == 0 {
+		return nil, nil
+	}
+
+	var cfg openstack.NetworkData
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return ProcessDebianNetconf(config)
+		}
+		return nil, err
+	}
+
+	log.Println("Parsing nameservers")
+	nameservers, err := parseOpenStackServices(cfg.Services)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Parsed %d nameservers\n", len(nameservers))
+
+	log.Println("Parsing interfaces")
+	interfaceMap, err := parseOpenStackLinks(cfg, nameservers)
+	if err != nil {
+		return nil, err
+	}
+	linkAncestors(interfaceMap)
+	markConfigDepths(interfaceMap)
+	log.Printf("Parsed %d network interfaces\n", len(interfaceMap))
+
+	interfaces := make([]InterfaceGenerator, 0, len(interfaceMap))
+	for _, name := range sortedInterfaces(interfaceMap) {
+		interfaces = append(interfaces, interfaceMap[name])
+	}
+
+	log.Println("Processed OpenStack network config")
+	return interfaces, nil
+}
+
+// maxInterfaceNameLen is the longest name the kernel accepts for an
+// interface.
+const maxInterfaceNameLen = 15
+
+func parseOpenStackServices(services []openstack.Service) ([]net.IP, error) {
+	nameservers := []net.IP{}
+	for _, s := range services {
+		if s.Type != "dns" {
+			continue
+		}
+		ip := net.ParseIP(s.Address)
+		if ip == nil {
+			return nil, fmt.Errorf("could not parse %q as nameserver IP address", s.Address)
+		}
+		nameservers = append(nameservers, ip)
+	}
+	return nameservers, nil
+}
+
+// parseOpenStackLinks creates an interface for every link. Physical
+// interfaces aren't named by OpenStack and are matched by their MAC address,
+// so they are keyed by their link ID. Bonds are named after their link ID and
+// VLANs after their parent and VLAN ID. Bond slaves and VLAN parents refer to
+// link IDs, which is what linkAncestors expects.
+func parseOpenStackLinks(cfg openstack.NetworkData, nameservers []net.IP) (map[string]networkInterface, error) {
+	links := make(map[string]openstack.Link, len(cfg.Links))
+	indexes := make(map[string]int, len(cfg.Links))
+	for i, link := range cfg.Links {
+		links[link.ID] = link
+		indexes[link.ID] = i
+	}
+
+	interfaceMap := make(map[string]networkInterface, len(cfg.Links))
+	for _, link := range cfg.Links {
+		var networks []openstack.Network
+		for _, n := range cfg.Networks {
+			if n.Link == link.ID {
+				networks = append(networks, n)
+			}
+		}
+
+		mac := link.EthernetMACAddress
+		if link.Type == "vlan" {
+			mac = link.VLANMACAddress
+		}
+		var hwaddr net.HardwareAddr
+		if mac != "" {
+			var err error
+			if hwaddr, err = net.ParseMAC(mac); err != nil {
+				return nil, err
+			}
+		}
+
+		config, err := parseOpenStackNetworks(link.ID, networks, nameservers, hwaddr)
+		if err != nil {
+			return nil, err
+		}
+
+		switch link.Type {
+		case "bond":
+			options := map[string]string{}
+			if link.BondMode != "" {
+				options["mode"] = link.BondMode
+			}
+			if link.BondMIIMon != 0 {
+				options["miimon"] = fmt.Sprintf("%d", link.BondMIIMon)
+			}
+			if link.BondHashPolicy != "" {
+				options["xmit_hash_policy"] = link.BondHashPolicy
+			}
+			interfaceMap[link.ID] = &bondInterface{
+				logicalInterface{
+					name:     link.ID,
+					config:   config,
+					children: []networkInterface{},
+					mtu:      link.MTU,
+				},
+				link.BondLinks,
+				options,
+			}
+		case "vlan":
+			parent, ok := links[link.VLANLink]
+			if !ok {
+				return nil, fmt.Errorf("vlan %q has unknown link %q", link.ID, link.VLANLink)
+			}
+			// Physical parents are named by the kernel rather than
+			// after their link ID, which may also be too long to
+			// name an interface; refer to them by their position.
+			name := fmt.Sprintf("%s.%d", parent.ID, link.VLANID)
+			if parent.Type != "bond" || len(name) > maxInterfaceNameLen {
+				name = fmt.Sprintf("vlan%d.%d", indexes[parent.ID], link.VLANID)
+			}
+			interfaceMap[name] = &vlanInterface{
+				logicalInterface{
+					name:     name,
+					config:   config,
+					children: []networkInterface{},
+					mtu:      link.MTU,
+				},
+				link.VLANID,
+				link.VLANLink,
+			}
+		default:
+			if hwaddr == nil {
+				return nil, fmt.Errorf("link %q has no MAC address", link.ID)
+			}
+			interfaceMap[link.ID] = &physicalInterface{
+				logicalInterface{
+					hwaddr:   hwaddr,
+					config:   config,
+					children: []networkInterface{},
+					mtu:      link.MTU,
+				},
+			}
+		}
+	}
+	return interfaceMap, nil
+}
+
+// parseOpenStackNetworks collapses the networks attached to a link into a
+// single config method. Static networks take precedence over DHCP ones.
+// SLAAC networks need no configuration, since the kernel configures their
+// addresses from router advertisements.
+func parseOpenStackNetworks(linkID string, networks []openstack.Network, nameservers []net.IP, hwaddr net.HardwareAddr) (configMethod, error) {
+	if len(networks) == 0 {
+		return configMethodManual{}, nil
+	}
+
+	static := configMethodStatic{
+		nameservers: append([]net.IP{}, nameservers...),
+		hwaddress:   hwaddr,
+	}
+	dhcp := false
+	for _, n := range networks {
+		switch n.Type {
+		case "ipv4_dhcp", "ipv6_dhcp":
+			dhcp = true
+			continue
+		case "ipv6_slaac":
+			log.Printf("Leaving the IPv6 addresses of link %q to SLAAC", linkID)
+			continue
+		case "ipv4", "ipv6":
+		default:
+			return nil, fmt.Errorf("unsupported network type %q", n.Type)
+		}
+
+		addr, err := parseIPNet(n.IPAddress, n.Netmask)
+		if err != nil {
+			return nil, err
+		}
+		static.addresses = append(static.addresses, *addr)
+
+		for _, r := range n.Routes {
+			destination, err := parseIPNet(r.Network, r.Netmask)
+			if err != nil {
+				return nil, err
+			}
+			gateway := net.ParseIP(r.Gateway)
+			if gateway == nil {
+				return nil, fmt.Errorf("could not parse %q as gateway", r.Gateway)
+			}
+			static.routes = append(static.routes, route{*destination, gateway})
+		}
+
+		ns, err := parseOpenStackServices(n.Services)
+		if err != nil {
+			return nil, err
+		}
+		static.nameservers = append(static.nameservers, ns...)
+	}
+
+	if len(static.addresses) == 0 && dhcp {
+		return configMethodDHCP{hwaddress: hwaddr}, nil
+	}
+	return static, nil
+}
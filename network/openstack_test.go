@@ -0,0 +1,150 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"testing"
+)
+
+func TestProcessOpenStackNetconf(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		fail bool
+		n    int
+	}{
+		{"", false, 0},
+		{"iface eth1 inet manual", false, 1},
+		{`{"links": [{"id": "eth0", "type": "phy"}]}`, true, -1},
+		{`{"links": [{"id": "eth0", "type": "phy", "ethernet_mac_address": "bad"}]}`, true, -1},
+		{`{"links": [{"id": "vlan0", "type": "vlan", "vlan_link": "eth0"}]}`, true, -1},
+		{`{"links": [{"id": "eth0", "type": "phy", "ethernet_mac_address": "aa:bb:cc:dd:ee:ff"}], "networks": [{"link": "eth0", "type": "ipv5"}]}`, true, -1},
+		{`{"links": [{"id": "eth0", "type": "phy", "ethernet_mac_address": "aa:bb:cc:dd:ee:ff"}], "services": [{"type": "dns", "address": "bad"}]}`, true, -1},
+		{`{"links": [{"id": "eth0", "type": "phy", "ethernet_mac_address": "aa:bb:cc:dd:ee:ff"}], "networks": [{"link": "eth0", "type": "ipv4_dhcp"}]}`, false, 1},
+	} {
+		interfaces, err := ProcessOpenStackNetconf([]byte(tt.in))
+		failed := err != nil
+		if tt.fail != failed {
+			t.Fatalf("bad failure state for %q: got %t (%v), want %t", tt.in, failed, err, tt.fail)
+		}
+		if tt.n != -1 && tt.n != len(interfaces) {
+			t.Fatalf("bad number of interfaces for %q: got %d, want %d", tt.in, len(interfaces), tt.n)
+		}
+	}
+}
+
+func TestProcessOpenStackNetconfBond(t *testing.T) {
+	config := `{
+	"links": [
+		{"id": "interface0", "type": "phy", "ethernet_mac_address": "a0:36:9f:2c:e8:80", "mtu": 9000},
+		{"id": "interface1", "type": "phy", "ethernet_mac_address": "a0:36:9f:2c:e8:81", "mtu": 9000},
+		{"id": "bond0", "type": "bond", "bond_links": ["interface0", "interface1"], "ethernet_mac_address": "a0:36:9f:2c:e8:82", "bond_mode": "802.3ad", "bond_miimon": 100},
+		{"id": "vlan0", "type": "vlan", "vlan_link": "bond0", "vlan_id": 101, "vlan_mac_address": "a0:36:9f:2c:e8:80"}
+	],
+	"networks": [
+		{"id": "private-ipv4", "type": "ipv4", "link": "vlan0", "ip_address": "10.184.0.244", "netmask": "255.255.240.0",
+		 "routes": [{"network": "0.0.0.0", "netmask": "0.0.0.0", "gateway": "10.184.0.1"}]},
+		{"id": "private-ipv6", "type": "ipv6", "link": "vlan0", "ip_address": "2001:cdba::3257:9652/24",
+		 "services": [{"type": "dns", "address": "2001:4860:4860::8888"}]}
+	],
+	"services": [{"type": "dns", "address": "8.8.8.8"}]
+}`
+	interfaces, err := ProcessOpenStackNetconf([]byte(config))
+	if err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+
+	expect := []struct {
+		name     string
+		filename string
+		netdev   string
+		network  string
+		params   string
+	}{
+		{
+			name:     "bond0",
+			filename: "01-bond0",
+			netdev:   "[NetDev]\nKind=bond\nName=bond0\n",
+			network:  "[Match]\nName=bond0\n\n[Network]\nVLAN=bond0.101\n",
+			params:   "miimon=100 mode=802.3ad",
+		},
+		{
+			name:     "bond0.101",
+			filename: "00-bond0.101",
+			netdev:   "[NetDev]\nKind=vlan\nName=bond0.101\nMACAddress=a0:36:9f:2c:e8:80\n\n[VLAN]\nId=101\n",
+			network:  "[Match]\nName=bond0.101\n\n[Network]\nDNS=8.8.8.8\nDNS=2001:4860:4860::8888\n\n[Address]\nAddress=10.184.0.244/20\n\n[Address]\nAddress=2001:cdba::3257:9652/24\n\n[Route]\nDestination=0.0.0.0/0\nGateway=10.184.0.1\n",
+		},
+		{
+			filename: "02-a0:36:9f:2c:e8:80",
+			network:  "[Match]\nMACAddress=a0:36:9f:2c:e8:80\n\n[Link]\nMTUBytes=9000\n\n[Network]\nBond=bond0\n",
+		},
+		{
+			filename: "02-a0:36:9f:2c:e8:81",
+			network:  "[Match]\nMACAddress=a0:36:9f:2c:e8:81\n\n[Link]\nMTUBytes=9000\n\n[Network]\nBond=bond0\n",
+		},
+	}
+	if len(interfaces) != len(expect) {
+		t.Fatalf("bad number of interfaces: want %d, got %d", len(expect), len(interfaces))
+	}
+	for i, e := range expect {
+		iface := interfaces[i]
+		if iface.Name() != e.name {
+			t.Errorf("bad name (%d): want %q, got %q", i, e.name, iface.Name())
+		}
+		if iface.Filename() != e.filename {
+			t.Errorf("bad filename (%d): want %q, got %q", i, e.filename, iface.Filename())
+		}
+		if iface.Netdev() != e.netdev {
+			t.Errorf("bad netdev (%d): want %q, got %q", i, e.netdev, iface.Netdev())
+		}
+		if iface.Network() != e.network {
+			t.Errorf("bad network (%d): want %q, got %q", i, e.network, iface.Network())
+		}
+		if iface.ModprobeParams() != e.params {
+			t.Errorf("bad modprobe params (%d): want %q, got %q", i, e.params, iface.ModprobeParams())
+		}
+	}
+}
+
+func TestProcessOpenStackNetconfVLANs(t *testing.T) {
+	config := `{
+	"links": [
+		{"id": "tap1a81968a-79", "type": "phy", "ethernet_mac_address": "a0:36:9f:2c:e8:80"},
+		{"id": "tap2b92a79b-8a", "type": "phy", "ethernet_mac_address": "a0:36:9f:2c:e8:81"},
+		{"id": "vlan0", "type": "vlan", "vlan_link": "tap1a81968a-79", "vlan_id": 101, "vlan_mac_address": "a0:36:9f:2c:e8:80", "mtu": 1400},
+		{"id": "vlan1", "type": "vlan", "vlan_link": "tap2b92a79b-8a", "vlan_id": 101, "vlan_mac_address": "a0:36:9f:2c:e8:81"}
+	],
+	"networks": [
+		{"id": "private-ipv4", "type": "ipv4_dhcp", "link": "vlan0"},
+		{"id": "private-ipv6", "type": "ipv6_slaac", "link": "vlan1"}
+	]
+}`
+	interfaces, err := ProcessOpenStackNetconf([]byte(config))
+	if err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+
+	networks := map[string]string{}
+	for _, iface := range interfaces {
+		networks[iface.Name()] = iface.Network()
+	}
+	for name, network := range map[string]string{
+		"vlan0.101": "[Match]\nName=vlan0.101\n\n[Link]\nMTUBytes=1400\n\n[Network]\nDHCP=true\n",
+		"vlan1.101": "[Match]\nName=vlan1.101\n\n[Network]\n",
+	} {
+		if networks[name] != network {
+			t.Errorf("bad network (%s): want %q, got %q", name, network, networks[name])
+		}
+	}
+}
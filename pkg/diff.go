@@ -0,0 +1,158 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	a, b int  // index of the line in from and to
+}
+
+// UnifiedDiff returns the changes from from to to in the unified diff
+// format, or an empty string if they are the same.
+func UnifiedDiff(fromName, toName string, from, to []byte) string {
+	a, b := splitLines(from), splitLines(to)
+	ops := diffLines(a, b)
+
+	var out bytes.Buffer
+	for start := 0; start < len(ops); {
+		// Find the next change, then extend the hunk to every change
+		// which is close enough for their contexts to overlap.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for i := first; i < len(ops) && i-last <= 2*diffContext; i++ {
+			if ops[i].kind != ' ' {
+				last = i
+			}
+		}
+
+		lo, hi := first-diffContext, last+diffContext+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(ops) {
+			hi = len(ops)
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		var hunk bytes.Buffer
+		aLen, bLen := 0, 0
+		for _, op := range ops[lo:hi] {
+			switch op.kind {
+			case ' ':
+				aLen++
+				bLen++
+				fmt.Fprintf(&hunk, " %s\n", a[op.a])
+			case '-':
+				aLen++
+				fmt.Fprintf(&hunk, "-%s\n", a[op.a])
+			case '+':
+				bLen++
+				fmt.Fprintf(&hunk, "+%s\n", b[op.b])
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(ops[lo].a, aLen), hunkRange(ops[lo].b, bLen))
+		out.Write(hunk.Bytes())
+		start = hi
+	}
+	return out.String()
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// diffLines returns the shortest edit from a to b, computed from their
+// longest common subsequence of lines.
+func diffLines(a, b []string) []diffOp {
+	// Only the lines between the common prefix and suffix need comparing.
+	p := 0
+	for p < len(a) && p < len(b) && a[p] == b[p] {
+		p++
+	}
+	s := 0
+	for s < len(a)-p && s < len(b)-p && a[len(a)-1-s] == b[len(b)-1-s] {
+		s++
+	}
+	n, m := len(a)-p-s, len(b)-p-s
+
+	// lcs[i][j] is the length of the longest common subsequence of the
+	// middle of a from i and the middle of b from j.
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[p+i] == b[p+j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	for i := 0; i < p; i++ {
+		ops = append(ops, diffOp{' ', i, i})
+	}
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[p+i] == b[p+j]:
+			ops = append(ops, diffOp{' ', p + i, p + j})
+			i++
+			j++
+		case j == m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', p + i, p + j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', p + i, p + j})
+			j++
+		}
+	}
+	for k := 0; k < s; k++ {
+		ops = append(ops, diffOp{' ', p + n + k, p + m + k})
+	}
+	return ops
+}
@@ -0,0 +1,59 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+
+		diff string
+	}{
+		{
+			from: "a\nb\n",
+			to:   "a\nb\n",
+		},
+		{
+			from: "",
+			to:   "a\n",
+			diff: "--- from\n+++ to\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+		{
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			to:   "1\n2\n3\n4\nfive\n6\n7\n8\n",
+			diff: "--- from\n+++ to\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			to:   "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			diff: "--- from\n+++ to\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,3 @@\n 9\n 10\n 11\n-12\n",
+		},
+		{
+			from: "a\nb\nc\n",
+			to:   "b\nc\na\n",
+			diff: "--- from\n+++ to\n@@ -1,3 +1,3 @@\n-a\n b\n c\n+a\n",
+		},
+	}
+
+	for i, tt := range tests {
+		if diff := UnifiedDiff("from", "to", []byte(tt.from), []byte(tt.to)); diff != tt.diff {
+			t.Errorf("bad diff (%d): want %q, got %q", i, tt.diff, diff)
+		}
+	}
+}
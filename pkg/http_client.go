@@ -24,6 +24,7 @@ import (
 	"net/http"
 	neturl "net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -42,6 +43,10 @@ type ErrNotFound struct {
 	Err
 }
 
+type ErrUnauthorized struct {
+	Err
+}
+
 type ErrInvalid struct {
 	Err
 }
@@ -68,6 +73,15 @@ type HttpClient struct {
 	// Whether or not to skip TLS verification. Defaults to false
 	SkipTLS bool
 
+	// Whether 401 responses are reported as ErrUnauthorized rather than
+	// ErrNotFound. Defaults to false
+	ReportUnauthorized bool
+
+	// Headers added to every request made by the client, guarded by
+	// headerMutex since they may be set while requests are being made
+	header      http.Header
+	headerMutex sync.Mutex
+
 	client *http.Client
 }
 
@@ -77,11 +91,18 @@ type Getter interface {
 }
 
 func NewHttpClient() *HttpClient {
+	return NewHttpClientHeader(nil)
+}
+
+// NewHttpClientHeader returns a client which adds the given headers to every
+// request it makes (e.g. the Metadata-Flavor header required by GCE).
+func NewHttpClientHeader(header http.Header) *HttpClient {
 	hc := &HttpClient{
 		MaxBackoff: time.Second * 5,
 		MaxRetries: 15,
 		Timeout:    time.Duration(2) * time.Second,
 		SkipTLS:    false,
+		header:     header,
 	}
 
 	// We need to create our own client in order to add timeout support.
@@ -159,12 +180,48 @@ func (h *HttpClient) GetRetry(rawurl string) ([]byte, error) {
 }
 
 func (h *HttpClient) Get(dataURL string) ([]byte, error) {
-	if resp, err := h.client.Get(dataURL); err == nil {
+	return h.do("GET", dataURL, nil)
+}
+
+// Put makes a single PUT request with an empty body, adding the provided
+// headers to the client's own.
+func (h *HttpClient) Put(dataURL string, header http.Header) ([]byte, error) {
+	return h.do("PUT", dataURL, header)
+}
+
+// SetHeader sets a header which is added to every subsequent request.
+func (h *HttpClient) SetHeader(key, value string) {
+	h.headerMutex.Lock()
+	defer h.headerMutex.Unlock()
+	if h.header == nil {
+		h.header = http.Header{}
+	}
+	h.header.Set(key, value)
+}
+
+func (h *HttpClient) do(method, dataURL string, header http.Header) ([]byte, error) {
+	request, err := http.NewRequest(method, dataURL, nil)
+	if err != nil {
+		return nil, ErrInvalid{err}
+	}
+	h.headerMutex.Lock()
+	for _, hs := range []http.Header{h.header, header} {
+		for k, vs := range hs {
+			for _, v := range vs {
+				request.Header.Add(k, v)
+			}
+		}
+	}
+	h.headerMutex.Unlock()
+
+	if resp, err := h.client.Do(request); err == nil {
 		defer resp.Body.Close()
-		switch resp.StatusCode / 100 {
-		case HTTP_2xx:
+		switch {
+		case resp.StatusCode/100 == HTTP_2xx:
 			return ioutil.ReadAll(resp.Body)
-		case HTTP_4xx:
+		case resp.StatusCode == http.StatusUnauthorized && h.ReportUnauthorized:
+			return nil, ErrUnauthorized{fmt.Errorf("Unauthorized. HTTP status code: %d", resp.StatusCode)}
+		case resp.StatusCode/100 == HTTP_4xx:
 			return nil, ErrNotFound{fmt.Errorf("Not found. HTTP status code: %d", resp.StatusCode)}
 		default:
 			return nil, ErrServer{fmt.Errorf("Server error. HTTP status code: %d", resp.StatusCode)}
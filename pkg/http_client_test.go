@@ -100,6 +100,50 @@ func TestGetURL4xx(t *testing.T) {
 	}
 }
 
+// Test that a 401 response is only reported as unauthorized rather than not
+// found if the client asks for it
+func TestGetURL401(t *testing.T) {
+	client := NewHttpClient()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "", 401)
+	}))
+	defer ts.Close()
+
+	_, err := client.GetRetry(ts.URL)
+	if _, ok := err.(ErrNotFound); !ok {
+		t.Errorf("Incorrect result\ngot:  %#v\nwant: %s", err, "ErrNotFound")
+	}
+
+	client.ReportUnauthorized = true
+	_, err = client.GetRetry(ts.URL)
+	if _, ok := err.(ErrUnauthorized); !ok {
+		t.Errorf("Incorrect result\ngot:  %#v\nwant: %s", err, "ErrUnauthorized")
+	}
+}
+
+// Test that PUT requests carry both the client and the request headers
+func TestPutURL(t *testing.T) {
+	client := NewHttpClient()
+	client.SetHeader("A", "1")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.Header.Get("A") != "1" || r.Header.Get("B") != "2" {
+			http.Error(w, "", 400)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	data, err := client.Put(ts.URL, http.Header{"B": {"2"}})
+	if err != nil {
+		t.Errorf("Incorrect result\ngot:  %v\nwant: %v", err, nil)
+	}
+
+	if string(data) != "ok" {
+		t.Errorf("Incorrect result\ngot:  %s\nwant: %s", string(data), "ok")
+	}
+}
+
 // Test that it fetches and returns user-data just fine
 func TestGetURL2xx(t *testing.T) {
 	var cloudcfg = `
@@ -131,6 +175,28 @@ coreos:
 	}
 }
 
+// Test that the provided headers are sent with every request
+func TestGetURLHeader(t *testing.T) {
+	client := NewHttpClientHeader(http.Header{"Metadata-Flavor": {"Google"}})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "", 403)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	data, err := client.GetRetry(ts.URL)
+	if err != nil {
+		t.Errorf("Incorrect result\ngot:  %v\nwant: %v", err, nil)
+	}
+
+	if string(data) != "ok" {
+		t.Errorf("Incorrect result\ngot:  %s\nwant: %s", string(data), "ok")
+	}
+}
+
 // Test attempt to fetching using malformed URL
 func TestGetMalformedURL(t *testing.T) {
 	client := NewHttpClient()
@@ -0,0 +1,38 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/coreos/coreos-cloudinit/config/validate"
+)
+
+// schemaCommand prints the JSON Schema of cloud-config, for editors and for
+// validating cloud-configs without coreos-cloudinit.
+func schemaCommand(args []string) int {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	fs.Parse(args)
+
+	data, err := json.MarshalIndent(validate.NewSchema(), "", "  ")
+	if err != nil {
+		fmt.Printf("Failed encoding schema: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return 0
+}
@@ -0,0 +1,140 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/config/validate"
+)
+
+// serveValidateCommand serves the validation of user-data over HTTP: each
+// user-data POSTed to /validate is answered with its kind and the entries of
+// its report, as JSON.
+func serveValidateCommand(args []string) int {
+	fs := flag.NewFlagSet("serve-validate", flag.ExitOnError)
+	listen := fs.String("listen", ":8080", "Address to listen on")
+	maxBodySize := fs.Int64("max-body-size", 1<<20, "Reject user-data larger than the given number of bytes")
+	readTimeout := fs.Duration("read-timeout", 10*time.Second, "How long to wait for each request to be read")
+	validateTimeout := fs.Duration("validate-timeout", 10*time.Second, "How long to wait for the validation of each user-data before answering that it timed out")
+	maxValidations := fs.Int("max-validations", runtime.NumCPU(), "Reject requests while the given number of validations are running")
+	fs.Parse(args)
+
+	// The timeout only abandons the response: the validation carries on
+	// until it is done, which is why the number of validations running at
+	// once is capped too.
+	h := newValidateHandler(*maxBodySize, *maxValidations)
+	mux := http.NewServeMux()
+	mux.Handle("/validate", http.TimeoutHandler(h, *validateTimeout, "validation timed out\n"))
+	server := &http.Server{
+		Addr:         *listen,
+		Handler:      mux,
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *readTimeout + *validateTimeout,
+	}
+
+	log.Printf("Serving validation on %s", *listen)
+	if err := server.ListenAndServe(); err != nil {
+		log.Printf("Failed serving validation: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// validateResponse is the body of the responses to successful validations.
+type validateResponse struct {
+	Kind    string           `json:"kind"`
+	Entries []validate.Entry `json:"entries"`
+}
+
+// validateHandler validates the user-data in the body of POST requests,
+// rejecting those larger than maxBodySize bytes, as well as any request made
+// while as many validations as validations can hold are running.
+type validateHandler struct {
+	maxBodySize int64
+	validations chan struct{}
+}
+
+func newValidateHandler(maxBodySize int64, maxValidations int) validateHandler {
+	return validateHandler{
+		maxBodySize: maxBodySize,
+		validations: make(chan struct{}, maxValidations),
+	}
+}
+
+func (h validateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "user-data must be POSTed")
+		return
+	}
+
+	select {
+	case h.validations <- struct{}{}:
+		defer func() { <-h.validations }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		writeJSONError(w, http.StatusServiceUnavailable, "too many validations in progress")
+		return
+	}
+
+	// Read one byte more than allowed to tell whether the body is too large.
+	userdata, err := ioutil.ReadAll(io.LimitReader(r.Body, h.maxBodySize+1))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("failed reading user-data: %v", err))
+		return
+	}
+	if int64(len(userdata)) > h.maxBodySize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("user-data is larger than %d bytes", h.maxBodySize))
+		return
+	}
+
+	report, err := validate.Validate(userdata)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed validating user-data: %v", err))
+		return
+	}
+	entries := report.Entries()
+	if entries == nil {
+		entries = []validate.Entry{}
+	}
+	writeJSON(w, http.StatusOK, validateResponse{
+		Kind:    validate.DetectKind(userdata),
+		Entries: entries,
+	})
+}
+
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		code = http.StatusInternalServerError
+		data = []byte(`{"error":"failed encoding response"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(data, '\n'))
+}
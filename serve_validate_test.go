@@ -0,0 +1,148 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestValidateHandler(t *testing.T) {
+	tests := []struct {
+		method   string
+		userdata string
+
+		code int
+		body string
+	}{
+		{
+			"POST",
+			"#cloud-config\nhostname: test\nbad: key\n",
+			http.StatusOK,
+			`{"kind":"cloud-config","entries":[{"column":1,"kind":"warning","line":3,"message":"unrecognized key \"bad\"","rule":"structure"}]}`,
+		},
+		{
+			"POST",
+			"#!/bin/bash\necho hey\n",
+			http.StatusOK,
+			`{"kind":"script","entries":[]}`,
+		},
+		{
+			"POST",
+			"Content-Type: multipart/mixed; boundary=abc\n\n--abc\nContent-Type: text/cloud-config\n\nhostname: test\n--abc--\n",
+			http.StatusOK,
+			`{"kind":"multipart","entries":[]}`,
+		},
+		{
+			"POST",
+			"hostname: test\n",
+			http.StatusOK,
+			`{"kind":"unknown","entries":[{"column":0,"kind":"error","line":1,"message":"must be \"#cloud-config\" or begin with \"#!\"","rule":"user-data"}]}`,
+		},
+		{
+			"POST",
+			"#cloud-config\nhostname: " + strings.Repeat("a", 128) + "\n",
+			http.StatusRequestEntityTooLarge,
+			`{"error":"user-data is larger than 128 bytes"}`,
+		},
+		{
+			"GET",
+			"",
+			http.StatusMethodNotAllowed,
+			`{"error":"user-data must be POSTed"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		r, err := http.NewRequest(tt.method, "/validate", strings.NewReader(tt.userdata))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		newValidateHandler(128, 1).ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("bad code (%q): want %d, got %d", tt.userdata, tt.code, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("bad content type (%q): want %q, got %q", tt.userdata, "application/json", ct)
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != tt.body {
+			t.Errorf("bad body (%q): want %s, got %s", tt.userdata, tt.body, body)
+		}
+	}
+}
+
+func TestValidateHandlerConcurrently(t *testing.T) {
+	h := newValidateHandler(1<<20, 4)
+	userdata := "#cloud-config\ncoreos:\n  update:\n    reboot-strategy: off\n"
+	want := `{"kind":"cloud-config","entries":[]}`
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := http.NewRequest("POST", "/validate", strings.NewReader(userdata))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			codes <- w.Code
+			if w.Code == http.StatusOK && strings.TrimSpace(w.Body.String()) != want {
+				t.Errorf("bad body: want %s, got %s", want, w.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK && code != http.StatusServiceUnavailable {
+			t.Errorf("bad code: want %d or %d, got %d", http.StatusOK, http.StatusServiceUnavailable, code)
+		}
+	}
+}
+
+func TestValidateHandlerBusy(t *testing.T) {
+	h := newValidateHandler(1<<20, 1)
+	h.validations <- struct{}{}
+
+	r, err := http.NewRequest("POST", "/validate", strings.NewReader("#cloud-config\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("bad code: want %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	<-h.validations
+	w = httptest.NewRecorder()
+	r, err = http.NewRequest("POST", "/validate", strings.NewReader("#cloud-config\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("bad code: want %d, got %d", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/initialize"
+)
+
+const statusPollInterval = time.Second
+
+// statusGracePeriod is how long --wait waits for a run to start during the
+// current boot before reporting that coreos-cloudinit has not run.
+var statusGracePeriod = 30 * time.Second
+
+// statusCommand prints the status of the last run of each invocation from
+// the workspace. It exits with 0 only if all of those runs finished
+// successfully. With --wait, it only considers the runs started during the
+// current boot and first waits for them to finish, or for --timeout to pass.
+// If no run starts within statusGracePeriod, it reports that none happened.
+func statusCommand(args []string) int {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	workspace := fs.String("workspace", "/var/lib/coreos-cloudinit", "Base directory coreos-cloudinit uses to store data")
+	wait := fs.Bool("wait", false, "Wait until the runs started during the current boot have finished")
+	timeout := fs.Duration("timeout", datasourceTimeout, "With --wait, give up waiting after the given duration (0 means no limit)")
+	fs.Parse(args)
+
+	boot := bootTime("/proc/stat")
+	started := time.Now()
+	var deadline time.Time
+	if *timeout > 0 {
+		deadline = time.Now().Add(*timeout)
+	}
+	for {
+		statuses, err := initialize.ReadStatuses(*workspace)
+		if err != nil {
+			fmt.Printf("Failed reading status: %v\n", err)
+			return 1
+		}
+		if *wait {
+			statuses = startedSince(statuses, boot)
+		}
+
+		done := len(statuses) > 0
+		success := done
+		for _, status := range statuses {
+			if status.Finished == nil {
+				done, success = false, false
+			} else if !status.Success {
+				success = false
+			}
+		}
+		if *wait && len(statuses) == 0 && time.Since(started) >= statusGracePeriod {
+			fmt.Println("coreos-cloudinit has not run during this boot")
+			return 1
+		}
+		if *wait && !done {
+			if deadline.IsZero() || time.Now().Before(deadline) {
+				time.Sleep(statusPollInterval)
+				continue
+			}
+			fmt.Println("Timed out waiting for coreos-cloudinit to finish")
+		}
+
+		if len(statuses) == 0 {
+			fmt.Println("coreos-cloudinit has not run")
+			return 1
+		}
+		data, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			fmt.Printf("Failed encoding status: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(data))
+		if success {
+			return 0
+		}
+		return 1
+	}
+}
+
+// startedSince returns the statuses of the runs which started at or after t.
+func startedSince(statuses []*initialize.Status, t time.Time) []*initialize.Status {
+	var since []*initialize.Status
+	for _, status := range statuses {
+		if !status.Started.Before(t) {
+			since = append(since, status)
+		}
+	}
+	return since
+}
+
+// bootTime returns the time at which the system booted, read from the btime
+// line of the given /proc/stat file, or the zero time if it is unknown.
+func bootTime(stat string) time.Time {
+	f, err := os.Open(stat)
+	if err != nil {
+		return time.Time{}
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "btime" {
+			if secs, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				return time.Unix(secs, 0)
+			}
+		}
+	}
+	return time.Time{}
+}
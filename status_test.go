@@ -0,0 +1,94 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/initialize"
+)
+
+func TestBootTime(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	stat := path.Join(dir, "stat")
+	if err := ioutil.WriteFile(stat, []byte("cpu  1 2 3\nbtime 1443657600\nprocesses 42\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if boot := bootTime(stat); !boot.Equal(time.Unix(1443657600, 0)) {
+		t.Errorf("bad boot time: %v", boot)
+	}
+	if boot := bootTime(path.Join(dir, "missing")); !boot.IsZero() {
+		t.Errorf("bad boot time for a missing file: %v", boot)
+	}
+}
+
+func TestStatusCommand(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if code := statusCommand([]string{"--workspace", dir}); code != 1 {
+		t.Errorf("bad exit code without a status: want 1, got %d", code)
+	}
+
+	defer func(d time.Duration) { statusGracePeriod = d }(statusGracePeriod)
+	statusGracePeriod = 0
+	if code := statusCommand([]string{"--workspace", dir, "--wait", "--timeout", "0"}); code != 1 {
+		t.Errorf("bad exit code waiting without a status: want 1, got %d", code)
+	}
+
+	oem := initialize.NewStatus("--oem=ec2-compat")
+	if err := oem.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	if code := statusCommand([]string{"--workspace", dir}); code != 1 {
+		t.Errorf("bad exit code for a running status: want 1, got %d", code)
+	}
+
+	oem.Finish(0)
+	if err := oem.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	if code := statusCommand([]string{"--workspace", dir, "--wait"}); code != 0 {
+		t.Errorf("bad exit code for a successful status: want 0, got %d", code)
+	}
+
+	user := initialize.NewStatus("--from-file=/var/lib/coreos-install/user_data")
+	if err := user.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	if code := statusCommand([]string{"--workspace", dir, "--wait", "--timeout", "10ms"}); code != 1 {
+		t.Errorf("bad exit code while another invocation is running: want 1, got %d", code)
+	}
+
+	user.Finish(1)
+	if err := user.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	if code := statusCommand([]string{"--workspace", dir, "--wait"}); code != 1 {
+		t.Errorf("bad exit code for a failed invocation: want 1, got %d", code)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/network"
+)
+
+// HostManager makes the changes to the system which don't involve units.
+type HostManager interface {
+	SetHostname(hostname string) error
+	UserExists(user *config.User) bool
+	CreateUser(user *config.User) error
+	SetUserPassword(user, hash string) error
+	AuthorizeSSHKeys(user, keysName string, keys []string) error
+	WriteFile(file *File, root string) (string, error)
+	WriteEnvFile(envFile *EnvFile, root string) error
+	RestartNetwork(interfaces []network.InterfaceGenerator) error
+}
+
+// NewHostManager returns a HostManager which changes the running system.
+func NewHostManager() HostManager {
+	return &host{}
+}
+
+type host struct{}
+
+func (h *host) SetHostname(hostname string) error {
+	return SetHostname(hostname)
+}
+
+func (h *host) UserExists(user *config.User) bool {
+	return UserExists(user)
+}
+
+func (h *host) CreateUser(user *config.User) error {
+	return CreateUser(user)
+}
+
+func (h *host) SetUserPassword(user, hash string) error {
+	return SetUserPassword(user, hash)
+}
+
+func (h *host) AuthorizeSSHKeys(user, keysName string, keys []string) error {
+	return AuthorizeSSHKeys(user, keysName, keys)
+}
+
+func (h *host) WriteFile(file *File, root string) (string, error) {
+	return WriteFile(file, root)
+}
+
+func (h *host) WriteEnvFile(envFile *EnvFile, root string) error {
+	return WriteEnvFile(envFile, root)
+}
+
+func (h *host) RestartNetwork(interfaces []network.InterfaceGenerator) error {
+	return RestartNetwork(interfaces)
+}
@@ -91,6 +91,6 @@ func maybeProbeBonding(interfaces []network.InterfaceGenerator) error {
 func restartNetworkd() error {
 	log.Printf("Restarting networkd.service\n")
 	networkd := Unit{config.Unit{Name: "systemd-networkd.service"}}
-	_, err := NewUnitManager("").RunUnitCommand(networkd, "restart")
+	_, err := NewUnitManager("", DefaultJobTimeout).RunUnitCommand(networkd, "restart")
 	return err
 }
@@ -0,0 +1,545 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/network"
+)
+
+// FirstBootUnit is the name of the unit which Offline uses to run the
+// commands it queues.
+const FirstBootUnit = "coreos-cloudinit-first-boot.service"
+
+// chown and lchown are replaced in tests, which may not run as root.
+var (
+	chown  = os.Chown
+	lchown = os.Lchown
+)
+
+// Offline is both a HostManager and a UnitManager which applies changes to
+// the filesystem of an image at root rather than to the running system. It
+// uses neither systemd nor D-Bus: units are enabled by creating the symlinks
+// described by their [Install] section and unit commands are queued to run
+// on the first boot of the image. The accounts databases under root are
+// edited directly.
+type Offline struct {
+	root      string
+	workspace string
+	accounts  accounts
+	commands  []string
+}
+
+// NewOffline returns an Offline for the image at root. The workspace is the
+// path of coreos-cloudinit's workspace within the image.
+func NewOffline(root, workspace string) *Offline {
+	return &Offline{root: root, workspace: workspace, accounts: accounts{root}}
+}
+
+func (o *Offline) SetHostname(hostname string) error {
+	file := File{config.File{
+		Path:               "/etc/hostname",
+		Content:            hostname + "\n",
+		RawFilePermissions: "0644",
+	}}
+	_, err := WriteFile(&file, o.root)
+	return err
+}
+
+func (o *Offline) UserExists(user *config.User) bool {
+	entry, err := o.accounts.lookup("passwd", user.Name)
+	return err == nil && entry != nil
+}
+
+// CreateUser adds the user to the passwd, shadow and group databases of the
+// image, choosing ids and defaults the way useradd does.
+func (o *Offline) CreateUser(u *config.User) error {
+	passwd, err := o.accounts.passwd()
+	if err != nil {
+		return err
+	}
+	shadow, err := o.accounts.shadow()
+	if err != nil {
+		return err
+	}
+	group, err := o.accounts.group()
+	if err != nil {
+		return err
+	}
+
+	uid, err := o.accounts.freeID("passwd", u.System)
+	if err != nil {
+		return err
+	}
+
+	var gid int
+	switch {
+	case u.PrimaryGroup != "":
+		if gid, err = o.accounts.gid(u.PrimaryGroup); err != nil {
+			return err
+		}
+	case u.NoUserGroup:
+		gid = 100
+	default:
+		if entry, err := o.accounts.lookup("group", u.Name); err != nil {
+			return err
+		} else if entry != nil {
+			return fmt.Errorf("group %q already exists", u.Name)
+		}
+		used, err := o.accounts.usedIDs("group")
+		if err != nil {
+			return err
+		}
+		gid = uid
+		if used[gid] {
+			if gid, err = o.accounts.freeID("group", u.System); err != nil {
+				return err
+			}
+		}
+		group.entries = append(group.entries, []string{u.Name, "x", strconv.Itoa(gid), ""})
+	}
+
+	for _, name := range u.Groups {
+		if group.lookup(name) == nil {
+			// Copy groups from the baselayout into /etc before adding
+			// members, as usermod does.
+			base, err := o.accounts.lookup("group", name)
+			if err != nil {
+				return err
+			}
+			if base == nil {
+				return fmt.Errorf("group %q does not exist", name)
+			}
+			group.entries = append(group.entries, append([]string{}, base...))
+		}
+		for i, entry := range group.entries {
+			if entry[0] != name {
+				continue
+			}
+			for len(entry) < 4 {
+				entry = append(entry, "")
+			}
+			if entry[3] == "" {
+				entry[3] = u.Name
+			} else {
+				entry[3] += "," + u.Name
+			}
+			group.entries[i] = entry
+		}
+	}
+
+	home := u.Homedir
+	if home == "" {
+		home = path.Join("/home", u.Name)
+	}
+	hash := u.PasswordHash
+	if hash == "" {
+		hash = "*"
+	}
+	passwd.entries = append(passwd.entries, []string{u.Name, "x", strconv.Itoa(uid), strconv.Itoa(gid), u.GECOS, home, "/bin/bash"})
+	shadow.entries = append(shadow.entries, shadowEntry(u.Name, hash))
+
+	for _, db := range []*database{group, passwd, shadow} {
+		if err := db.save(); err != nil {
+			return err
+		}
+	}
+
+	if !u.NoCreateHome {
+		dir := path.Join(o.root, home)
+		if _, err := os.Stat(dir); err == nil {
+			// Like useradd, leave existing home directories alone.
+			return nil
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := chown(dir, uid, gid); err != nil {
+			return err
+		}
+		if err := copySkel(path.Join(o.root, "etc", "skel"), dir, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copySkel copies the contents of the skeleton directory into the new home
+// directory of a user, owned by the user, as useradd does.
+func copySkel(skel, home string, uid, gid int) error {
+	return filepath.Walk(skel, func(src string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && src == skel {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(skel, src)
+		if err != nil || rel == "." {
+			return err
+		}
+		dst := filepath.Join(home, rel)
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			if err := os.Mkdir(dst, mode.Perm()); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			target, err := os.Readlink(src)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(target, dst); err != nil {
+				return err
+			}
+			return lchown(dst, uid, gid)
+		case mode.IsRegular():
+			content, err := ioutil.ReadFile(src)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(dst, content, mode.Perm()); err != nil {
+				return err
+			}
+		default:
+			log.Printf("Not copying %q from %s, which isn't a regular file", rel, skel)
+			return nil
+		}
+		// Modes are subject to the umask when creating.
+		if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return chown(dst, uid, gid)
+	})
+}
+
+func (o *Offline) SetUserPassword(user, hash string) error {
+	shadow, err := o.accounts.shadow()
+	if err != nil {
+		return err
+	}
+	if entry := shadow.lookup(user); entry != nil && len(entry) > 1 {
+		entry[1] = hash
+	} else {
+		shadow.entries = append(shadow.entries, shadowEntry(user, hash))
+	}
+	return shadow.save()
+}
+
+// AuthorizeSSHKeys stores the keys the way update-ssh-keys does: in a file
+// named after keysName in ~/.ssh/authorized_keys.d, from which
+// ~/.ssh/authorized_keys is regenerated.
+func (o *Offline) AuthorizeSSHKeys(user, keysName string, keys []string) error {
+	home, uid, gid, err := o.accounts.user(user)
+	if err != nil {
+		return err
+	}
+
+	var joined string
+	for _, key := range keys {
+		joined += strings.TrimSpace(key) + "\n"
+	}
+
+	sshDir := path.Join(o.root, home, ".ssh")
+	keysDir := path.Join(sshDir, "authorized_keys.d")
+	if err := os.MkdirAll(keysDir, 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path.Join(keysDir, keysName), []byte(joined), 0600); err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(keysDir)
+	if err != nil {
+		return err
+	}
+	var all []byte
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(path.Join(keysDir, file.Name()))
+		if err != nil {
+			return err
+		}
+		all = append(all, contents...)
+	}
+	if err := ioutil.WriteFile(path.Join(sshDir, "authorized_keys"), all, 0600); err != nil {
+		return err
+	}
+
+	for _, p := range []string{sshDir, keysDir, path.Join(keysDir, keysName), path.Join(sshDir, "authorized_keys")} {
+		if err := chown(p, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteFile writes the file under root, resolving its owner against the
+// accounts of the image rather than those of the running system.
+func (o *Offline) WriteFile(file *File, root string) (string, error) {
+	if file.Owner == "" {
+		return WriteFile(file, root)
+	}
+
+	owner := strings.SplitN(file.Owner, ":", 2)
+	uid, gid := -1, -1
+	if id, err := strconv.Atoi(owner[0]); err == nil {
+		uid = id
+	} else {
+		var err error
+		if _, uid, gid, err = o.accounts.user(owner[0]); err != nil {
+			return "", err
+		}
+	}
+	if len(owner) > 1 && owner[1] != "" {
+		var err error
+		if gid, err = o.accounts.gid(owner[1]); err != nil {
+			return "", err
+		}
+	}
+
+	f := *file
+	f.Owner = ""
+	fullpath, err := WriteFile(&f, root)
+	if err != nil {
+		return "", err
+	}
+	return fullpath, chown(fullpath, uid, gid)
+}
+
+func (o *Offline) WriteEnvFile(envFile *EnvFile, root string) error {
+	return WriteEnvFile(envFile, root)
+}
+
+// RestartNetwork does nothing; the network units take effect when the image
+// boots.
+func (o *Offline) RestartNetwork(interfaces []network.InterfaceGenerator) error {
+	return nil
+}
+
+// PlaceUnit writes the unit into the image. Runtime units are written to
+// /etc instead of /run, since /run doesn't survive until the image boots.
+func (o *Offline) PlaceUnit(u Unit) error {
+	return o.systemd().PlaceUnit(persistent(u))
+}
+
+func (o *Offline) PlaceUnitDropIn(u Unit, d config.UnitDropIn) error {
+	return o.systemd().PlaceUnitDropIn(persistent(u), d)
+}
+
+func (o *Offline) MaskUnit(u Unit) error {
+	return o.systemd().MaskUnit(persistent(u))
+}
+
+func (o *Offline) UnmaskUnit(u Unit) error {
+	return o.systemd().UnmaskUnit(persistent(u))
+}
+
+// DaemonReload does nothing, since there is no systemd to reload.
+func (o *Offline) DaemonReload() error {
+	return nil
+}
+
+// EnableUnitFile creates the symlinks described by the [Install] section of
+// the unit, analogous to `systemctl --root enable`.
+func (o *Offline) EnableUnitFile(u Unit) error {
+	return o.enable(u.Name, map[string]bool{})
+}
+
+// RunUnitCommand queues the command to be run on the unit when the image
+// first boots.
+func (o *Offline) RunUnitCommand(u Unit, c string) (string, error) {
+	switch c {
+	case "start", "stop", "restart", "reload", "try-restart", "reload-or-restart", "reload-or-try-restart":
+	default:
+		return "", fmt.Errorf("Unsupported systemd command %q", c)
+	}
+	if err := o.QueueCommand("/usr/bin/systemctl", "--no-block", c, u.Name); err != nil {
+		return "", err
+	}
+	return "queued", nil
+}
+
+// QueueScript queues the script at scriptPath, a path under root, to be run
+// in a transient unit when the image first boots, like ExecuteScript does on
+// a running system.
+func (o *Offline) QueueScript(scriptPath string) error {
+	rel, err := filepath.Rel(o.root, scriptPath)
+	if err != nil {
+		return err
+	}
+	scriptPath = path.Join("/", rel)
+	name := fmt.Sprintf("coreos-cloudinit-%s.service", path.Base(scriptPath))
+	return o.QueueCommand("/usr/bin/systemd-run", "--unit="+name, "/bin/bash", scriptPath)
+}
+
+// QueueCommand queues the command to be run when the image first boots. The
+// commands are run in order by FirstBootUnit, which is (re)written and
+// enabled each time a command is queued.
+func (o *Offline) QueueCommand(args ...string) error {
+	o.commands = append(o.commands, strings.Join(args, " "))
+
+	done := path.Join(o.workspace, "first-boot-done")
+	content := "[Unit]\n"
+	content += "Description=Run the commands queued by coreos-cloudinit when building the image\n"
+	content += fmt.Sprintf("ConditionPathExists=!%s\n", done)
+	content += "\n[Service]\nType=oneshot\nRemainAfterExit=yes\n"
+	for _, command := range o.commands {
+		content += fmt.Sprintf("ExecStart=%s\n", command)
+	}
+	content += fmt.Sprintf("ExecStartPost=/usr/bin/touch %s\n", done)
+	content += "\n[Install]\nWantedBy=multi-user.target\n"
+
+	unit := Unit{config.Unit{Name: FirstBootUnit, Content: content}}
+	if err := o.PlaceUnit(unit); err != nil {
+		return err
+	}
+	return o.EnableUnitFile(unit)
+}
+
+func (o *Offline) systemd() *systemd {
+	return &systemd{root: o.root}
+}
+
+// enable enables the named unit and those listed in the Also= directives of
+// its [Install] section. The visited units are tracked in seen.
+func (o *Offline) enable(name string, seen map[string]bool) error {
+	if seen[name] {
+		return nil
+	}
+	seen[name] = true
+
+	target, content, err := o.findUnit(name)
+	if err != nil {
+		return err
+	}
+	install := parseInstallSection(content)
+
+	// Enabling an instance of a template, or a template with a default
+	// instance, links the instance to the template's unit file.
+	link := name
+	if strings.HasSuffix(name, "@"+path.Ext(name)) && len(install["DefaultInstance"]) > 0 {
+		link = strings.TrimSuffix(name, path.Ext(name)) + install["DefaultInstance"][0] + path.Ext(name)
+	}
+
+	etc := path.Join(o.root, "etc", "systemd", "system")
+	var links []string
+	for _, wanted := range install["WantedBy"] {
+		links = append(links, path.Join(etc, wanted+".wants", link))
+	}
+	for _, required := range install["RequiredBy"] {
+		links = append(links, path.Join(etc, required+".requires", link))
+	}
+	for _, alias := range install["Alias"] {
+		links = append(links, path.Join(etc, alias))
+	}
+	if len(links) == 0 && len(install["Also"]) == 0 {
+		log.Printf("Unit %q has no installation config, not enabling it", name)
+		return nil
+	}
+
+	for _, l := range links {
+		if err := os.MkdirAll(path.Dir(l), 0755); err != nil {
+			return err
+		}
+		if _, err := os.Lstat(l); err == nil {
+			if err := os.Remove(l); err != nil {
+				return err
+			}
+		}
+		if err := os.Symlink(target, l); err != nil {
+			return err
+		}
+	}
+
+	for _, also := range install["Also"] {
+		if err := o.enable(also, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findUnit looks up the unit file for name in the image, falling back to
+// the template of an instance, and returns its path within the image and
+// its content.
+func (o *Offline) findUnit(name string) (string, string, error) {
+	names := []string{name}
+	if at := strings.Index(name, "@"); at >= 0 {
+		names = append(names, name[:at+1]+path.Ext(name))
+	}
+	for _, n := range names {
+		for _, dir := range []string{"/etc/systemd/system", "/usr/lib/systemd/system", "/lib/systemd/system"} {
+			p := path.Join(dir, n)
+			content, err := ioutil.ReadFile(path.Join(o.root, p))
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return "", "", err
+			}
+			return p, string(content), nil
+		}
+	}
+	return "", "", fmt.Errorf("unit %q not found in %s", name, o.root)
+}
+
+// parseInstallSection returns the directives of the [Install] section of the
+// given unit, each of which may list several space-separated values.
+func parseInstallSection(content string) map[string][]string {
+	install := map[string][]string{}
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		for strings.HasSuffix(line, "\\") && scanner.Scan() {
+			line = strings.TrimSuffix(line, "\\") + " " + strings.TrimSpace(scanner.Text())
+		}
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = line[1 : len(line)-1]
+		case section == "Install":
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			key := strings.TrimSpace(kv[0])
+			install[key] = append(install[key], strings.Fields(kv[1])...)
+		}
+	}
+	return install
+}
+
+// persistent returns a copy of the unit which isn't a runtime unit.
+func persistent(u Unit) Unit {
+	u.Runtime = false
+	return u
+}
+
+// shadowEntry returns a shadow entry with the same defaults as useradd.
+func shadowEntry(user, hash string) []string {
+	lastChange := strconv.FormatInt(time.Now().Unix()/(24*60*60), 10)
+	return []string{user, hash, lastChange, "0", "99999", "7", "", "", ""}
+}
@@ -0,0 +1,264 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// newImage returns the root of a minimal image with the given files, and
+// stubs out chown and lchown for the duration of the test.
+func newImage(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	for name, content := range files {
+		p := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chown = func(string, int, int) error { return nil }
+	lchown = func(string, int, int) error { return nil }
+	return dir
+}
+
+func readImageFile(t *testing.T, root, name string) string {
+	content, err := ioutil.ReadFile(path.Join(root, name))
+	if err != nil {
+		t.Fatalf("bad error reading %s: %v", name, err)
+	}
+	return string(content)
+}
+
+func TestOfflineUsers(t *testing.T) {
+	root := newImage(t, map[string]string{
+		"/etc/passwd":                     "root:x:0:0:root:/root:/bin/bash\n",
+		"/etc/group":                      "root:x:0:root\n",
+		"/usr/share/baselayout/passwd":    "core:x:500:500:CoreOS Admin:/home/core:/bin/bash\n",
+		"/usr/share/baselayout/group":     "docker:x:233:core\n",
+		"/usr/share/baselayout/shadow":    "",
+		"/home/core/.ssh/authorized_keys": "",
+		"/etc/skel/.bashrc":               "source /etc/bash/bashrc\n",
+		"/etc/skel/.config/app.conf":      "key=value\n",
+	})
+	defer os.RemoveAll(root)
+	if err := os.Symlink("/usr/share/skel/.bash_logout", path.Join(root, "/etc/skel/.bash_logout")); err != nil {
+		t.Fatal(err)
+	}
+	o := NewOffline(root, "/var/lib/coreos-cloudinit")
+
+	if !o.UserExists(&config.User{Name: "core"}) {
+		t.Fatalf("user core from the baselayout doesn't exist")
+	}
+	if o.UserExists(&config.User{Name: "bob"}) {
+		t.Fatalf("user bob unexpectedly exists")
+	}
+
+	if err := o.CreateUser(&config.User{Name: "bob", GECOS: "Bob", Groups: []string{"docker"}}); err != nil {
+		t.Fatalf("bad error creating user: %v", err)
+	}
+	if err := o.SetUserPassword("core", "$6$hash"); err != nil {
+		t.Fatalf("bad error setting password: %v", err)
+	}
+
+	if passwd := readImageFile(t, root, "/etc/passwd"); !strings.HasSuffix(passwd, "bob:x:1000:1000:Bob:/home/bob:/bin/bash\n") {
+		t.Errorf("bad passwd: %q", passwd)
+	}
+	if group := readImageFile(t, root, "/etc/group"); group != "root:x:0:root\nbob:x:1000:\ndocker:x:233:core,bob\n" {
+		t.Errorf("bad group: %q", group)
+	}
+	shadow := strings.Split(strings.TrimSpace(readImageFile(t, root, "/etc/shadow")), "\n")
+	if len(shadow) != 2 || !strings.HasPrefix(shadow[0], "bob:*:") || !strings.HasPrefix(shadow[1], "core:$6$hash:") {
+		t.Errorf("bad shadow: %q", shadow)
+	}
+	if fi, err := os.Stat(path.Join(root, "/home/bob")); err != nil || !fi.IsDir() {
+		t.Errorf("home directory of bob wasn't created: %v", err)
+	}
+	if bashrc := readImageFile(t, root, "/home/bob/.bashrc"); bashrc != "source /etc/bash/bashrc\n" {
+		t.Errorf("bad .bashrc copied from /etc/skel: %q", bashrc)
+	}
+	if conf := readImageFile(t, root, "/home/bob/.config/app.conf"); conf != "key=value\n" {
+		t.Errorf("bad .config/app.conf copied from /etc/skel: %q", conf)
+	}
+	if target, err := os.Readlink(path.Join(root, "/home/bob/.bash_logout")); err != nil || target != "/usr/share/skel/.bash_logout" {
+		t.Errorf("bad .bash_logout link copied from /etc/skel: %q, %v", target, err)
+	}
+
+	if err := o.AuthorizeSSHKeys("core", "coreos-cloudinit", []string{" ssh-rsa AAAA core@a ", "ssh-rsa BBBB core@b"}); err != nil {
+		t.Fatalf("bad error authorizing keys: %v", err)
+	}
+	if keys := readImageFile(t, root, "/home/core/.ssh/authorized_keys"); keys != "ssh-rsa AAAA core@a\nssh-rsa BBBB core@b\n" {
+		t.Errorf("bad authorized_keys: %q", keys)
+	}
+	if err := o.AuthorizeSSHKeys("nobody", "coreos-cloudinit", []string{"ssh-rsa AAAA"}); err == nil {
+		t.Errorf("authorizing keys for a missing user unexpectedly succeeded")
+	}
+
+	// Ids are allocated after the highest one in use rather than in gaps.
+	if err := ioutil.WriteFile(path.Join(root, "/etc/passwd"), []byte("root:x:0:0:root:/root:/bin/bash\nold:x:1005:1005::/home/old:/bin/bash\nnobody:x:65534:65534::/:/sbin/nologin\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.CreateUser(&config.User{Name: "carol", NoCreateHome: true}); err != nil {
+		t.Fatalf("bad error creating user: %v", err)
+	}
+	if passwd := readImageFile(t, root, "/etc/passwd"); !strings.HasSuffix(passwd, "carol:x:1006:1006::/home/carol:/bin/bash\n") {
+		t.Errorf("bad passwd: %q", passwd)
+	}
+}
+
+func TestOfflineHostname(t *testing.T) {
+	root := newImage(t, nil)
+	defer os.RemoveAll(root)
+
+	if err := NewOffline(root, "/var/lib/coreos-cloudinit").SetHostname("node1"); err != nil {
+		t.Fatalf("bad error: %v", err)
+	}
+	if hostname := readImageFile(t, root, "/etc/hostname"); hostname != "node1\n" {
+		t.Errorf("bad hostname: %q", hostname)
+	}
+}
+
+func TestOfflineUnits(t *testing.T) {
+	root := newImage(t, map[string]string{
+		"/usr/lib/systemd/system/docker.socket":  "[Socket]\nListenStream=/var/run/docker.sock\n\n[Install]\nWantedBy=sockets.target\n",
+		"/usr/lib/systemd/system/getty@.service": "[Service]\n\n[Install]\nWantedBy=getty.target\nDefaultInstance=tty1\n",
+	})
+	defer os.RemoveAll(root)
+	o := NewOffline(root, "/var/lib/coreos-cloudinit")
+
+	foo := Unit{config.Unit{
+		Name:    "foo.service",
+		Runtime: true,
+		Content: "[Service]\nExecStart=/bin/true\n\n[Install]\nWantedBy=multi-user.target \\\n  default.target\nAlias=bar.service\nAlso=docker.socket\n",
+	}}
+	if err := o.PlaceUnit(foo); err != nil {
+		t.Fatalf("bad error placing unit: %v", err)
+	}
+	for _, u := range []Unit{foo, {config.Unit{Name: "getty@.service"}}} {
+		if err := o.EnableUnitFile(u); err != nil {
+			t.Fatalf("bad error enabling %s: %v", u.Name, err)
+		}
+	}
+	if err := o.EnableUnitFile(Unit{config.Unit{Name: "missing.service"}}); err == nil {
+		t.Errorf("enabling a missing unit unexpectedly succeeded")
+	}
+
+	for link, target := range map[string]string{
+		"multi-user.target.wants/foo.service":   "/etc/systemd/system/foo.service",
+		"default.target.wants/foo.service":      "/etc/systemd/system/foo.service",
+		"bar.service":                           "/etc/systemd/system/foo.service",
+		"sockets.target.wants/docker.socket":    "/usr/lib/systemd/system/docker.socket",
+		"getty.target.wants/getty@tty1.service": "/usr/lib/systemd/system/getty@.service",
+	} {
+		dest, err := os.Readlink(path.Join(root, "etc/systemd/system", link))
+		if err != nil {
+			t.Errorf("bad error reading link %s: %v", link, err)
+		} else if dest != target {
+			t.Errorf("bad link %s: want %q, got %q", link, target, dest)
+		}
+	}
+
+	if res, err := o.RunUnitCommand(foo, "start"); err != nil || res != "queued" {
+		t.Fatalf("bad result running command: %q, %v", res, err)
+	}
+	if _, err := o.RunUnitCommand(foo, "enable"); err == nil {
+		t.Errorf("running an unsupported command unexpectedly succeeded")
+	}
+	if err := o.QueueScript(path.Join(root, "/var/lib/coreos-cloudinit/scripts/123")); err != nil {
+		t.Fatalf("bad error queueing script: %v", err)
+	}
+
+	unit := readImageFile(t, root, "/etc/systemd/system/"+FirstBootUnit)
+	var execs []string
+	for _, line := range strings.Split(unit, "\n") {
+		if strings.HasPrefix(line, "ExecStart") {
+			execs = append(execs, line)
+		}
+	}
+	expect := []string{
+		"ExecStart=/usr/bin/systemctl --no-block start foo.service",
+		"ExecStart=/usr/bin/systemd-run --unit=coreos-cloudinit-123.service /bin/bash /var/lib/coreos-cloudinit/scripts/123",
+		"ExecStartPost=/usr/bin/touch /var/lib/coreos-cloudinit/first-boot-done",
+	}
+	if !reflect.DeepEqual(expect, execs) {
+		t.Errorf("bad first boot unit: want %q, got %q", expect, execs)
+	}
+	if _, err := os.Readlink(path.Join(root, "etc/systemd/system/multi-user.target.wants", FirstBootUnit)); err != nil {
+		t.Errorf("first boot unit wasn't enabled: %v", err)
+	}
+}
+
+func TestOfflineWriteFile(t *testing.T) {
+	root := newImage(t, map[string]string{
+		"/etc/passwd": "etcd:x:232:232::/var/lib/etcd:/sbin/nologin\n",
+		"/etc/group":  "etcd:x:232:\nwheel:x:10:\n",
+	})
+	defer os.RemoveAll(root)
+
+	var owner []int
+	o := NewOffline(root, "/var/lib/coreos-cloudinit")
+	for _, tt := range []struct {
+		owner string
+		uid   int
+		gid   int
+	}{
+		{"etcd", 232, 232},
+		{"etcd:wheel", 232, 10},
+		{"0:0", 0, 0},
+		{"nobody", 0, 0},
+	} {
+		owner = nil
+		chown = func(_ string, uid, gid int) error {
+			owner = []int{uid, gid}
+			return nil
+		}
+		_, err := o.WriteFile(&File{config.File{Path: "/etc/foo", Content: "foo", Owner: tt.owner}}, root)
+		if tt.owner == "nobody" {
+			if err == nil {
+				t.Errorf("writing a file owned by a missing user unexpectedly succeeded")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("bad error (%q): %v", tt.owner, err)
+		}
+		if !reflect.DeepEqual(owner, []int{tt.uid, tt.gid}) {
+			t.Errorf("bad owner (%q): want %d:%d, got %v", tt.owner, tt.uid, tt.gid, owner)
+		}
+	}
+}
+
+func TestParseInstallSection(t *testing.T) {
+	install := parseInstallSection("[Unit]\nWantedBy=nothing\n\n[Install]\n# comment\nWantedBy=a.target b.target\nWantedBy=c.target\nAlias=d.service\n")
+	expect := map[string][]string{
+		"WantedBy": {"a.target", "b.target", "c.target"},
+		"Alias":    {"d.service"},
+	}
+	if !reflect.DeepEqual(expect, install) {
+		t.Errorf("bad [Install] section: want %v, got %v", expect, install)
+	}
+}
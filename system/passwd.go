@@ -0,0 +1,226 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// baselayout is where CoreOS keeps the read-only user and group databases
+// which complement the ones in /etc.
+const baselayout = "/usr/share/baselayout"
+
+// database is a colon-separated account database such as /etc/passwd,
+// /etc/shadow or /etc/group.
+type database struct {
+	path    string
+	perm    os.FileMode
+	entries [][]string
+}
+
+// readDatabase reads the database at the given path. A missing file is
+// treated as an empty database.
+func readDatabase(path string, perm os.FileMode) (*database, error) {
+	db := &database{path: path, perm: perm}
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			db.entries = append(db.entries, strings.Split(line, ":"))
+		}
+	}
+	return db, scanner.Err()
+}
+
+// lookup returns the entry whose first field is name, or nil.
+func (db *database) lookup(name string) []string {
+	for _, entry := range db.entries {
+		if entry[0] == name {
+			return entry
+		}
+	}
+	return nil
+}
+
+// save atomically replaces the database on disk.
+func (db *database) save() error {
+	var buf bytes.Buffer
+	for _, entry := range db.entries {
+		buf.WriteString(strings.Join(entry, ":"))
+		buf.WriteByte('\n')
+	}
+
+	dir := path.Dir(db.path)
+	if err := EnsureDirectoryExists(dir); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "cloudinit-temp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), db.perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), db.path)
+}
+
+// accounts gives access to the user and group databases of the system at
+// root, falling back to the baselayout databases for lookups.
+type accounts struct {
+	root string
+}
+
+func (a accounts) passwd() (*database, error) {
+	return readDatabase(path.Join(a.root, "etc", "passwd"), 0644)
+}
+
+func (a accounts) shadow() (*database, error) {
+	return readDatabase(path.Join(a.root, "etc", "shadow"), 0600)
+}
+
+func (a accounts) group() (*database, error) {
+	return readDatabase(path.Join(a.root, "etc", "group"), 0644)
+}
+
+// lookup finds the named entry in the given database in /etc, then in the
+// baselayout.
+func (a accounts) lookup(file, name string) ([]string, error) {
+	for _, dir := range []string{"etc", baselayout} {
+		db, err := readDatabase(path.Join(a.root, dir, file), 0644)
+		if err != nil {
+			return nil, err
+		}
+		if entry := db.lookup(name); entry != nil {
+			return entry, nil
+		}
+	}
+	return nil, nil
+}
+
+// user returns the home directory, uid and gid of the named user.
+func (a accounts) user(name string) (home string, uid, gid int, err error) {
+	entry, err := a.lookup("passwd", name)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if entry == nil || len(entry) < 6 {
+		return "", 0, 0, fmt.Errorf("user %q does not exist", name)
+	}
+	if uid, err = strconv.Atoi(entry[2]); err != nil {
+		return "", 0, 0, err
+	}
+	if gid, err = strconv.Atoi(entry[3]); err != nil {
+		return "", 0, 0, err
+	}
+	return entry[5], uid, gid, nil
+}
+
+// gid returns the gid of the given group, which may be a name or a number.
+func (a accounts) gid(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	entry, err := a.lookup("group", group)
+	if err != nil {
+		return 0, err
+	}
+	if entry == nil || len(entry) < 3 {
+		return 0, fmt.Errorf("group %q does not exist", group)
+	}
+	return strconv.Atoi(entry[2])
+}
+
+// usedIDs returns the ids used in the given database file, either in /etc
+// or in the baselayout.
+func (a accounts) usedIDs(file string) (map[int]bool, error) {
+	used := map[int]bool{}
+	for _, dir := range []string{"etc", baselayout} {
+		db, err := readDatabase(path.Join(a.root, dir, file), 0644)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range db.entries {
+			if len(entry) > 2 {
+				if id, err := strconv.Atoi(entry[2]); err == nil {
+					used[id] = true
+				}
+			}
+		}
+	}
+	return used, nil
+}
+
+// Regular ids are allocated between minID and maxID, like useradd does with
+// the default UID_MIN and UID_MAX.
+const (
+	minID = 1000
+	maxID = 60000
+)
+
+// freeID returns an id which isn't used in the given database file. System
+// ids are allocated downwards from 999 and regular ids after the highest one
+// in use, like useradd does, so that the ids of deleted users aren't reused.
+func (a accounts) freeID(file string, system bool) (int, error) {
+	used, err := a.usedIDs(file)
+	if err != nil {
+		return 0, err
+	}
+
+	if system {
+		for id := 999; id > 0; id-- {
+			if !used[id] {
+				return id, nil
+			}
+		}
+		return 0, fmt.Errorf("no free system id in %s", file)
+	}
+	highest := minID - 1
+	for id := range used {
+		if id > highest && id <= maxID {
+			highest = id
+		}
+	}
+	if highest < maxID {
+		return highest + 1, nil
+	}
+	// Fall back to the first free id once the highest is taken.
+	for id := minID; id <= maxID; id++ {
+		if !used[id] {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("no free id in %s", file)
+}
@@ -0,0 +1,153 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/network"
+)
+
+// Plan is both a HostManager and a UnitManager which, rather than changing
+// the system, records the changes which would have been made, in order. It
+// still inspects the system where needed to decide what to do (e.g. whether
+// a user exists).
+type Plan struct {
+	root    string
+	actions []string
+}
+
+// NewPlan returns an empty Plan for the system at root.
+func NewPlan(root string) *Plan {
+	return &Plan{root: root}
+}
+
+// Actions returns the recorded actions, in the order they would be made.
+func (p *Plan) Actions() []string {
+	return p.actions
+}
+
+// Record adds an action to the plan.
+func (p *Plan) Record(format string, a ...interface{}) {
+	p.actions = append(p.actions, fmt.Sprintf(format, a...))
+}
+
+// String returns the numbered list of actions.
+func (p *Plan) String() string {
+	var lines []string
+	for i, action := range p.actions {
+		lines = append(lines, fmt.Sprintf("%3d. %s", i+1, action))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p *Plan) SetHostname(hostname string) error {
+	p.Record("Set hostname to %q", hostname)
+	return nil
+}
+
+func (p *Plan) UserExists(user *config.User) bool {
+	return UserExists(user)
+}
+
+func (p *Plan) CreateUser(user *config.User) error {
+	p.Record("Create user %q", user.Name)
+	return nil
+}
+
+func (p *Plan) SetUserPassword(user, hash string) error {
+	p.Record("Set password of user %q", user)
+	return nil
+}
+
+func (p *Plan) AuthorizeSSHKeys(user, keysName string, keys []string) error {
+	p.Record("Authorize %d SSH keys for user %q as %q", len(keys), user, keysName)
+	return nil
+}
+
+func (p *Plan) WriteFile(file *File, root string) (string, error) {
+	fullpath := path.Join(root, file.Path)
+	content, err := config.DecodeContent(file.Content, file.Encoding)
+	if err != nil {
+		return "", fmt.Errorf("Unable to decode %s (%v)", file.Path, err)
+	}
+	perm, err := file.Permissions()
+	if err != nil {
+		return "", err
+	}
+
+	owner := ""
+	if file.Owner != "" {
+		owner = fmt.Sprintf(", owner %s", file.Owner)
+	}
+	p.Record("Write file %s (%d bytes, mode %04o%s)", fullpath, len(content), perm, owner)
+	return fullpath, nil
+}
+
+func (p *Plan) WriteEnvFile(envFile *EnvFile, root string) error {
+	p.Record("Set %s in %s", strings.Join(keys(envFile.Vars), ", "), path.Join(root, envFile.Path))
+	return nil
+}
+
+func (p *Plan) RestartNetwork(interfaces []network.InterfaceGenerator) error {
+	var names []string
+	for _, iface := range interfaces {
+		names = append(names, iface.Name())
+	}
+	p.Record("Restart network interfaces %s", strings.Join(names, ", "))
+	return nil
+}
+
+func (p *Plan) PlaceUnit(unit Unit) error {
+	p.Record("Write unit %s (%d bytes)", unit.Destination(p.root), len(unit.Content))
+	return nil
+}
+
+func (p *Plan) PlaceUnitDropIn(unit Unit, dropIn config.UnitDropIn) error {
+	p.Record("Write drop-in %s (%d bytes)", unit.DropInDestination(p.root, dropIn), len(dropIn.Content))
+	return nil
+}
+
+func (p *Plan) EnableUnitFile(unit Unit) error {
+	p.Record("Enable unit %s", unit.Name)
+	return nil
+}
+
+func (p *Plan) RunUnitCommand(unit Unit, command string) (string, error) {
+	if unit.Blocking() {
+		p.Record("Run %q on unit %s", command, unit.Name)
+	} else {
+		p.Record("Queue %q on unit %s without waiting for it to complete", command, unit.Name)
+	}
+	return "planned", nil
+}
+
+func (p *Plan) MaskUnit(unit Unit) error {
+	p.Record("Mask unit %s", unit.Name)
+	return nil
+}
+
+func (p *Plan) UnmaskUnit(unit Unit) error {
+	p.Record("Unmask unit %s, if masked", unit.Name)
+	return nil
+}
+
+func (p *Plan) DaemonReload() error {
+	p.Record("Reload systemd")
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestPlan(t *testing.T) {
+	p := NewPlan("/tmp/root")
+	p.WriteEnvFile(&EnvFile{
+		File: &File{config.File{Path: "/etc/environment"}},
+		Vars: map[string]string{"B": "2", "A": "1"},
+	}, "/tmp/root")
+	p.PlaceUnitDropIn(Unit{config.Unit{Name: "foo.service", Runtime: true}}, config.UnitDropIn{Name: "10-bar.conf", Content: "[Service]"})
+	if _, err := p.WriteFile(&File{config.File{Path: "/etc/foo", Content: "!", Encoding: "base64"}}, "/tmp/root"); err == nil {
+		t.Fatalf("WriteFile with bad content unexpectedly succeeded")
+	}
+	p.Record("Execute script (%d bytes)", 10)
+
+	expect := `  1. Set A, B in /tmp/root/etc/environment
+  2. Write drop-in /tmp/root/run/systemd/system/foo.service.d/10-bar.conf (9 bytes)
+  3. Execute script (10 bytes)`
+	if s := p.String(); s != expect {
+		t.Fatalf("bad plan: want\n%s\ngot\n%s", expect, s)
+	}
+}
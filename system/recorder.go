@@ -0,0 +1,152 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"path"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/network"
+)
+
+// Action is a change made to the system, along with the error which
+// prevented it, if any.
+type Action struct {
+	Description string `json:"description"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Recorder is both a HostManager and a UnitManager which makes the changes
+// through another HostManager and UnitManager, recording each of them and
+// its outcome. The actions are described in the same way as in a Plan.
+type Recorder struct {
+	hm      HostManager
+	um      UnitManager
+	plan    *Plan
+	actions []Action
+}
+
+// NewRecorder returns a Recorder which changes the system at root through
+// the given managers.
+func NewRecorder(hm HostManager, um UnitManager, root string) *Recorder {
+	return &Recorder{hm: hm, um: um, plan: NewPlan(root)}
+}
+
+// Actions returns the recorded actions, in the order they were made.
+func (r *Recorder) Actions() []Action {
+	return r.actions
+}
+
+// Do makes a change to the system by calling fn and records it with the
+// given description.
+func (r *Recorder) Do(description string, fn func() error) error {
+	err := fn()
+	action := Action{Description: description}
+	if err != nil {
+		action.Error = err.Error()
+	}
+	r.actions = append(r.actions, action)
+	return err
+}
+
+// do calls fn, describing it as the action last added to the plan.
+func (r *Recorder) do(fn func() error) error {
+	actions := r.plan.Actions()
+	return r.Do(actions[len(actions)-1], fn)
+}
+
+func (r *Recorder) SetHostname(hostname string) error {
+	r.plan.SetHostname(hostname)
+	return r.do(func() error { return r.hm.SetHostname(hostname) })
+}
+
+func (r *Recorder) UserExists(user *config.User) bool {
+	return r.hm.UserExists(user)
+}
+
+func (r *Recorder) CreateUser(user *config.User) error {
+	r.plan.CreateUser(user)
+	return r.do(func() error { return r.hm.CreateUser(user) })
+}
+
+func (r *Recorder) SetUserPassword(user, hash string) error {
+	r.plan.SetUserPassword(user, hash)
+	return r.do(func() error { return r.hm.SetUserPassword(user, hash) })
+}
+
+func (r *Recorder) AuthorizeSSHKeys(user, keysName string, keys []string) error {
+	r.plan.AuthorizeSSHKeys(user, keysName, keys)
+	return r.do(func() error { return r.hm.AuthorizeSSHKeys(user, keysName, keys) })
+}
+
+func (r *Recorder) WriteFile(file *File, root string) (fullpath string, err error) {
+	if _, err := r.plan.WriteFile(file, root); err != nil {
+		r.plan.Record("Write file %s", path.Join(root, file.Path))
+	}
+	err = r.do(func() (err error) {
+		fullpath, err = r.hm.WriteFile(file, root)
+		return
+	})
+	return
+}
+
+func (r *Recorder) WriteEnvFile(envFile *EnvFile, root string) error {
+	r.plan.WriteEnvFile(envFile, root)
+	return r.do(func() error { return r.hm.WriteEnvFile(envFile, root) })
+}
+
+func (r *Recorder) RestartNetwork(interfaces []network.InterfaceGenerator) error {
+	r.plan.RestartNetwork(interfaces)
+	return r.do(func() error { return r.hm.RestartNetwork(interfaces) })
+}
+
+func (r *Recorder) PlaceUnit(unit Unit) error {
+	r.plan.PlaceUnit(unit)
+	return r.do(func() error { return r.um.PlaceUnit(unit) })
+}
+
+func (r *Recorder) PlaceUnitDropIn(unit Unit, dropIn config.UnitDropIn) error {
+	r.plan.PlaceUnitDropIn(unit, dropIn)
+	return r.do(func() error { return r.um.PlaceUnitDropIn(unit, dropIn) })
+}
+
+func (r *Recorder) EnableUnitFile(unit Unit) error {
+	r.plan.EnableUnitFile(unit)
+	return r.do(func() error { return r.um.EnableUnitFile(unit) })
+}
+
+func (r *Recorder) RunUnitCommand(unit Unit, command string) (res string, err error) {
+	r.plan.RunUnitCommand(unit, command)
+	err = r.do(func() (err error) {
+		res, err = r.um.RunUnitCommand(unit, command)
+		return
+	})
+	return
+}
+
+func (r *Recorder) MaskUnit(unit Unit) error {
+	r.plan.MaskUnit(unit)
+	return r.do(func() error { return r.um.MaskUnit(unit) })
+}
+
+func (r *Recorder) UnmaskUnit(unit Unit) error {
+	r.plan.UnmaskUnit(unit)
+	return r.do(func() error { return r.um.UnmaskUnit(unit) })
+}
+
+func (r *Recorder) DaemonReload() error {
+	r.plan.DaemonReload()
+	return r.do(func() error { return r.um.DaemonReload() })
+}
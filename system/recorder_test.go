@@ -0,0 +1,53 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+type failingUnitManager struct {
+	*Plan
+}
+
+func (f failingUnitManager) EnableUnitFile(unit Unit) error {
+	return errors.New("no such unit")
+}
+
+func TestRecorder(t *testing.T) {
+	p := NewPlan("/")
+	r := NewRecorder(p, failingUnitManager{p}, "/")
+
+	r.SetHostname("host")
+	if err := r.EnableUnitFile(Unit{config.Unit{Name: "foo.service"}}); err == nil {
+		t.Fatalf("EnableUnitFile unexpectedly succeeded")
+	}
+	r.WriteFile(&File{config.File{Path: "/etc/foo", Content: "!", Encoding: "base64"}}, "/")
+	r.Do("Execute script (10 bytes)", func() error { return nil })
+
+	expect := []Action{
+		{Description: `Set hostname to "host"`},
+		{Description: "Enable unit foo.service", Error: "no such unit"},
+		{Description: "Write file /etc/foo", Error: `Unable to decode /etc/foo (Unable to decode base64: "illegal base64 data at input byte 0")`},
+		{Description: "Execute script (10 bytes)"},
+	}
+	if actions := r.Actions(); !reflect.DeepEqual(expect, actions) {
+		t.Errorf("bad actions: want %#v, got %#v", expect, actions)
+	}
+}
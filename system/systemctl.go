@@ -0,0 +1,104 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// systemctlPath is the systemctl binary used by the systemctl UnitManager.
+var systemctlPath = "systemctl"
+
+// NewSystemctlUnitManager returns a UnitManager for the system at root which
+// shells out to systemctl instead of talking to systemd over D-Bus, for
+// environments without a system bus. It waits up to jobTimeout for the
+// commands of the units which are waited for.
+func NewSystemctlUnitManager(root string, jobTimeout time.Duration) UnitManager {
+	return &systemctl{&systemd{root: root, jobTimeout: jobTimeout}}
+}
+
+// systemctl places unit files in the same way as systemd, but makes the
+// calls to systemd through systemctl.
+type systemctl struct {
+	*systemd
+}
+
+func (s *systemctl) EnableUnitFile(u Unit) error {
+	args := []string{"enable", "--force"}
+	if u.Runtime {
+		args = append(args, "--runtime")
+	}
+	_, err := runSystemctl(append(args, u.Name)...)
+	return err
+}
+
+// RunUnitCommand runs the command on the unit with systemctl. Unless the unit
+// is to be waited for, the job is only queued.
+func (s *systemctl) RunUnitCommand(u Unit, c string) (string, error) {
+	switch c {
+	case "start", "stop", "restart", "reload", "try-restart", "reload-or-restart", "reload-or-try-restart":
+	default:
+		return "", fmt.Errorf("Unsupported systemd command %q", c)
+	}
+
+	if !u.Blocking() {
+		if _, err := runSystemctl("--no-block", c, u.Name); err != nil {
+			return "", err
+		}
+		return "queued", nil
+	}
+
+	res, err := waitForJob(func() (string, error) {
+		if _, err := runSystemctl(c, u.Name); err != nil {
+			return "", err
+		}
+		return "done", nil
+	}, s.jobTimeout)
+	if err != nil {
+		return res, fmt.Errorf("%s of %s failed: %v", c, u.Name, err)
+	}
+	return res, nil
+}
+
+func (s *systemctl) DaemonReload() error {
+	_, err := runSystemctl("daemon-reload")
+	return err
+}
+
+// MaskUnit masks the unit with `systemctl mask`, first removing any existing
+// unit file at the location, like the D-Bus UnitManager does.
+func (s *systemctl) MaskUnit(u Unit) error {
+	if err := os.Remove(u.Destination(s.root)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	args := []string{"mask"}
+	if u.Runtime {
+		args = append(args, "--runtime")
+	}
+	_, err := runSystemctl(append(args, u.Name)...)
+	return err
+}
+
+func runSystemctl(args ...string) (string, error) {
+	output, err := exec.Command(systemctlPath, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("systemctl %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// fakeSystemctl replaces systemctl with a script which logs its arguments and
+// fails for the unit "fail.service". It returns the path of the log.
+func fakeSystemctl(t *testing.T, dir string) string {
+	log := path.Join(dir, "systemctl.log")
+	script := path.Join(dir, "systemctl")
+	content := "#!/bin/sh\necho \"$@\" >> " + log + "\ncase \"$*\" in *fail.service*) echo failed; exit 1;; esac\n"
+	if err := ioutil.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatalf("Unable to write fake systemctl: %v", err)
+	}
+	systemctlPath = script
+	return log
+}
+
+func TestSystemctlUnitManager(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(p string) { systemctlPath = p }(systemctlPath)
+	log := fakeSystemctl(t, dir)
+
+	um := NewSystemctlUnitManager(dir, time.Second)
+	foo := Unit{config.Unit{Name: "foo.service", Runtime: true}}
+	if err := um.EnableUnitFile(foo); err != nil {
+		t.Fatalf("EnableUnitFile(): bad error: want nil, got %v", err)
+	}
+	if err := um.DaemonReload(); err != nil {
+		t.Fatalf("DaemonReload(): bad error: want nil, got %v", err)
+	}
+	noWait := false
+	foo.Wait = &noWait
+	if res, err := um.RunUnitCommand(foo, "start"); err != nil || res != "queued" {
+		t.Fatalf("RunUnitCommand(): bad result: want (queued, nil), got (%s, %v)", res, err)
+	}
+	foo.Wait = nil
+	if res, err := um.RunUnitCommand(foo, "restart"); err != nil || res != "done" {
+		t.Fatalf("RunUnitCommand(): bad result: want (done, nil), got (%s, %v)", res, err)
+	}
+	if err := um.MaskUnit(foo); err != nil {
+		t.Fatalf("MaskUnit(): bad error: want nil, got %v", err)
+	}
+	if _, err := um.RunUnitCommand(foo, "frob"); err == nil {
+		t.Fatalf("RunUnitCommand(): bad error: want non-nil, got nil")
+	}
+	fail := Unit{config.Unit{Name: "fail.service"}}
+	if _, err := um.RunUnitCommand(fail, "start"); err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Fatalf("RunUnitCommand(): bad error: want failure, got %v", err)
+	}
+
+	contents, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatalf("Unable to read systemctl log: %v", err)
+	}
+	want := []string{
+		"enable --force --runtime foo.service",
+		"daemon-reload",
+		"--no-block start foo.service",
+		"restart foo.service",
+		"mask --runtime foo.service",
+		"start fail.service",
+	}
+	if got := strings.Split(strings.TrimSpace(string(contents)), "\n"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad systemctl calls: want %q, got %q", want, got)
+	}
+}
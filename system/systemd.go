@@ -22,17 +22,54 @@ import (
 	"os/exec"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/coreos/coreos-cloudinit/Godeps/_workspace/src/github.com/coreos/go-systemd/dbus"
+	godbus "github.com/coreos/coreos-cloudinit/Godeps/_workspace/src/github.com/guelfey/go.dbus"
 	"github.com/coreos/coreos-cloudinit/config"
 )
 
-func NewUnitManager(root string) UnitManager {
-	return &systemd{root}
+// DefaultJobTimeout is how long to wait for the job of a unit command to
+// complete, for the units which are waited for.
+const DefaultJobTimeout = 5 * time.Minute
+
+// NewUnitManager returns a UnitManager for the system at root which waits up
+// to jobTimeout for the jobs of the units which are waited for. It talks to
+// systemd over D-Bus if it can connect to the system bus, and falls back to
+// systemctl otherwise.
+func NewUnitManager(root string, jobTimeout time.Duration) UnitManager {
+	if _, err := systemdConnection(); err != nil {
+		log.Printf("Failed connecting to systemd over D-Bus (%v), falling back to systemctl", err)
+		return NewSystemctlUnitManager(root, jobTimeout)
+	}
+	return &systemd{root: root, jobTimeout: jobTimeout}
+}
+
+var (
+	systemdConnMutex sync.Mutex
+	systemdConn      *dbus.Conn
+)
+
+// systemdConnection returns the D-Bus connection to systemd, which is
+// established on first use and then shared.
+func systemdConnection() (*dbus.Conn, error) {
+	systemdConnMutex.Lock()
+	defer systemdConnMutex.Unlock()
+
+	if systemdConn == nil {
+		conn, err := dbus.New()
+		if err != nil {
+			return nil, err
+		}
+		systemdConn = conn
+	}
+	return systemdConn, nil
 }
 
 type systemd struct {
-	root string
+	root       string
+	jobTimeout time.Duration
 }
 
 // fakeMachineID is placed on non-usr CoreOS images and should
@@ -66,7 +103,7 @@ func (s *systemd) PlaceUnitDropIn(u Unit, d config.UnitDropIn) error {
 }
 
 func (s *systemd) EnableUnitFile(u Unit) error {
-	conn, err := dbus.New()
+	conn, err := systemdConnection()
 	if err != nil {
 		return err
 	}
@@ -76,37 +113,99 @@ func (s *systemd) EnableUnitFile(u Unit) error {
 	return err
 }
 
+// RunUnitCommand queues the job for the command on the unit. If the unit is
+// to be waited for, it then waits up to the job timeout for the job to
+// complete and fails unless it succeeded. Otherwise, it returns the path of
+// the queued job.
 func (s *systemd) RunUnitCommand(u Unit, c string) (string, error) {
-	conn, err := dbus.New()
+	conn, err := systemdConnection()
 	if err != nil {
 		return "", err
 	}
 
 	var fn func(string, string) (string, error)
+	var method string
 	switch c {
 	case "start":
-		fn = conn.StartUnit
+		fn, method = conn.StartUnit, "StartUnit"
 	case "stop":
-		fn = conn.StopUnit
+		fn, method = conn.StopUnit, "StopUnit"
 	case "restart":
-		fn = conn.RestartUnit
+		fn, method = conn.RestartUnit, "RestartUnit"
 	case "reload":
-		fn = conn.ReloadUnit
+		fn, method = conn.ReloadUnit, "ReloadUnit"
 	case "try-restart":
-		fn = conn.TryRestartUnit
+		fn, method = conn.TryRestartUnit, "TryRestartUnit"
 	case "reload-or-restart":
-		fn = conn.ReloadOrRestartUnit
+		fn, method = conn.ReloadOrRestartUnit, "ReloadOrRestartUnit"
 	case "reload-or-try-restart":
-		fn = conn.ReloadOrTryRestartUnit
+		fn, method = conn.ReloadOrTryRestartUnit, "ReloadOrTryRestartUnit"
 	default:
 		return "", fmt.Errorf("Unsupported systemd command %q", c)
 	}
 
-	return fn(u.Name, "replace")
+	if !u.Blocking() {
+		return enqueueJob(method, u.Name)
+	}
+
+	res, err := waitForJob(func() (string, error) { return fn(u.Name, "replace") }, s.jobTimeout)
+	if err != nil {
+		return res, fmt.Errorf("%s of %s failed: %v", c, u.Name, err)
+	}
+	return res, nil
+}
+
+// enqueueJob calls the given method of the systemd manager to queue a job
+// for the unit, without waiting for the job to complete. It returns the
+// path of the job.
+func enqueueJob(method, name string) (string, error) {
+	conn, err := godbus.SystemBus()
+	if err != nil {
+		return "", err
+	}
+
+	var job godbus.ObjectPath
+	err = conn.Object("org.freedesktop.systemd1", "/org/freedesktop/systemd1").Call("org.freedesktop.systemd1.Manager."+method, 0, name, "replace").Store(&job)
+	return string(job), err
+}
+
+// waitForJob waits up to timeout for the job run by run to complete and
+// returns its result, which is an error unless the job was done or skipped.
+// The go-systemd methods which run jobs block on the job-completion channel
+// until systemd reports the result of the job.
+func waitForJob(run func() (string, error), timeout time.Duration) (string, error) {
+	type result struct {
+		res string
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		res, err := run()
+		ch <- result{res, err}
+	}()
+
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			return "", r.err
+		}
+		switch r.res {
+		case "done", "skipped":
+			return r.res, nil
+		default:
+			return r.res, fmt.Errorf("job %s", r.res)
+		}
+	case <-time.After(timeout):
+		// There is no way to stop waiting for the job, so the goroutine,
+		// and go-systemd's listener for the job, are left behind until
+		// systemd reports its result.
+		log.Printf("Gave up waiting for a job after %v; it is still listened for until it completes", timeout)
+		return "timeout", fmt.Errorf("job timed out after %v", timeout)
+	}
 }
 
 func (s *systemd) DaemonReload() error {
-	conn, err := dbus.New()
+	conn, err := systemdConnection()
 	if err != nil {
 		return err
 	}
@@ -176,7 +275,7 @@ func ExecuteScript(scriptPath string) (string, error) {
 
 	log.Printf("Creating transient systemd unit '%s'", name)
 
-	conn, err := dbus.New()
+	conn, err := systemdConnection()
 	if err != nil {
 		return "", err
 	}
@@ -15,11 +15,13 @@
 package system
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/coreos/coreos-cloudinit/config"
 )
@@ -44,7 +46,7 @@ func TestPlaceUnit(t *testing.T) {
 		}
 
 		u := Unit{tt}
-		sd := &systemd{dir}
+		sd := &systemd{root: dir}
 
 		if err := sd.PlaceUnit(u); err != nil {
 			t.Fatalf("PlaceUnit(): bad error (%+v): want nil, got %s", tt, err)
@@ -102,7 +104,7 @@ func TestPlaceUnitDropIn(t *testing.T) {
 		}
 
 		u := Unit{tt}
-		sd := &systemd{dir}
+		sd := &systemd{root: dir}
 
 		if err := sd.PlaceUnitDropIn(u, u.DropIns[0]); err != nil {
 			t.Fatalf("PlaceUnit(): bad error (%+v): want nil, got %s", tt, err)
@@ -152,7 +154,7 @@ func TestMaskUnit(t *testing.T) {
 	}
 	defer os.RemoveAll(dir)
 
-	sd := &systemd{dir}
+	sd := &systemd{root: dir}
 
 	// Ensure mask works with units that do not currently exist
 	uf := Unit{config.Unit{Name: "foo.service"}}
@@ -193,7 +195,7 @@ func TestUnmaskUnit(t *testing.T) {
 	}
 	defer os.RemoveAll(dir)
 
-	sd := &systemd{dir}
+	sd := &systemd{root: dir}
 
 	nilUnit := Unit{config.Unit{Name: "null.service"}}
 	if err := sd.UnmaskUnit(nilUnit); err != nil {
@@ -278,3 +280,32 @@ func TestNullOrEmpty(t *testing.T) {
 	}
 
 }
+
+func TestWaitForJob(t *testing.T) {
+	for _, tt := range []struct {
+		res   string
+		err   error
+		delay time.Duration
+
+		expectRes string
+		expectErr string
+	}{
+		{res: "done", expectRes: "done"},
+		{res: "skipped", expectRes: "skipped"},
+		{res: "failed", expectRes: "failed", expectErr: "job failed"},
+		{res: "dependency", expectRes: "dependency", expectErr: "job dependency"},
+		{err: errors.New("no such unit"), expectErr: "no such unit"},
+		{res: "done", delay: time.Second, expectRes: "timeout", expectErr: "job timed out after 10ms"},
+	} {
+		res, err := waitForJob(func() (string, error) {
+			time.Sleep(tt.delay)
+			return tt.res, tt.err
+		}, 10*time.Millisecond)
+		if res != tt.expectRes {
+			t.Errorf("bad result (%+v): want %q, got %q", tt, tt.expectRes, res)
+		}
+		if e := fmt.Sprint(err); (err != nil || tt.expectErr != "") && e != tt.expectErr {
+			t.Errorf("bad error (%+v): want %q, got %q", tt, tt.expectErr, e)
+		}
+	}
+}
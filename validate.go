@@ -0,0 +1,72 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/coreos-cloudinit/config/validate"
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+// validateFiles validates each of the given user-data files, printing the
+// combined report in the format given by --validate-format, and returns the
+// exit code. Failures to read or validate a file are printed to stderr, so
+// that they don't corrupt the JSON and SARIF reports.
+func validateFiles(paths []string) int {
+	ret := 0
+	var docs []validate.Document
+	var diffs []string
+	for _, p := range paths {
+		userdata, err := ioutil.ReadFile(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed reading user-data: %v\n", err)
+			ret = 1
+			continue
+		}
+
+		report, err := validate.Validate(userdata)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed while validating %s (%q)\n", p, err)
+			ret = 1
+			continue
+		}
+		docs = append(docs, validate.Document{Name: p, Report: report})
+		if report.Fails(flags.failOn) {
+			ret = 1
+		}
+
+		if flags.fix && len(userdata) > 0 {
+			if fixed, err := validate.Fix(userdata); err == nil {
+				diffs = append(diffs, pkg.UnifiedDiff(filepath.Join("a", p), filepath.Join("b", p), userdata, fixed))
+			} else {
+				fmt.Fprintf(os.Stderr, "Failed fixing %s: %v\n", p, err)
+				ret = 1
+			}
+		}
+	}
+
+	if err := validate.WriteReports(os.Stdout, flags.validateFormat, docs); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed writing report: %v\n", err)
+		return 1
+	}
+	for _, d := range diffs {
+		fmt.Print(d)
+	}
+	return ret
+}